@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,11 +12,14 @@ import (
 	"github.com/spf13/cobra"
 
 	"path/filepath"
+	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"log"
 
 	"github.com/local/picobot/internal/agent"
+	"github.com/local/picobot/internal/agent/hooks"
 	"github.com/local/picobot/internal/agent/memory"
 	"github.com/local/picobot/internal/channels"
 	"github.com/local/picobot/internal/chat"
@@ -23,6 +27,8 @@ import (
 	"github.com/local/picobot/internal/cron"
 	"github.com/local/picobot/internal/heartbeat"
 	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/session"
+	"github.com/local/picobot/internal/usage"
 )
 
 const version = "0.1.0"
@@ -67,12 +73,17 @@ func NewRootCmd() *cobra.Command {
 
 			hub := chat.NewHub(100)
 			cfg, _ := config.LoadConfig()
-			var provider providers.LLMProvider
-			if cfg.Providers.OpenAI != nil && cfg.Providers.OpenAI.APIKey != "" {
-				provider = providers.NewOpenAIProvider(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase)
-			} else {
-				provider = providers.NewStubProvider()
+			configured, err := providers.NewProviderFromConfig(cfg)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
+				return
+			}
+			base, err := withReplay(cmd, configured)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
+				return
 			}
+			provider := usage.NewRecordingProvider(base, usage.NewRecorder(cfg.Agents.Defaults.Workspace))
 
 			// choose model: flag > config default > provider default
 			model := modelFlag
@@ -84,6 +95,30 @@ func NewRootCmd() *cobra.Command {
 			}
 
 			ag := agent.NewAgentLoop(hub, provider, model, 5, cfg.Agents.Defaults.Workspace, nil)
+			ag.SetModelRoutes(modelRoutes(cfg))
+			ag.SetModelRegistry(providers.NewModelRegistry(cfg.Models))
+			ag.SetGenerationOptions(generationOptions(cfg))
+			if len(cfg.Approvals.Tools) > 0 {
+				ag.SetApprovalPolicy(approvalPolicy(cfg))
+			}
+			if err := addHooks(ag, cfg); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
+				return
+			}
+			if err := setMemoryRanker(ag, cfg); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
+				return
+			}
+			if err := setProfiles(ag, cfg); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
+				return
+			}
+			if st, err := setSessionStore(ag, cfg); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
+				return
+			} else if st != nil {
+				defer st.Close()
+			}
 
 			resp, err := ag.ProcessDirect(msg, 300*time.Second) // 5 minutes for slow providers
 			if err != nil {
@@ -94,7 +129,8 @@ func NewRootCmd() *cobra.Command {
 		},
 	}
 	agentCmd.Flags().StringP("message", "m", "", "Message to send to the agent")
-	agentCmd.Flags().StringP("model", "M", "", "Model to use (overrides config/provider default)")
+	agentCmd.Flags().StringP("model", "M", "", "Model to use, optionally as provider/model (overrides config/provider default)")
+	addReplayFlags(agentCmd)
 	rootCmd.AddCommand(agentCmd)
 
 	gatewayCmd := &cobra.Command{
@@ -103,7 +139,17 @@ func NewRootCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			hub := chat.NewHub(200)
 			cfg, _ := config.LoadConfig()
-			provider := providers.NewProviderFromConfig(cfg)
+			configured, err := providers.NewProviderFromConfig(cfg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return
+			}
+			base, err := withReplay(cmd, configured)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return
+			}
+			provider := usage.NewRecordingProvider(base, usage.NewRecorder(cfg.Agents.Defaults.Workspace))
 
 			// choose model: flag > config > provider default
 			modelFlag, _ := cmd.Flags().GetString("model")
@@ -127,12 +173,45 @@ func NewRootCmd() *cobra.Command {
 			})
 
 			ag := agent.NewAgentLoop(hub, provider, model, 20, cfg.Agents.Defaults.Workspace, scheduler)
+			ag.SetModelRoutes(modelRoutes(cfg))
+			ag.SetModelChoice(modelChoice(cfg))
+			ag.SetModelRegistry(providers.NewModelRegistry(cfg.Models))
+			ag.SetGenerationOptions(generationOptions(cfg))
+			ag.SetMaxConcurrentChats(cfg.Agents.Defaults.MaxConcurrentChats)
+			if len(cfg.Approvals.Tools) > 0 {
+				ag.SetApprovalPolicy(approvalPolicy(cfg))
+			}
+			if err := addHooks(ag, cfg); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return
+			}
+			if err := setMemoryRanker(ag, cfg); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return
+			}
+			if err := setProfiles(ag, cfg); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return
+			}
+			if st, err := setSessionStore(ag, cfg); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return
+			} else if st != nil {
+				defer st.Close()
+			}
+			for _, c := range cfg.Commands {
+				ag.RegisterCommand(agent.Command{Name: c.Name, Description: c.Description, Prompt: c.Prompt})
+			}
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
 			// start agent loop
 			go ag.Run(ctx)
 
+			// route outbound messages to whichever channel they belong to
+			router := chat.NewRouter(hub)
+			go router.Run(ctx)
+
 			// start cron scheduler
 			go scheduler.Start(ctx.Done())
 
@@ -145,14 +224,18 @@ func NewRootCmd() *cobra.Command {
 
 			// start telegram if enabled
 			if cfg.Channels.Telegram.Enabled {
-				if err := channels.StartTelegram(ctx, hub, cfg.Channels.Telegram.Token, cfg.Channels.Telegram.AllowFrom); err != nil {
+				if err := channels.StartTelegram(ctx, hub, router, cfg.Channels.Telegram.Token, cfg.Channels.Telegram.AllowFrom); err != nil {
 					fmt.Fprintf(os.Stderr, "failed to start telegram: %v\n", err)
+				} else if err := channels.SetTelegramCommands(cfg.Channels.Telegram.Token, menuCommands(ag)); err != nil {
+					log.Printf("telegram: failed to register commands: %v", err)
 				}
 			}
 			// start discord if enabled
 			if cfg.Channels.Discord.Enabled {
-				if err := channels.StartDiscord(ctx, hub, cfg.Channels.Discord.Token, cfg.Channels.Discord.AllowFrom); err != nil {
+				if err := channels.StartDiscord(ctx, hub, router, cfg.Channels.Discord.Token, cfg.Channels.Discord.AllowFrom); err != nil {
 					fmt.Fprintf(os.Stderr, "failed to start discord: %v\n", err)
+				} else if err := channels.SetDiscordCommands(cfg.Channels.Discord.Token, menuCommands(ag)); err != nil {
+					log.Printf("discord: failed to register commands: %v", err)
 				}
 			}
 
@@ -164,7 +247,8 @@ func NewRootCmd() *cobra.Command {
 			cancel()
 		},
 	}
-	gatewayCmd.Flags().StringP("model", "M", "", "Model to use (overrides config/provider default)")
+	gatewayCmd.Flags().StringP("model", "M", "", "Model to use, optionally as provider/model (overrides config/provider default)")
+	addReplayFlags(gatewayCmd)
 	rootCmd.AddCommand(gatewayCmd)
 
 	// memory subcommands: read, append, write, recent
@@ -353,12 +437,21 @@ func NewRootCmd() *cobra.Command {
 					items = append(items, memory.MemoryItem{Kind: "long", Text: line})
 				}
 			}
-			provider := providers.NewProviderFromConfig(cfg)
+			configured, err := providers.NewProviderFromConfig(cfg)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
+				return
+			}
+			provider := usage.NewRecordingProvider(configured, usage.NewRecorder(ws))
 			var logger *log.Logger
 			if verbose {
 				logger = log.New(cmd.OutOrStdout(), "ranker: ", 0)
 			}
-			ranker := memory.NewLLMRankerWithLogger(provider, provider.GetDefaultModel(), logger)
+			rankModel := cfg.Agents.Defaults.RankingModel
+			if rankModel == "" {
+				rankModel = provider.GetDefaultModel()
+			}
+			ranker := memory.NewLLMRankerWithLogger(provider, rankModel, logger)
 			res := ranker.Rank(q, items, top)
 			for i, m := range res {
 				fmt.Fprintf(cmd.OutOrStdout(), "%d: %s (%s)\n", i+1, m.Text, m.Kind)
@@ -371,9 +464,234 @@ func NewRootCmd() *cobra.Command {
 	memoryCmd.AddCommand(rankCmd)
 
 	rootCmd.AddCommand(memoryCmd)
+
+	usageCmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Summarise token usage and estimated cost by day, model and chat",
+		Run: func(cmd *cobra.Command, args []string) {
+			days, _ := cmd.Flags().GetInt("days")
+			by, _ := cmd.Flags().GetString("by")
+			groups := []string{usage.ByDay, usage.ByModel, usage.ByChat}
+			if by != "" {
+				if by != usage.ByDay && by != usage.ByModel && by != usage.ByChat {
+					fmt.Fprintln(cmd.ErrOrStderr(), "--by must be one of: day, model, chat")
+					return
+				}
+				groups = []string{by}
+			}
+			cfg, _ := config.LoadConfig()
+			ws := cfg.Agents.Defaults.Workspace
+			if ws == "" {
+				ws = "~/.picobot/workspace"
+			}
+			home, _ := os.UserHomeDir()
+			if strings.HasPrefix(ws, "~/") {
+				ws = filepath.Join(home, ws[2:])
+			}
+			var since time.Time
+			if days > 0 {
+				y, m, d := time.Now().AddDate(0, 0, -(days - 1)).Date()
+				since = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+			}
+			records, err := usage.NewRecorder(ws).Records(since)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
+				return
+			}
+			if len(records) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No usage recorded yet.")
+				return
+			}
+			printUsage(cmd.OutOrStdout(), records, groups, cfg.Pricing)
+		},
+	}
+	usageCmd.Flags().IntP("days", "d", 30, "Number of days to include (0 = all)")
+	usageCmd.Flags().StringP("by", "b", "", "Group by day, model or chat (default: all three)")
+	rootCmd.AddCommand(usageCmd)
 	return rootCmd
 }
 
+// printUsage writes one table per grouping.
+func printUsage(w io.Writer, records []usage.Record, groups []string, prices map[string]config.ModelPrice) {
+	unpriced := 0
+	for _, by := range groups {
+		rows := usage.Summarize(records, by, prices)
+		fmt.Fprintf(w, "By %s:\n", by)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\tCALLS\tPROMPT\tCACHED\tCOMPLETION\tCOST\n", strings.ToUpper(by))
+		var total usage.Row
+		for _, r := range rows {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t$%.4f\n", r.Key, r.Calls, r.PromptTokens, r.CachedTokens, r.CompletionTokens, r.Cost)
+			total.Calls += r.Calls
+			total.PromptTokens += r.PromptTokens
+			total.CachedTokens += r.CachedTokens
+			total.CompletionTokens += r.CompletionTokens
+			total.Cost += r.Cost
+			total.Unpriced += r.Unpriced
+		}
+		fmt.Fprintf(tw, "total\t%d\t%d\t%d\t%d\t$%.4f\n", total.Calls, total.PromptTokens, total.CachedTokens, total.CompletionTokens, total.Cost)
+		tw.Flush()
+		fmt.Fprintln(w)
+		unpriced = total.Unpriced
+	}
+	if unpriced > 0 {
+		fmt.Fprintf(w, "%d call(s) used models without an entry under \"pricing\" in the config and are not included in COST.\n", unpriced)
+	}
+}
+
+// addReplayFlags adds --record and --replay to a command that talks to the LLM.
+func addReplayFlags(cmd *cobra.Command) {
+	cmd.Flags().String("record", "", "Record LLM requests and responses to this cassette file")
+	cmd.Flags().String("replay", "", "Answer LLM requests from this cassette file instead of the provider (no network)")
+}
+
+// withReplay wraps provider according to --record/--replay.
+func withReplay(cmd *cobra.Command, provider providers.LLMProvider) (providers.LLMProvider, error) {
+	record, _ := cmd.Flags().GetString("record")
+	replay, _ := cmd.Flags().GetString("replay")
+	switch {
+	case record != "" && replay != "":
+		return nil, fmt.Errorf("--record and --replay cannot be used together")
+	case record != "":
+		rp, err := providers.NewReplayProvider(record, providers.ReplayRecord, provider)
+		if err != nil {
+			return nil, err
+		}
+		return rp, nil
+	case replay != "":
+		rp, err := providers.NewReplayProvider(replay, providers.ReplayPlayback, nil)
+		if err != nil {
+			return nil, err
+		}
+		return rp, nil
+	}
+	return provider, nil
+}
+
+// generationOptions returns the chat generation options configured under agents.defaults.
+func generationOptions(cfg config.Config) providers.GenerationOptions {
+	return providers.GenerationOptions{
+		MaxTokens:   cfg.Agents.Defaults.MaxTokens,
+		Temperature: cfg.Agents.Defaults.Temperature,
+	}
+}
+
+// modelRoutes returns the per-purpose models configured under agents.defaults.
+func modelRoutes(cfg config.Config) agent.ModelRoutes {
+	return agent.ModelRoutes{
+		Compaction: cfg.Agents.Defaults.CompactionModel,
+		Subagent:   cfg.Agents.Defaults.SubagentModel,
+	}
+}
+
+// modelChoice limits /model to allowedModels, or to known models of the configured providers.
+func modelChoice(cfg config.Config) agent.ModelChoice {
+	names := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return agent.ModelChoice{Allowed: cfg.Agents.Defaults.AllowedModels, Providers: names}
+}
+
+func approvalPolicy(cfg config.Config) agent.ApprovalPolicy {
+	return agent.ApprovalPolicy{
+		Rules:   cfg.Approvals.Tools,
+		Timeout: time.Duration(cfg.Approvals.TimeoutS) * time.Second,
+	}
+}
+
+// addHooks registers the built-in hooks enabled under "hooks".
+func addHooks(ag *agent.AgentLoop, cfg config.Config) error {
+	hs, err := hooks.FromConfig(cfg.Hooks, cfg.Agents.Defaults.Workspace)
+	if err != nil {
+		return err
+	}
+	for _, h := range hs {
+		ag.AddHook(h)
+	}
+	return nil
+}
+
+// setMemoryRanker makes the agent pick memories by embedding similarity when
+// agents.defaults.embeddingModel is set. Vectors are cached under the workspace.
+func setMemoryRanker(ag *agent.AgentLoop, cfg config.Config) error {
+	model := cfg.Agents.Defaults.EmbeddingModel
+	if model == "" {
+		return nil
+	}
+	e := providers.NewEmbedderFromConfig(cfg, filepath.Join(cfg.Agents.Defaults.Workspace, "embeddings"))
+	if e == nil {
+		return fmt.Errorf("embeddingModel %q is set, but no configured provider serves embeddings", model)
+	}
+	ag.SetMemoryRanker(memory.NewEmbeddingRanker(e, model))
+	return nil
+}
+
+// setProfiles sets the agent profiles and routes under "agents".
+func setProfiles(ag *agent.AgentLoop, cfg config.Config) error {
+	if len(cfg.Agents.Profiles) == 0 && len(cfg.Agents.Routes) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Agents.Profiles))
+	for name := range cfg.Agents.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var profiles []agent.Profile
+	for _, name := range names {
+		p := cfg.Agents.Profiles[name]
+		profile := agent.Profile{Name: name, BootstrapDir: p.Bootstrap, Model: p.Model, Memory: p.Memory}
+		// an empty list means all, as when it is left out
+		if len(p.Tools) > 0 {
+			profile.Tools = p.Tools
+		}
+		if len(p.Skills) > 0 {
+			profile.Skills = p.Skills
+		}
+		profiles = append(profiles, profile)
+	}
+	var routes []agent.ProfileRoute
+	for _, r := range cfg.Agents.Routes {
+		routes = append(routes, agent.ProfileRoute{Profile: r.Profile, Channel: r.Channel, ChatID: r.ChatID, SenderID: r.SenderID})
+	}
+	return ag.SetProfiles(profiles, routes)
+}
+
+// setSessionStore switches the agent to the session store under "sessionStore". The
+// caller closes the returned store, which is nil for the default JSON files.
+func setSessionStore(ag *agent.AgentLoop, cfg config.Config) (session.SessionStore, error) {
+	switch cfg.Agents.Defaults.SessionStore {
+	case "", config.SessionStoreJSON:
+		return nil, nil
+	case config.SessionStoreSQLite:
+		st, err := session.OpenSQLiteStore(filepath.Join(cfg.Agents.Defaults.Workspace, "sessions.db"))
+		if err != nil {
+			return nil, err
+		}
+		// chats kept by the JSON store carry over when a workspace switches to SQLite
+		if n, err := st.ImportJSON(filepath.Join(cfg.Agents.Defaults.Workspace, "sessions")); err != nil {
+			st.Close()
+			return nil, err
+		} else if n > 0 {
+			log.Printf("imported %d sessions from sessions/ into sessions.db", n)
+		}
+		ag.SetSessionStore(st)
+		return st, nil
+	}
+	return nil, fmt.Errorf("unknown sessionStore %q (want %q or %q)", cfg.Agents.Defaults.SessionStore, config.SessionStoreJSON, config.SessionStoreSQLite)
+}
+
+// menuCommands lists the agent's slash commands for the chat apps' command menus. Commands
+// of skills added later work, but only show up in the menus after a restart.
+func menuCommands(ag *agent.AgentLoop) []channels.Command {
+	var cmds []channels.Command
+	for _, c := range ag.Commands() {
+		cmds = append(cmds, channels.Command{Name: c.Name, Description: c.Description, Args: c.Args})
+	}
+	return cmds
+}
+
 func main() {
 	rootCmd := NewRootCmd()
 	if err := rootCmd.Execute(); err != nil {
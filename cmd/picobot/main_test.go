@@ -133,7 +133,7 @@ func TestAgentCLI_ModelFlag(t *testing.T) {
 	// remove OpenAI from config so stub provider is used
 	cfgPath, _, _ := config.ResolveDefaultPaths()
 	cfg2, _ := config.LoadConfig()
-	cfg2.Providers.OpenAI = nil
+	delete(cfg2.Providers, "openai")
 	_ = config.SaveConfig(cfg2, cfgPath)
 
 	cmd := NewRootCmd()
@@ -148,3 +148,63 @@ func TestAgentCLI_ModelFlag(t *testing.T) {
 		t.Fatalf("expected stub echo output, got: %q", out)
 	}
 }
+
+func TestAgentCLI_EmbeddingModelNeedsEmbedder(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	if _, _, err := config.Onboard(); err != nil {
+		t.Fatalf("onboard failed: %v", err)
+	}
+	// the stub provider cannot embed
+	cfgPath, _, _ := config.ResolveDefaultPaths()
+	cfg2, _ := config.LoadConfig()
+	delete(cfg2.Providers, "openai")
+	cfg2.Agents.Defaults.EmbeddingModel = "nomic-embed-text"
+	_ = config.SaveConfig(cfg2, cfgPath)
+
+	cmd := NewRootCmd()
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetErr(errOut)
+	cmd.SetArgs([]string{"agent", "-m", "hello"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("agent failed: %v", err)
+	}
+	if !strings.Contains(errOut.String(), "serves embeddings") || out.Len() != 0 {
+		t.Fatalf("expected an embedding model error, got out %q, err %q", out, errOut)
+	}
+}
+
+func TestUsageCLI(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	if _, _, err := config.Onboard(); err != nil {
+		t.Fatalf("onboard failed: %v", err)
+	}
+	// use the stub provider so the agent call succeeds offline
+	cfgPath, _, _ := config.ResolveDefaultPaths()
+	cfg, _ := config.LoadConfig()
+	delete(cfg.Providers, "openai")
+	_ = config.SaveConfig(cfg, cfgPath)
+
+	cmd := NewRootCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs([]string{"agent", "--model", "stub-model", "-m", "hello"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("agent failed: %v", err)
+	}
+
+	cmd = NewRootCmd()
+	buf := &bytes.Buffer{}
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"usage"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("usage failed: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"By day:", "By model:", "stub-model", "By chat:", "cli:direct"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in usage output, got: %q", want, out)
+		}
+	}
+}
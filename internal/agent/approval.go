@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// Approval modes of a tool call.
+const (
+	ApprovalAlways = "always" // run without asking (the default)
+	ApprovalNever  = "never"  // refuse
+	ApprovalAsk    = "ask"    // ask the chat, and run only once approved
+)
+
+// DefaultApprovalTimeout is how long a call waits for an answer before it is denied.
+const DefaultApprovalTimeout = 5 * time.Minute
+
+// ApprovalPolicy decides which tool calls need a person's approval.
+type ApprovalPolicy struct {
+	// Rules maps a tool name, or "tool:action" for tools with an "action" argument such as
+	// "filesystem:write", to an Approval* mode. "tool:action" wins over "tool"; calls
+	// without a rule are always allowed, and an unknown mode counts as "ask".
+	Rules   map[string]string
+	Timeout time.Duration // 0 means DefaultApprovalTimeout
+}
+
+// Mode returns the approval mode of call.
+func (p ApprovalPolicy) Mode(call providers.ToolCall) string {
+	mode, ok := "", false
+	if action, _ := call.Arguments["action"].(string); action != "" {
+		mode, ok = p.Rules[call.Name+":"+action]
+	}
+	if !ok {
+		if mode, ok = p.Rules[call.Name]; !ok {
+			return ApprovalAlways
+		}
+	}
+	switch mode {
+	case ApprovalAlways, ApprovalNever, ApprovalAsk:
+		return mode
+	}
+	return ApprovalAsk
+}
+
+// cronSenderID is the SenderID of the messages the gateway sends when a cron job fires.
+const cronSenderID = "cron"
+
+// approvalArgsLen caps the arguments shown in an approval request.
+const approvalArgsLen = 500
+
+// approvals is a BeforeToolHook that enforces an ApprovalPolicy. For "ask" it sends the call
+// to the run's chat and waits for /approve or /deny, which are immediate commands, so an
+// answer never waits behind the run it unblocks.
+type approvals struct {
+	policy ApprovalPolicy
+	hub    *chat.Hub
+
+	mu      sync.Mutex
+	pending map[string]*pendingApproval // by id
+}
+
+type pendingApproval struct {
+	channel, chatID string
+	senderID        string    // who may answer; "" means anyone in the chat
+	decision        chan bool // buffered; receives the first answer
+}
+
+func newApprovals(policy ApprovalPolicy, hub *chat.Hub) *approvals {
+	if policy.Timeout <= 0 {
+		policy.Timeout = DefaultApprovalTimeout
+	}
+	return &approvals{policy: policy, hub: hub, pending: map[string]*pendingApproval{}}
+}
+
+func (a *approvals) Name() string { return "approval" }
+
+func (a *approvals) BeforeTool(ctx context.Context, call *providers.ToolCall) error {
+	switch a.policy.Mode(*call) {
+	case ApprovalAlways:
+		return nil
+	case ApprovalNever:
+		return fmt.Errorf("the approval policy does not allow %s", describeCall(*call))
+	}
+
+	run := tools.RunInfoFrom(ctx)
+	switch run.Channel {
+	case "", "cli", "heartbeat":
+		return fmt.Errorf("%s needs approval, but there is no chat to ask", describeCall(*call))
+	}
+
+	id := newApprovalID()
+	p := &pendingApproval{channel: run.Channel, chatID: run.ChatID, senderID: run.SenderID, decision: make(chan bool, 1)}
+	if p.senderID == cronSenderID {
+		// no one sent a scheduled reminder; anyone in the chat may answer for it
+		p.senderID = ""
+	}
+	a.mu.Lock()
+	a.pending[id] = p
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, id)
+		a.mu.Unlock()
+	}()
+
+	a.send(run.Channel, run.ChatID, fmt.Sprintf("⚠️ Approval needed: %s\n\nReply /approve %s or /deny %s within %s.", describeCall(*call), id, id, a.policy.Timeout),
+		chat.Button{Text: "✅ Approve", Data: "/approve " + id},
+		chat.Button{Text: "❌ Deny", Data: "/deny " + id},
+	)
+	log.Printf("tool call %s waiting for approval %s in %s:%s", call.Name, id, run.Channel, run.ChatID)
+
+	// other chats may use the worker slot while this one waits on a person
+	reacquire := releaseSlot(ctx)
+	defer reacquire()
+	timer := time.NewTimer(a.policy.Timeout)
+	defer timer.Stop()
+	select {
+	case ok := <-p.decision:
+		if !ok {
+			return errors.New("the user denied this call")
+		}
+		return nil
+	case <-timer.C:
+		a.send(run.Channel, run.ChatID, fmt.Sprintf("Approval %s timed out; the call was not run.", id))
+		return fmt.Errorf("no approval within %s; the call was not run", a.policy.Timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// command returns the handler of /approve (approve true) or /deny. The id may be left out
+// when the sender has a single pending approval in the chat; only the person whose message
+// started the run, in the chat that was asked, can answer.
+func (a *approvals) command(approve bool) func(context.Context, CommandCall) string {
+	return func(ctx context.Context, call CommandCall) string {
+		return a.resolve(call.Msg, approve, call.Args)
+	}
+}
+
+// resolve answers pending approval id of msg's chat and returns the reply.
+func (a *approvals) resolve(msg chat.Inbound, approve bool, id string) string {
+	a.mu.Lock()
+	var p *pendingApproval
+	theirs := 0        // pending approvals of this chat msg's sender may answer
+	notTheirs := false // a matching approval belongs to someone else
+	for qid, q := range a.pending {
+		if q.channel != msg.Channel || q.chatID != msg.ChatID || (qid != id && id != "") {
+			continue
+		}
+		if q.senderID != "" && q.senderID != msg.SenderID {
+			notTheirs = true
+			continue
+		}
+		theirs++
+		p = q
+	}
+	a.mu.Unlock()
+
+	switch {
+	case theirs > 1:
+		return "Which one? Reply with the id from the approval request."
+	case p == nil && notTheirs:
+		return "Only the person who asked for this can answer it."
+	case p == nil && id == "":
+		return "There is nothing waiting for approval here."
+	case p == nil:
+		return fmt.Sprintf("There is no pending approval %s here.", id)
+	}
+	select {
+	case p.decision <- approve:
+		if approve {
+			return "Approved."
+		}
+		return "Denied."
+	default:
+		return "" // already answered
+	}
+}
+
+func (a *approvals) send(channel, chatID, content string, buttons ...chat.Button) {
+	select {
+	case a.hub.Out <- chat.Outbound{Channel: channel, ChatID: chatID, Content: content, Buttons: buttons}:
+	default:
+		log.Println("Outbound channel full, dropping message")
+	}
+}
+
+// describeCall renders call as "name {arguments}" for an approval request.
+func describeCall(call providers.ToolCall) string {
+	b, _ := json.Marshal(call.Arguments)
+	args := string(b)
+	if len(args) > approvalArgsLen {
+		cut := approvalArgsLen
+		for cut > 0 && !utf8.RuneStart(args[cut]) {
+			cut--
+		}
+		args = args[:cut] + "..."
+	}
+	return call.Name + " " + args
+}
+
+// newApprovalID returns a short random id for an approval request.
+func newApprovalID() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
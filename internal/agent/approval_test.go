@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestApprovalPolicyMode(t *testing.T) {
+	p := ApprovalPolicy{Rules: map[string]string{"exec": "ask", "filesystem:write": "ask", "filesystem": "always", "web": "never", "cron": "maybe"}}
+	cases := []struct {
+		call providers.ToolCall
+		want string
+	}{
+		{providers.ToolCall{Name: "exec"}, ApprovalAsk},
+		{providers.ToolCall{Name: "filesystem", Arguments: map[string]interface{}{"action": "write"}}, ApprovalAsk},
+		{providers.ToolCall{Name: "filesystem", Arguments: map[string]interface{}{"action": "read"}}, ApprovalAlways},
+		{providers.ToolCall{Name: "web"}, ApprovalNever},
+		{providers.ToolCall{Name: "cron"}, ApprovalAsk}, // unknown mode: ask
+		{providers.ToolCall{Name: "message"}, ApprovalAlways},
+	}
+	for _, c := range cases {
+		if got := p.Mode(c.call); got != c.want {
+			t.Errorf("Mode(%s %v) = %q, want %q", c.call.Name, c.call.Arguments, got, c.want)
+		}
+	}
+}
+
+// approvalProvider calls the upper tool for "shout", reports the tool result, and otherwise says hi.
+type approvalProvider struct{}
+
+func (approvalProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	last := messages[len(messages)-1]
+	content, _ := last.Content.(string)
+	switch {
+	case last.Role == "tool":
+		return providers.LLMResponse{Content: "result: " + content}, nil
+	case content == "shout":
+		return providers.LLMResponse{
+			HasToolCalls: true,
+			ToolCalls:    []providers.ToolCall{{ID: "1", Name: "upper", Arguments: map[string]interface{}{"text": "hi"}}},
+		}, nil
+	}
+	return providers.LLMResponse{Content: "hi"}, nil
+}
+func (approvalProvider) GetDefaultModel() string { return "approval" }
+
+// nextOut returns the next outbound message, failing the test after a second.
+func nextOut(t *testing.T, b *chat.Hub) chat.Outbound {
+	t.Helper()
+	select {
+	case out := <-b.Out:
+		return out
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for an outbound message")
+	}
+	return chat.Outbound{}
+}
+
+func startApprovalLoop(t *testing.T, policy ApprovalPolicy) *chat.Hub {
+	t.Helper()
+	b := chat.NewHub(20)
+	ag := NewAgentLoop(b, approvalProvider{}, "approval", 3, t.TempDir(), nil)
+	ag.tools.Register(upperTool{})
+	ag.SetMaxConcurrentChats(1)
+	ag.SetApprovalPolicy(policy)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { ag.Run(ctx); close(done) }()
+	t.Cleanup(func() { cancel(); <-done })
+	return b
+}
+
+func TestApprovalAskWaitsForTheChatWithoutBlockingOthers(t *testing.T) {
+	b := startApprovalLoop(t, ApprovalPolicy{Rules: map[string]string{"upper": ApprovalAsk}})
+
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: "alice", Content: "shout"}
+	req := nextOut(t, b)
+	if req.ChatID != "a" || !strings.Contains(req.Content, "Approval needed: upper") || len(req.Buttons) != 2 {
+		t.Fatalf("unexpected approval request %+v", req)
+	}
+	approve := req.Buttons[0].Data
+
+	// with a single worker, another chat still gets through while "a" waits
+	b.In <- chat.Inbound{Channel: "test", ChatID: "b", Content: "hello"}
+	if out := nextOut(t, b); out.ChatID != "b" || out.Content != "hi" {
+		t.Fatalf("expected chat b to be answered, got %+v", out)
+	}
+
+	// an answer from another chat does not count
+	b.In <- chat.Inbound{Channel: "test", ChatID: "b", Content: approve}
+	if out := nextOut(t, b); out.ChatID != "b" || !strings.Contains(out.Content, "no pending approval") {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+
+	// nor does one from someone else in the chat
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: "mallory", Content: approve}
+	if out := nextOut(t, b); out.ChatID != "a" || !strings.Contains(out.Content, "Only the person who asked") {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: "alice", Content: approve}
+	if out := nextOut(t, b); out.Content != "Approved." {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+	if out := nextOut(t, b); out.ChatID != "a" || out.Content != "result: HI" {
+		t.Fatalf("expected the approved call to run, got %+v", out)
+	}
+}
+
+func TestApprovalDenyAndTimeout(t *testing.T) {
+	b := startApprovalLoop(t, ApprovalPolicy{Rules: map[string]string{"upper": ApprovalAsk}, Timeout: 100 * time.Millisecond})
+
+	// anyone in the chat answers for a cron job
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: cronSenderID, Content: "shout"}
+	nextOut(t, b)
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: "bob", Content: "/deny"}
+	if out := nextOut(t, b); out.Content != "Denied." {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+	if out := nextOut(t, b); out.Content != "result: (tool error) the user denied this call" {
+		t.Fatalf("expected the call to be denied, got %+v", out)
+	}
+
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", Content: "shout"}
+	nextOut(t, b)
+	if out := nextOut(t, b); !strings.Contains(out.Content, "timed out") {
+		t.Fatalf("expected a timeout notice, got %+v", out)
+	}
+	if out := nextOut(t, b); !strings.HasPrefix(out.Content, "result: (tool error) no approval within") {
+		t.Fatalf("expected the call to be denied after the timeout, got %+v", out)
+	}
+}
+
+func TestApprovalNeverAndNoChat(t *testing.T) {
+	ag := NewAgentLoop(chat.NewHub(10), approvalProvider{}, "approval", 3, t.TempDir(), nil)
+	ag.tools.Register(upperTool{})
+	ag.SetApprovalPolicy(ApprovalPolicy{Rules: map[string]string{"upper": ApprovalAsk}})
+	got, err := ag.ProcessDirect("shout", time.Second)
+	if err != nil || !strings.Contains(got, "needs approval, but there is no chat to ask") {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	ag.SetApprovalPolicy(ApprovalPolicy{Rules: map[string]string{"upper": ApprovalNever}})
+	if len(ag.runner.Hooks) != 1 {
+		t.Fatalf("setting a new policy should replace the old one, have %d hooks", len(ag.runner.Hooks))
+	}
+	got, err = ag.ProcessDirect("shout", time.Second)
+	if err != nil || !strings.Contains(got, "the approval policy does not allow upper") {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+func TestDescribeCallCutsOnARuneBoundary(t *testing.T) {
+	got := describeCall(providers.ToolCall{Name: "write", Arguments: map[string]interface{}{"text": strings.Repeat("é", approvalArgsLen)}})
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, "...") {
+		t.Fatalf("expected a valid cut with an ellipsis, got %q", got)
+	}
+	if len(got) > len("write ")+approvalArgsLen+len("...") {
+		t.Fatalf("expected at most %d bytes of arguments, got %d", approvalArgsLen, len(got))
+	}
+}
@@ -0,0 +1,334 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/session"
+	"github.com/local/picobot/internal/usage"
+)
+
+// Command is a slash command such as "/reset". Commands are answered by the agent loop, not
+// the model, unless they have a Prompt.
+type Command struct {
+	Name        string // without the slash; lower case letters, digits and underscores
+	Description string // one line, shown by /help and in the chat apps' command menus
+	Args        string // what the argument is, e.g. "<name>"; empty if it takes none
+
+	// Handle answers the command. The reply is sent to the chat but not kept in the history;
+	// an empty reply sends nothing.
+	Handle func(ctx context.Context, call CommandCall) string
+	// Prompt, used when Handle is nil, turns the command into a message for the model.
+	// "{{args}}" is replaced by the argument, which is appended if there is no placeholder.
+	Prompt string
+	// Immediate commands are handled as soon as they arrive instead of waiting for the
+	// chat's current run to finish; they get no Session.
+	Immediate bool
+}
+
+// CommandCall is one use of a command.
+type CommandCall struct {
+	Msg     chat.Inbound
+	Args    string           // the text after the command name, trimmed
+	Session *session.Session // the chat's session; changes to it are saved
+}
+
+// commandRE matches "/name [args]". Telegram adds "@botname" to commands sent in groups.
+var commandRE = regexp.MustCompile(`(?s)^/([A-Za-z0-9_]+)(?:@\S+)?(?:\s+(.*))?$`)
+
+// commandMemoryLen caps each memory section shown by /memory.
+const commandMemoryLen = 1500
+
+// commandUsageDays is how far back /usage looks.
+const commandUsageDays = 30
+
+// RegisterCommand adds c, replacing any command with the same name. Register commands
+// before Run starts.
+func (a *AgentLoop) RegisterCommand(c Command) {
+	c.Name = strings.ToLower(strings.TrimPrefix(c.Name, "/"))
+	if _, ok := a.commands[c.Name]; !ok {
+		a.commandOrder = append(a.commandOrder, c.Name)
+	}
+	a.commands[c.Name] = c
+}
+
+// Commands returns the registered commands, in registration order, followed by the commands
+// declared by skills.
+func (a *AgentLoop) Commands() []Command {
+	return a.commandsFor(nil)
+}
+
+// commandsFor returns the commands of profile p; nil means those of all profiles.
+func (a *AgentLoop) commandsFor(p *profile) []Command {
+	cmds := make([]Command, 0, len(a.commandOrder))
+	for _, name := range a.commandOrder {
+		cmds = append(cmds, a.commands[name])
+	}
+	return append(cmds, a.skillCommands(p)...)
+}
+
+// skillCommands returns a command for each skill of profile p (nil: any profile) whose
+// frontmatter has a "command" field. Skills can be added while the gateway runs, so they
+// are listed on every use.
+func (a *AgentLoop) skillCommands(p *profile) []Command {
+	skills, err := a.skills.ListSkills()
+	if err != nil {
+		log.Printf("error listing skills: %v", err)
+		return nil
+	}
+	var cmds []Command
+	for _, s := range skills {
+		name := strings.ToLower(strings.TrimPrefix(s.Command, "/"))
+		if name == "" || a.commands[name].Name != "" || (p != nil && !p.skillAllowed(s.Name)) {
+			continue
+		}
+		cmds = append(cmds, Command{Name: name, Description: s.Description, Prompt: fmt.Sprintf("Use the %q skill. {{args}}", s.Name)})
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
+
+// command returns the command content invokes in a chat of profile p, and its argument.
+func (a *AgentLoop) command(content string, p *profile) (Command, string, bool) {
+	m := commandRE.FindStringSubmatch(strings.TrimSpace(content))
+	if m == nil {
+		return Command{}, "", false
+	}
+	name, args := strings.ToLower(m[1]), strings.TrimSpace(m[2])
+	if c, ok := a.commands[name]; ok {
+		return c, args, true
+	}
+	for _, c := range a.skillCommands(p) {
+		if c.Name == name {
+			return c, args, true
+		}
+	}
+	return Command{}, "", false
+}
+
+// immediateCommand handles msg if it is an immediate command, and reports whether it was.
+func (a *AgentLoop) immediateCommand(ctx context.Context, msg chat.Inbound) bool {
+	c, args, ok := a.command(msg.Content, nil)
+	if !ok || !c.Immediate {
+		return false
+	}
+	a.send(msg.Channel, msg.ChatID, c.Handle(ctx, CommandCall{Msg: msg, Args: args}))
+	return true
+}
+
+// expandPrompt returns the message a prompt command sends to the model.
+func expandPrompt(prompt, args string) string {
+	if strings.Contains(prompt, "{{args}}") {
+		return strings.TrimSpace(strings.ReplaceAll(prompt, "{{args}}", args))
+	}
+	return strings.TrimSpace(prompt + " " + args)
+}
+
+// send delivers a reply that is not part of a run. Empty content sends nothing.
+func (a *AgentLoop) send(channel, chatID, content string) {
+	if content == "" {
+		return
+	}
+	select {
+	case a.hub.Out <- chat.Outbound{Channel: channel, ChatID: chatID, Content: content}:
+	default:
+		log.Println("Outbound channel full, dropping message")
+	}
+}
+
+// registerBuiltinCommands adds the commands every chat has.
+func (a *AgentLoop) registerBuiltinCommands() {
+	a.RegisterCommand(Command{Name: "help", Description: "List the commands", Handle: a.helpCommand})
+	a.RegisterCommand(Command{Name: "reset", Description: "Forget this conversation", Handle: resetCommand})
+	a.RegisterCommand(Command{Name: "model", Description: "Show or change the model for this chat", Args: "<name|default>", Handle: a.modelCommand})
+	a.RegisterCommand(Command{Name: "thinking", Description: "Show or hide the model's thinking", Args: "<on|off>", Handle: func(ctx context.Context, call CommandCall) string {
+		return thinkingCommand(call.Args, &call.Session.ShowThinking)
+	}})
+	a.RegisterCommand(Command{Name: "memory", Description: "Show today's notes and long-term memory", Handle: a.memoryCommand})
+	a.RegisterCommand(Command{Name: "jobs", Description: "List scheduled reminders and jobs", Handle: a.jobsCommand})
+	a.RegisterCommand(Command{Name: "skills", Description: "List the installed skills", Handle: a.skillsCommand})
+	a.RegisterCommand(Command{Name: "usage", Description: "Show this chat's token usage", Handle: a.usageCommand})
+	a.RegisterCommand(Command{Name: "stop", Description: "Stop the current reply", Immediate: true, Handle: a.stopCommand})
+}
+
+func (a *AgentLoop) helpCommand(ctx context.Context, call CommandCall) string {
+	var b strings.Builder
+	b.WriteString("Commands:")
+	for _, c := range a.commandsFor(a.profileFor(call.Msg.Channel, call.Msg.ChatID, call.Msg.SenderID)) {
+		b.WriteString("\n/" + c.Name)
+		if c.Args != "" {
+			b.WriteString(" " + c.Args)
+		}
+		if c.Description != "" {
+			b.WriteString(" - " + c.Description)
+		}
+	}
+	return b.String()
+}
+
+func resetCommand(ctx context.Context, call CommandCall) string {
+	call.Session.Reset()
+	return "Done, I've forgotten this conversation. Memory notes are kept."
+}
+
+func (a *AgentLoop) modelCommand(ctx context.Context, call CommandCall) string {
+	model := a.modelFor(a.profileFor(call.Msg.Channel, call.Msg.ChatID, call.Msg.SenderID))
+	switch strings.ToLower(call.Args) {
+	case "":
+		if call.Session.Model != "" {
+			return fmt.Sprintf("This chat uses %s (the default is %s). Send /model default to switch back.", call.Session.Model, model)
+		}
+		return fmt.Sprintf("This chat uses the default model, %s. Send /model <name> to change it.", model)
+	case "default", "reset":
+		call.Session.Model = ""
+		return fmt.Sprintf("This chat is back on the default model, %s.", model)
+	}
+	if err := a.checkModel(call.Args); err != nil {
+		return fmt.Sprintf("I can't switch to %s: %v.", call.Args, err)
+	}
+	call.Session.Model = call.Args
+	return fmt.Sprintf("This chat now uses %s.", call.Args)
+}
+
+// checkModel returns why /model may not switch a chat to model, or nil if it may.
+func (a *AgentLoop) checkModel(model string) error {
+	configured := append([]string{a.model, a.routes.Compaction, a.routes.Subagent}, a.modelChoice.Allowed...)
+	for _, p := range a.profiles {
+		configured = append(configured, p.Model)
+	}
+	for _, m := range configured {
+		if m != "" && strings.EqualFold(m, model) {
+			return nil
+		}
+	}
+	if len(a.modelChoice.Allowed) > 0 {
+		return fmt.Errorf("it is not one of the allowed models (%s)", strings.Join(a.modelChoice.Allowed, ", "))
+	}
+	name := model
+	if prefix, rest, ok := strings.Cut(model, "/"); ok {
+		known := false
+		for _, p := range a.modelChoice.Providers {
+			known = known || p == prefix
+		}
+		if !known {
+			return fmt.Errorf("there is no provider called %q", prefix)
+		}
+		name = rest
+	}
+	if !a.runner.Models.Known(name) {
+		return fmt.Errorf("it is not a model I know; it can be added under \"models\" or \"allowedModels\" in the config")
+	}
+	return nil
+}
+
+func (a *AgentLoop) memoryCommand(ctx context.Context, call CommandCall) string {
+	mem := a.profileFor(call.Msg.Channel, call.Msg.ChatID, call.Msg.SenderID).memory
+	today, err := mem.ReadToday()
+	if err != nil {
+		log.Printf("error reading today's memory: %v", err)
+	}
+	long, err := mem.ReadLongTerm()
+	if err != nil {
+		log.Printf("error reading long-term memory: %v", err)
+	}
+	section := func(title, text string) string {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return title + ":\n(empty)"
+		}
+		if r := []rune(text); len(r) > commandMemoryLen {
+			text = "…" + string(r[len(r)-commandMemoryLen:])
+		}
+		return title + ":\n" + text
+	}
+	return section("Today", today) + "\n\n" + section("Long-term", long)
+}
+
+func (a *AgentLoop) jobsCommand(ctx context.Context, call CommandCall) string {
+	if a.scheduler == nil {
+		return "Scheduling is not available here."
+	}
+	var jobs []string
+	for _, j := range a.scheduler.List() {
+		if j.Channel != call.Msg.Channel || j.ChatID != call.Msg.ChatID {
+			continue
+		}
+		line := fmt.Sprintf("- %s (%s): %s, next %s", j.Name, j.ID, j.Message, j.FireAt.Local().Format("Jan 2 15:04"))
+		if j.Recurring {
+			line += ", every " + j.Interval.String()
+		}
+		jobs = append(jobs, line)
+	}
+	if len(jobs) == 0 {
+		return "No jobs are scheduled for this chat."
+	}
+	sort.Strings(jobs)
+	return "Scheduled jobs:\n" + strings.Join(jobs, "\n")
+}
+
+func (a *AgentLoop) skillsCommand(ctx context.Context, call CommandCall) string {
+	skills, err := a.skills.ListSkills()
+	if err != nil {
+		log.Printf("error listing skills: %v", err)
+		return "Sorry, I couldn't list the skills."
+	}
+	p := a.profileFor(call.Msg.Channel, call.Msg.ChatID, call.Msg.SenderID)
+	var b strings.Builder
+	b.WriteString("Skills:")
+	for _, s := range skills {
+		if !p.skillAllowed(s.Name) {
+			continue
+		}
+		fmt.Fprintf(&b, "\n- %s: %s", s.Name, s.Description)
+		if s.Command != "" {
+			fmt.Fprintf(&b, " (/%s)", strings.TrimPrefix(s.Command, "/"))
+		}
+	}
+	if b.Len() == len("Skills:") {
+		return "No skills are installed."
+	}
+	return b.String()
+}
+
+func (a *AgentLoop) usageCommand(ctx context.Context, call CommandCall) string {
+	records, err := usage.NewRecorder(a.workspace).Records(time.Now().AddDate(0, 0, -commandUsageDays))
+	if err != nil {
+		log.Printf("error reading usage: %v", err)
+		return "Sorry, I couldn't read the usage records."
+	}
+	key := call.Msg.Channel + ":" + call.Msg.ChatID
+	var today, total usage.Row
+	y, m, d := time.Now().Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	add := func(r *usage.Row, rec usage.Record) {
+		r.Calls++
+		r.PromptTokens += rec.PromptTokens
+		r.CompletionTokens += rec.CompletionTokens
+	}
+	for _, rec := range records {
+		if rec.SessionKey != key {
+			continue
+		}
+		add(&total, rec)
+		if !rec.Time.Before(midnight) {
+			add(&today, rec)
+		}
+	}
+	if total.Calls == 0 {
+		return fmt.Sprintf("No model calls from this chat in the last %d days.", commandUsageDays)
+	}
+	line := func(title string, r usage.Row) string {
+		calls := "calls"
+		if r.Calls == 1 {
+			calls = "call"
+		}
+		return fmt.Sprintf("%s: %d prompt + %d completion tokens in %d model %s", title, r.PromptTokens, r.CompletionTokens, r.Calls, calls)
+	}
+	return line("Today", today) + "\n" + line(fmt.Sprintf("Last %d days", commandUsageDays), total)
+}
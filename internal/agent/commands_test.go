@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/cron"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/usage"
+)
+
+// inputRecordingProvider records the model and the last message of each call.
+type inputRecordingProvider struct {
+	mu     sync.Mutex
+	models []string
+	inputs []string
+}
+
+func (p *inputRecordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.models = append(p.models, model)
+	p.inputs = append(p.inputs, providers.ContentToString(messages[len(messages)-1].Content))
+	return providers.LLMResponse{Content: "ok"}, nil
+}
+func (p *inputRecordingProvider) GetDefaultModel() string { return "main-model" }
+
+func (p *inputRecordingProvider) last() (model, input string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.models) == 0 {
+		return "", ""
+	}
+	return p.models[len(p.models)-1], p.inputs[len(p.inputs)-1]
+}
+
+func startCommandLoop(t *testing.T, ag *AgentLoop) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { ag.Run(ctx); close(done) }()
+	t.Cleanup(func() { cancel(); <-done })
+}
+
+func TestCheckModel(t *testing.T) {
+	ag := NewAgentLoop(chat.NewHub(10), &inputRecordingProvider{}, "openrouter/google/gemini-2.5-flash", 5, t.TempDir(), nil)
+	ag.SetModelRegistry(providers.NewModelRegistry(map[string]config.ModelConfig{"my-finetune": {}}))
+	ag.SetModelChoice(ModelChoice{Providers: []string{"ollama", "openrouter"}})
+	for model, ok := range map[string]bool{
+		"openrouter/google/gemini-2.5-flash": true, // the default
+		"gpt-4o":                             true,
+		"ollama/llama3.2":                    true,
+		"ollama/my-finetune":                 true, // under "models"
+		"ollama/whatever":                    false,
+		"ollma/llama3.2":                     false, // no such provider
+		"google/gemini-2.5-flash":            false,
+	} {
+		if err := ag.checkModel(model); (err == nil) != ok {
+			t.Errorf("checkModel(%q) = %v, want ok %v", model, err, ok)
+		}
+	}
+}
+
+func TestBuiltinCommands(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &inputRecordingProvider{}
+	ag := NewAgentLoop(b, p, "main-model", 5, t.TempDir(), nil)
+	ag.SetModelChoice(ModelChoice{Allowed: []string{"cheap-model"}})
+	startCommandLoop(t, ag)
+	send := func(content string) string {
+		t.Helper()
+		b.In <- chat.Inbound{Channel: "test", ChatID: "a", Content: content}
+		return nextOut(t, b).Content
+	}
+
+	send("hello")
+	if reply := send("/model pricey-model"); !strings.Contains(reply, "can't switch") {
+		t.Fatalf("expected a model off the list to be refused, got %q", reply)
+	}
+	if reply := send("/model cheap-model"); !strings.Contains(reply, "now uses cheap-model") {
+		t.Fatalf("unexpected /model reply %q", reply)
+	}
+	send("hello again")
+	if model, _ := p.last(); model != "cheap-model" {
+		t.Fatalf("expected the chat's model override to be used, got %q", model)
+	}
+	if reply := send("/Model"); !strings.Contains(reply, "cheap-model") || !strings.Contains(reply, "main-model") {
+		t.Fatalf("unexpected /model reply %q", reply)
+	}
+	send("/model default")
+	send("and again")
+	if model, _ := p.last(); model != "main-model" {
+		t.Fatalf("expected the default model after /model default, got %q", model)
+	}
+
+	if h := ag.sessions.GetOrCreate("test:a").GetHistory(); len(h) != 6 {
+		t.Fatalf("commands must not be kept in history, got %q", h)
+	}
+	send("/reset")
+	if h := ag.sessions.GetOrCreate("test:a").GetHistory(); len(h) != 0 {
+		t.Fatalf("expected /reset to clear the history, got %q", h)
+	}
+	if n := len(p.models); n != 3 {
+		t.Fatalf("commands must be answered without the model, got %d calls", n)
+	}
+
+	help := send("/help")
+	for _, want := range []string{"/reset", "/model <name|default>", "/stop", "/usage"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("/help does not mention %q:\n%s", want, help)
+		}
+	}
+	if !strings.Contains(send("/memory"), "Long-term:\n(empty)") {
+		t.Error("expected /memory to show the empty long-term memory")
+	}
+	if reply := send("/skills"); reply != "No skills are installed." {
+		t.Errorf("unexpected /skills reply %q", reply)
+	}
+}
+
+func TestPromptAndSkillCommands(t *testing.T) {
+	workspace := t.TempDir()
+	skill := "---\nname: weather\ndescription: Look up the weather\ncommand: forecast\n---\n\nUse the web tool.\n"
+	if err := os.MkdirAll(filepath.Join(workspace, "skills", "weather"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "skills", "weather", "SKILL.md"), []byte(skill), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := chat.NewHub(10)
+	p := &inputRecordingProvider{}
+	ag := NewAgentLoop(b, p, "main-model", 5, workspace, nil)
+	ag.RegisterCommand(Command{Name: "standup", Description: "Draft my standup", Prompt: "Draft my standup about {{args}}."})
+	startCommandLoop(t, ag)
+	send := func(content string) string {
+		t.Helper()
+		b.In <- chat.Inbound{Channel: "test", ChatID: "a", Content: content}
+		return nextOut(t, b).Content
+	}
+
+	send("/standup@picobot the release")
+	if _, input := p.last(); input != "Draft my standup about the release." {
+		t.Fatalf("unexpected prompt %q", input)
+	}
+	send("/forecast Oslo")
+	if _, input := p.last(); input != `Use the "weather" skill. Oslo` {
+		t.Fatalf("unexpected skill prompt %q", input)
+	}
+	help := send("/help")
+	if !strings.Contains(help, "/standup - Draft my standup") || !strings.Contains(help, "/forecast - Look up the weather") {
+		t.Fatalf("expected /help to list the prompt and skill commands:\n%s", help)
+	}
+	send("/unknown thing")
+	if _, input := p.last(); input != "/unknown thing" {
+		t.Fatalf("unknown commands must reach the model, got %q", input)
+	}
+}
+
+func TestJobsAndUsageCommands(t *testing.T) {
+	workspace := t.TempDir()
+	scheduler := cron.NewScheduler(func(cron.Job) {})
+	scheduler.Add("water", "water the plants", time.Hour, "test", "a")
+	scheduler.Add("other", "someone else's", time.Hour, "test", "b")
+	rec := usage.NewRecorder(workspace)
+	_ = rec.Add(usage.Record{Time: time.Now(), SessionKey: "test:a", Model: "m", PromptTokens: 100, CompletionTokens: 20})
+	_ = rec.Add(usage.Record{Time: time.Now(), SessionKey: "test:b", Model: "m", PromptTokens: 999, CompletionTokens: 999})
+
+	b := chat.NewHub(10)
+	ag := NewAgentLoop(b, &inputRecordingProvider{}, "main-model", 5, workspace, scheduler)
+	startCommandLoop(t, ag)
+	send := func(content string) string {
+		t.Helper()
+		b.In <- chat.Inbound{Channel: "test", ChatID: "a", Content: content}
+		return nextOut(t, b).Content
+	}
+
+	if jobs := send("/jobs"); !strings.Contains(jobs, "water the plants") || strings.Contains(jobs, "someone else's") {
+		t.Fatalf("expected only this chat's jobs, got %q", jobs)
+	}
+	if got, want := send("/usage"), "Today: 100 prompt + 20 completion tokens in 1 model call"; !strings.HasPrefix(got, want) {
+		t.Fatalf("unexpected /usage reply %q", got)
+	}
+}
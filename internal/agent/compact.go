@@ -2,11 +2,14 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
 	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/usage"
 )
 
 const (
@@ -19,19 +22,66 @@ const (
 )
 
 const summarySystemPrompt = "You are a summarizer. Summarize the following conversation concisely. " +
-	"Preserve: key facts, decisions, TODOs, open questions, and constraints. Output only the summary, no preamble."
+	"Preserve: key facts, decisions, TODOs, open questions, and constraints. Reply with JSON only, no preamble."
+
+// compactionSummary is the structured reply to a summarization request.
+type compactionSummary struct {
+	Summary       string   `json:"summary" desc:"a concise summary of the conversation"`
+	Facts         []string `json:"facts,omitempty" desc:"key facts and constraints to remember"`
+	Decisions     []string `json:"decisions,omitempty"`
+	TODOs         []string `json:"todos,omitempty" desc:"open tasks"`
+	OpenQuestions []string `json:"openQuestions,omitempty"`
+}
+
+func (c *compactionSummary) Validate() error {
+	if strings.TrimSpace(c.Summary) == "" {
+		return fmt.Errorf("summary is empty")
+	}
+	return nil
+}
+
+// String renders the summary as the text kept in the history.
+func (c *compactionSummary) String() string {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSpace(c.Summary))
+	for _, sec := range []struct {
+		title string
+		items []string
+	}{{"Key facts", c.Facts}, {"Decisions", c.Decisions}, {"TODOs", c.TODOs}, {"Open questions", c.OpenQuestions}} {
+		if len(sec.items) == 0 {
+			continue
+		}
+		sb.WriteString("\n\n" + sec.title + ":")
+		for _, it := range sec.items {
+			sb.WriteString("\n- " + it)
+		}
+	}
+	return sb.String()
+}
 
 // CompactIfNeeded checks if messages exceed the threshold and, if so, summarizes
 // the older portion and returns compacted messages. On failure, returns the original
 // messages unchanged (best-effort).
-func CompactIfNeeded(ctx context.Context, messages []providers.Message, contextWindowTokens int, provider providers.LLMProvider, model string) ([]providers.Message, error) {
+func CompactIfNeeded(ctx context.Context, messages []providers.Message, contextWindowTokens int, provider providers.LLMProvider, model string, opts providers.GenerationOptions) ([]providers.Message, error) {
 	if contextWindowTokens <= 0 {
 		contextWindowTokens = DefaultContextWindowTokens
 	}
-	threshold := contextWindowTokens - ReserveTokens
+	// small local models can't spare ReserveTokens; keep a quarter of the window free instead
+	reserve := ReserveTokens
+	if reserve > contextWindowTokens/4 {
+		reserve = contextWindowTokens / 4
+	}
+	threshold := contextWindowTokens - reserve
 	if EstimateTokens(messages) <= threshold {
 		return messages, nil
 	}
+	return Compact(ctx, messages, provider, model, opts)
+}
+
+// Compact summarizes the older portion of messages regardless of their size, e.g. after
+// the provider rejected them with providers.ErrContextLength. Histories too short to
+// compact, and failed summarizations, return the original messages unchanged.
+func Compact(ctx context.Context, messages []providers.Message, provider providers.LLMProvider, model string, opts providers.GenerationOptions) ([]providers.Message, error) {
 	if len(messages) < MinMessagesToCompact {
 		return messages, nil
 	}
@@ -59,8 +109,9 @@ func CompactIfNeeded(ctx context.Context, messages []providers.Message, contextW
 	if keepCount < 2 {
 		return messages, nil
 	}
-	recent := conversation[len(conversation)-keepCount:]
-	toSummarize := conversation[:len(conversation)-keepCount]
+	cut := splitPoint(conversation, len(conversation)-keepCount)
+	recent := conversation[cut:]
+	toSummarize := conversation[:cut]
 	if len(toSummarize) < 4 {
 		return messages, nil
 	}
@@ -70,6 +121,13 @@ func CompactIfNeeded(ctx context.Context, messages []providers.Message, contextW
 	for _, m := range toSummarize {
 		role := m.Role
 		content := providers.ContentToString(m.Content)
+		for _, tc := range m.ToolCalls {
+			args, _ := json.Marshal(tc.Arguments)
+			if content != "" {
+				content += "\n"
+			}
+			content += fmt.Sprintf("[calls %s %s]", tc.Name, args)
+		}
 		if content == "" {
 			continue
 		}
@@ -87,15 +145,20 @@ func CompactIfNeeded(ctx context.Context, messages []providers.Message, contextW
 		{Role: "system", Content: summarySystemPrompt},
 		{Role: "user", Content: convText},
 	}
-	resp, err := provider.Chat(ctx, summaryMsgs, nil, model)
-	if err != nil {
+	var cs compactionSummary
+	resp, err := providers.ChatJSON(usage.WithPurpose(ctx, usage.PurposeCompaction), provider, summaryMsgs, model, opts, &cs)
+	var summary string
+	switch {
+	case err == nil:
+		summary = cs.String()
+	case errors.Is(err, providers.ErrInvalidStructuredOutput) && strings.TrimSpace(resp.Content) != "":
+		// the model ignored the format but still summarized; keep its text
+		log.Printf("compaction: %v; using the reply as plain text", err)
+		summary = strings.TrimSpace(resp.Content)
+	default:
 		log.Printf("compaction summarization failed: %v", err)
 		return messages, nil
 	}
-	summary := strings.TrimSpace(resp.Content)
-	if summary == "" {
-		summary = "No prior history."
-	}
 
 	// Rebuild: system prefix + summary + recent
 	result := make([]providers.Message, 0, len(systemPrefix)+2+len(recent))
@@ -107,3 +170,19 @@ func CompactIfNeeded(ctx context.Context, messages []providers.Message, contextW
 	result = append(result, recent...)
 	return result, nil
 }
+
+// splitPoint moves cut, the index of the first message kept after compaction, forward to the
+// next user message, as session trimming does, so that no kept tool result loses the
+// assistant message that called it; providers reject such histories. If no user message
+// follows, as in a long run of tool calls, it moves back to the start of the tool-call group.
+func splitPoint(conversation []providers.Message, cut int) int {
+	for i := cut; i < len(conversation); i++ {
+		if conversation[i].Role == "user" {
+			return i
+		}
+	}
+	for cut > 0 && conversation[cut].Role == "tool" {
+		cut--
+	}
+	return cut
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/local/picobot/internal/chat"
 	"github.com/local/picobot/internal/providers"
 )
 
@@ -27,7 +28,7 @@ func TestCompactIfNeeded_NoOpWhenUnderThreshold(t *testing.T) {
 		{Role: "assistant", Content: "hello"},
 	}
 	provider := providers.NewStubProvider()
-	got, err := CompactIfNeeded(ctx, msgs, 128_000, provider, "stub")
+	got, err := CompactIfNeeded(ctx, msgs, 128_000, provider, "stub", providers.GenerationOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -43,7 +44,7 @@ func TestCompactIfNeeded_NoOpWhenTooFewMessages(t *testing.T) {
 		msgs[i] = providers.Message{Role: "user", Content: "msg"}
 	}
 	provider := providers.NewStubProvider()
-	got, err := CompactIfNeeded(ctx, msgs, 100, provider, "stub")
+	got, err := CompactIfNeeded(ctx, msgs, 100, provider, "stub", providers.GenerationOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -51,3 +52,121 @@ func TestCompactIfNeeded_NoOpWhenTooFewMessages(t *testing.T) {
 		t.Errorf("expected no compaction (too few), got %d vs %d", len(got), len(msgs))
 	}
 }
+
+// contextLimitProvider rejects requests with more than limit messages as too long,
+// and answers everything else (including summarization) with a fixed reply.
+type contextLimitProvider struct {
+	limit int
+	calls int
+}
+
+func (p *contextLimitProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	p.calls++
+	if len(messages) > p.limit {
+		return providers.LLMResponse{}, &providers.APIError{Provider: "test", StatusCode: 400, Status: "400 Bad Request", Body: "maximum context length exceeded"}
+	}
+	if opts.ResponseFormat != nil {
+		return providers.LLMResponse{Content: `{"summary": "summary"}`}, nil
+	}
+	return providers.LLMResponse{Content: "summary"}, nil
+}
+
+func (p *contextLimitProvider) GetDefaultModel() string { return "limit" }
+
+func TestChatCompactsOnContextLengthError(t *testing.T) {
+	p := &contextLimitProvider{limit: 14}
+	ag := NewAgentLoop(chat.NewHub(10), p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+
+	msgs := []providers.Message{{Role: "system", Content: "You are helpful."}}
+	for i := 0; i < 30; i++ {
+		msgs = append(msgs, providers.Message{Role: "user", Content: "msg"})
+	}
+	resp, sent, err := ag.runner.chat(context.Background(), msgs, nil, "limit", providers.GenerationOptions{}, nil)
+	if err != nil {
+		t.Fatalf("expected retry after compaction to succeed, got %v", err)
+	}
+	if resp.Content != "summary" || len(sent) >= len(msgs) {
+		t.Fatalf("expected compacted history, sent %d of %d messages (content %q)", len(sent), len(msgs), resp.Content)
+	}
+	if p.calls != 3 { // rejected call, summarization, retry
+		t.Errorf("expected 3 provider calls, got %d", p.calls)
+	}
+}
+
+func TestCompactRendersStructuredSummary(t *testing.T) {
+	p, err := providers.NewScriptedProvider(providers.Script{Turns: []providers.ScriptTurn{
+		{Text: `{"summary": "Planned a trip.", "facts": ["Flying to Oslo on May 3"], "todos": ["Book a hotel"]}`, Repeat: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []providers.Message{{Role: "system", Content: "You are helpful."}}
+	for i := 0; i < 20; i++ {
+		msgs = append(msgs, providers.Message{Role: "user", Content: "msg"})
+	}
+	got, err := Compact(context.Background(), msgs, p, "", providers.GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Previous conversation summary:\n\nPlanned a trip.\n\nKey facts:\n- Flying to Oslo on May 3\n\nTODOs:\n- Book a hotel"
+	if len(got) < 2 || got[1].Content != want {
+		t.Fatalf("unexpected summary message %+v", got[1])
+	}
+}
+
+// summaryRecordingProvider records the conversation it is asked to summarize.
+type summaryRecordingProvider struct{ input string }
+
+func (p *summaryRecordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	p.input = providers.ContentToString(messages[len(messages)-1].Content)
+	return providers.LLMResponse{Content: `{"summary": "summary"}`}, nil
+}
+func (p *summaryRecordingProvider) GetDefaultModel() string { return "summary" }
+
+func TestCompactKeepsToolCallsWithTheirResults(t *testing.T) {
+	call := providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{
+		{ID: "1", Name: "upper", Arguments: map[string]interface{}{"text": "hi"}},
+		{ID: "2", Name: "upper", Arguments: map[string]interface{}{"text": "there"}},
+	}}
+	history := func(conversation ...providers.Message) []providers.Message {
+		return append([]providers.Message{{Role: "system", Content: "You are helpful."}}, conversation...)
+	}
+	chatter := func(n int) []providers.Message {
+		var msgs []providers.Message
+		for i := 0; i < n; i++ {
+			msgs = append(msgs, providers.Message{Role: "user", Content: "msg"}, providers.Message{Role: "assistant", Content: "ok"})
+		}
+		return msgs
+	}
+
+	// the last 12 messages start with the second result of the call; keep from the next user message
+	msgs := history(append(append(chatter(3), providers.Message{Role: "user", Content: "shout"}, call,
+		providers.Message{Role: "tool", ToolCallID: "1", Content: "HI"},
+		providers.Message{Role: "tool", ToolCallID: "2", Content: "THERE"},
+		providers.Message{Role: "assistant", Content: "done"}), chatter(5)...)...)
+	p := &summaryRecordingProvider{}
+	got, err := Compact(context.Background(), msgs, p, "", providers.GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 12 || got[2].Role != "user" {
+		t.Fatalf("expected the kept messages to start at a user message, got %d messages starting with %+v", len(got), got[2])
+	}
+	if !strings.Contains(p.input, `assistant: [calls upper {"text":"hi"}]`) || !strings.Contains(p.input, "tool: THERE") {
+		t.Fatalf("expected the tool calls in the summarized text, got %q", p.input)
+	}
+
+	// with no user message left, keep the whole tool-call group instead
+	msgs = history(append(chatter(4), providers.Message{Role: "user", Content: "shout"})...)
+	for i := 0; i < 4; i++ {
+		msgs = append(msgs, call, providers.Message{Role: "tool", ToolCallID: "1", Content: "HI"}, providers.Message{Role: "tool", ToolCallID: "2", Content: "THERE"})
+	}
+	msgs = append(msgs, providers.Message{Role: "assistant", Content: "done"})
+	got, err = Compact(context.Background(), msgs, p, "", providers.GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 15 || len(got[2].ToolCalls) != 2 {
+		t.Fatalf("expected the kept messages to start at a tool call, got %d messages starting with %+v", len(got), got[2])
+	}
+}
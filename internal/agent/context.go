@@ -18,6 +18,8 @@ type ContextBuilder struct {
 	ranker       memory.Ranker
 	topK         int
 	skillsLoader *skills.Loader
+	bootstrapDir string          // where SOUL.md etc. are read from; "" means the workspace
+	skills       map[string]bool // skills to include, by name; nil means all
 }
 
 func NewContextBuilder(workspace string, r memory.Ranker, topK int) *ContextBuilder {
@@ -29,30 +31,24 @@ func NewContextBuilder(workspace string, r memory.Ranker, topK int) *ContextBuil
 	}
 }
 
-// parseHistoryItem extracts role and content from a history item in "role: content" format.
-// Returns ("user", content) for "user: hello", ("assistant", content) for "assistant: hi", etc.
-// Defaults to "user" if the role is unrecognized.
-func parseHistoryItem(h string) (role, content string) {
-	const sep = ": "
-	idx := strings.Index(h, sep)
-	if idx < 0 {
-		return "user", h
-	}
-	role = strings.TrimSpace(strings.ToLower(h[:idx]))
-	content = strings.TrimSpace(h[idx+len(sep):])
-	switch role {
-	case "assistant":
-		return "assistant", content
-	case "system":
-		return "system", content
-	case "tool":
-		return "user", content
-	default:
-		return "user", content
+// forProfile returns a copy of cb that reads the bootstrap files from bootstrapDir ("" keeps
+// the workspace) and includes only the named skills (nil means all).
+func (cb *ContextBuilder) forProfile(bootstrapDir string, skillNames []string) *ContextBuilder {
+	c := *cb
+	c.bootstrapDir = bootstrapDir
+	c.skills = nil
+	if skillNames != nil {
+		c.skills = make(map[string]bool, len(skillNames))
+		for _, name := range skillNames {
+			c.skills[name] = true
+		}
 	}
+	return &c
 }
 
-func (cb *ContextBuilder) BuildMessages(history []string, currentMessage string, media []string, channel, chatID string, memoryContext string, memories []memory.MemoryItem) []providers.Message {
+// BuildMessages returns the system prompt, the session history as stored (tool calls and
+// results included) and the current message.
+func (cb *ContextBuilder) BuildMessages(history []providers.Message, currentMessage string, media []string, channel, chatID string, memoryContext string, memories []memory.MemoryItem) []providers.Message {
 	msgs := make([]providers.Message, 0, len(history)+8)
 	// system prompt
 	msgs = append(msgs, providers.Message{Role: "system", Content: "You are Picobot, a helpful assistant."})
@@ -60,8 +56,12 @@ func (cb *ContextBuilder) BuildMessages(history []string, currentMessage string,
 	// Load workspace bootstrap files (SOUL.md, AGENTS.md, USER.md, TOOLS.md)
 	// These define the agent's personality, instructions, and available tools documentation.
 	bootstrapFiles := []string{"SOUL.md", "AGENTS.md", "USER.md", "TOOLS.md"}
+	bootstrapDir := cb.bootstrapDir
+	if bootstrapDir == "" {
+		bootstrapDir = cb.workspace
+	}
 	for _, name := range bootstrapFiles {
-		p := filepath.Join(cb.workspace, name)
+		p := filepath.Join(bootstrapDir, name)
 		data, err := os.ReadFile(p)
 		if err != nil {
 			continue // file may not exist yet, skip silently
@@ -83,6 +83,15 @@ func (cb *ContextBuilder) BuildMessages(history []string, currentMessage string,
 	if err != nil {
 		log.Printf("error loading skills: %v", err)
 	}
+	if cb.skills != nil {
+		kept := loadedSkills[:0]
+		for _, skill := range loadedSkills {
+			if cb.skills[skill.Name] {
+				kept = append(kept, skill)
+			}
+		}
+		loadedSkills = kept
+	}
 	if len(loadedSkills) > 0 {
 		var sb strings.Builder
 		sb.WriteString("Available Skills:\n")
@@ -112,13 +121,7 @@ func (cb *ContextBuilder) BuildMessages(history []string, currentMessage string,
 	}
 
 	// replay history
-	for _, h := range history {
-		if len(h) == 0 {
-			continue
-		}
-		role, content := parseHistoryItem(h)
-		msgs = append(msgs, providers.Message{Role: role, Content: content})
-	}
+	msgs = append(msgs, history...)
 
 	// current user message (with optional images for vision models)
 	userContent := buildUserContent(currentMessage, media)
@@ -145,3 +148,31 @@ func buildUserContent(text string, media []string) interface{} {
 	}
 	return parts
 }
+
+// withoutImages returns history with the images of multimodal messages replaced by a
+// note, for models that cannot read them. Text-only messages are kept as they are.
+func withoutImages(history []providers.Message) []providers.Message {
+	out := make([]providers.Message, len(history))
+	for i, m := range history {
+		if parts, ok := m.Content.([]interface{}); ok {
+			text, images := "", 0
+			for _, p := range parts {
+				part, _ := p.(map[string]interface{})
+				switch part["type"] {
+				case "text":
+					if t, _ := part["text"].(string); t != "" {
+						text = strings.TrimSpace(text + "\n" + t)
+					}
+				case "image_url":
+					images++
+				}
+			}
+			if images > 0 {
+				text += fmt.Sprintf("\n\n[%d image(s) not shown: the current model cannot read images]", images)
+			}
+			m.Content = strings.TrimSpace(text)
+		}
+		out[i] = m
+	}
+	return out
+}
@@ -8,65 +8,53 @@ import (
 	"github.com/local/picobot/internal/providers"
 )
 
-func TestParseHistoryItem(t *testing.T) {
-	tests := []struct {
-		in       string
-		wantRole string
-		wantCnt string
-	}{
-		{"user: hello", "user", "hello"},
-		{"assistant: hi there", "assistant", "hi there"},
-		{"user: ", "user", ""},
-		{"assistant: multi\nline\ncontent", "assistant", "multi\nline\ncontent"},
-		{"no-colon", "user", "no-colon"},
-		{"", "user", ""},
+func TestBuildMessagesReplaysHistory(t *testing.T) {
+	cb := NewContextBuilder(".", nil, 5)
+	call := providers.ToolCall{ID: "c1", Name: "web", Arguments: map[string]interface{}{"url": "https://example.com"}}
+	history := []providers.Message{
+		{Role: "user", Content: "what's on example.com?"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{call}},
+		{Role: "tool", Content: "Example Domain", ToolCallID: "c1"},
+		{Role: "assistant", Content: "It says Example Domain."},
 	}
-	for _, tt := range tests {
-		role, content := parseHistoryItem(tt.in)
-		if role != tt.wantRole || content != tt.wantCnt {
-			t.Errorf("parseHistoryItem(%q) = (%q, %q), want (%q, %q)", tt.in, role, content, tt.wantRole, tt.wantCnt)
+	msgs := cb.BuildMessages(history, "thanks", nil, "discord", "123", "", nil)
+
+	// the history follows the system messages unchanged, then the current message
+	got := msgs[len(msgs)-len(history)-1 : len(msgs)-1]
+	for i, m := range got {
+		if m.Role != history[i].Role || m.ToolCallID != history[i].ToolCallID || len(m.ToolCalls) != len(history[i].ToolCalls) ||
+			providers.ContentToString(m.Content) != providers.ContentToString(history[i].Content) {
+			t.Errorf("message %d = %+v, want %+v", i, m, history[i])
 		}
 	}
+	if got[1].ToolCalls[0].Name != "web" {
+		t.Errorf("expected the tool call to be replayed, got %+v", got[1])
+	}
+	if last := msgs[len(msgs)-1]; last.Role != "user" || last.Content != "thanks" {
+		t.Errorf("expected the current message last, got %+v", last)
+	}
 }
 
-func TestBuildMessagesParsesHistoryRoles(t *testing.T) {
-	cb := NewContextBuilder(".", nil, 5)
-	history := []string{
-		"user: what is 2+2?",
-		"assistant: 2+2 equals 4",
-		"user: thanks",
+func TestWithoutImages(t *testing.T) {
+	history := []providers.Message{
+		{Role: "user", Content: buildUserContent("look", []string{"https://example.com/a.png"})},
+		{Role: "assistant", Content: "A cat."},
 	}
-	msgs := cb.BuildMessages(history, "bye", nil, "discord", "123", "", nil)
-
-	// Find the history messages (after system block, before current user)
-	var historyMsgs []providers.Message
-	for i, m := range msgs {
-		c := providers.ContentToString(m.Content)
-		if c == "what is 2+2?" {
-			if m.Role != "user" {
-				t.Errorf("message %d: expected role user, got %s", i, m.Role)
-			}
-			historyMsgs = append(historyMsgs, m)
-		} else if c == "2+2 equals 4" {
-			if m.Role != "assistant" {
-				t.Errorf("message %d: expected role assistant, got %s", i, m.Role)
-			}
-			historyMsgs = append(historyMsgs, m)
-		} else if c == "thanks" {
-			if m.Role != "user" {
-				t.Errorf("message %d: expected role user, got %s", i, m.Role)
-			}
-			historyMsgs = append(historyMsgs, m)
-		}
+	got := withoutImages(history)
+	if c, ok := got[0].Content.(string); !ok || !strings.HasPrefix(c, "look") || !strings.Contains(c, "1 image(s) not shown") {
+		t.Fatalf("unexpected content %#v", got[0].Content)
+	}
+	if got[1].Content != "A cat." {
+		t.Fatalf("text messages must be kept, got %#v", got[1].Content)
 	}
-	if len(historyMsgs) != 3 {
-		t.Errorf("expected 3 history messages with correct roles, got %d", len(historyMsgs))
+	if _, ok := history[0].Content.([]interface{}); !ok {
+		t.Fatal("the history passed in must not be modified")
 	}
 }
 
 func TestBuildMessagesIncludesMemories(t *testing.T) {
 	cb := NewContextBuilder(".", memory.NewSimpleRanker(), 5)
-	history := []string{"user: hi"}
+	history := []providers.Message{{Role: "user", Content: "hi"}}
 	mems := []memory.MemoryItem{{Kind: "short", Text: "remember this"}, {Kind: "long", Text: "big fact"}}
 	memCtx := "Long-term memory: important fact"
 	msgs := cb.BuildMessages(history, "hello", nil, "telegram", "123", memCtx, mems)
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// dispatcher gives each chat (session key) its own queue of inbound messages. A chat's
+// messages are handled one at a time in arrival order, while different chats are handled
+// concurrently by at most workers handlers at once.
+type dispatcher struct {
+	handle func(context.Context, chat.Inbound)
+	slots  chan struct{} // one token per running handler
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	queues map[string][]chat.Inbound // messages waiting per chat; a key is present while its chat is being drained
+}
+
+func newDispatcher(workers int, handle func(context.Context, chat.Inbound)) *dispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &dispatcher{handle: handle, slots: make(chan struct{}, workers), queues: make(map[string][]chat.Inbound)}
+}
+
+// submit queues msg behind any earlier messages of the same chat. It never blocks.
+func (d *dispatcher) submit(ctx context.Context, msg chat.Inbound) {
+	key := msg.Channel + ":" + msg.ChatID
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if q, busy := d.queues[key]; busy {
+		d.queues[key] = append(q, msg)
+		return
+	}
+	d.queues[key] = nil
+	d.wg.Add(1)
+	go d.drain(ctx, key, msg)
+}
+
+// drain handles msg and then the chat's queued messages until its queue is empty.
+// The worker slot is released between messages so a busy chat cannot starve the others.
+func (d *dispatcher) drain(ctx context.Context, key string, msg chat.Inbound) {
+	defer d.wg.Done()
+	for {
+		select {
+		case d.slots <- struct{}{}:
+			if ctx.Err() == nil {
+				d.handle(context.WithValue(ctx, releaseSlotKey{}, d.releaseSlot), msg)
+			}
+			<-d.slots
+		case <-ctx.Done():
+			// shutting down: drop what is still queued
+		}
+
+		d.mu.Lock()
+		q := d.queues[key]
+		if len(q) == 0 || ctx.Err() != nil {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		msg, d.queues[key] = q[0], q[1:]
+		d.mu.Unlock()
+	}
+}
+
+// releaseSlot gives up the caller's worker slot and returns a function that takes one back.
+func (d *dispatcher) releaseSlot() (reacquire func()) {
+	<-d.slots
+	return func() { d.slots <- struct{}{} }
+}
+
+type releaseSlotKey struct{}
+
+// releaseSlot lets a handler that waits on a person (an approval, say) give up its worker
+// slot so other chats can run meanwhile. Call the returned function before doing work again;
+// it blocks until a slot is free. Outside the dispatcher it does nothing.
+func releaseSlot(ctx context.Context) (reacquire func()) {
+	if f, ok := ctx.Value(releaseSlotKey{}).(func() func()); ok {
+		return f()
+	}
+	return func() {}
+}
+
+// withoutSlot returns ctx with no worker slot to release, for work that outlives the
+// handler, such as a spawned subagent.
+func withoutSlot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, releaseSlotKey{}, nil)
+}
+
+// wait blocks until every running handler has returned.
+func (d *dispatcher) wait() {
+	d.wg.Wait()
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestDispatcherOrdersWithinChatAndParallelizesAcrossChats(t *testing.T) {
+	var mu sync.Mutex
+	handled := map[string][]string{}
+	running, peak := 0, 0
+	d := newDispatcher(2, func(ctx context.Context, msg chat.Inbound) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		handled[msg.ChatID] = append(handled[msg.ChatID], msg.Content)
+		mu.Unlock()
+	})
+
+	ctx := context.Background()
+	for _, content := range []string{"1", "2", "3"} {
+		for _, chatID := range []string{"a", "b", "c"} {
+			d.submit(ctx, chat.Inbound{Channel: "test", ChatID: chatID, Content: content})
+		}
+	}
+	d.wait()
+
+	for _, chatID := range []string{"a", "b", "c"} {
+		if got := handled[chatID]; len(got) != 3 || got[0] != "1" || got[1] != "2" || got[2] != "3" {
+			t.Errorf("chat %s handled %v, want [1 2 3]", chatID, got)
+		}
+	}
+	if peak != 2 {
+		t.Errorf("expected 2 chats handled at once, peak was %d", peak)
+	}
+}
+
+func TestDispatcherDropsQueuedMessagesOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var handled []string
+	d := newDispatcher(1, func(ctx context.Context, msg chat.Inbound) {
+		handled = append(handled, msg.Content)
+		cancel()
+	})
+	d.submit(ctx, chat.Inbound{ChatID: "a", Content: "first"})
+	d.submit(ctx, chat.Inbound{ChatID: "a", Content: "second"})
+	d.wait()
+	if len(handled) != 1 || handled[0] != "first" {
+		t.Fatalf("expected only the first message handled, got %v", handled)
+	}
+}
+
+// blockingProvider blocks every chat call for chat "slow" until released.
+type blockingProvider struct{ release chan struct{} }
+
+func (p *blockingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	last := messages[len(messages)-1].Content
+	if s, _ := last.(string); s == "slow" {
+		<-p.release
+	}
+	return providers.LLMResponse{Content: "reply"}, nil
+}
+func (p *blockingProvider) GetDefaultModel() string { return "blocking" }
+
+func TestRunDoesNotBlockOtherChatsOnASlowOne(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &blockingProvider{release: make(chan struct{})}
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	b.In <- chat.Inbound{Channel: "cli", ChatID: "one", Content: "slow"}
+	b.In <- chat.Inbound{Channel: "cli", ChatID: "two", Content: "fast"}
+	select {
+	case out := <-b.Out:
+		if out.ChatID != "two" {
+			t.Fatalf("expected the fast chat to reply first, got %+v", out)
+		}
+	case <-ctx.Done():
+		t.Fatal("fast chat was blocked by the slow one")
+	}
+	// let the slow chat finish before its workspace is removed
+	close(p.release)
+	select {
+	case <-b.Out:
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for the slow chat")
+	}
+}
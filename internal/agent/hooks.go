@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"log"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+// Hook extends agent runs (redaction, audit logging, guardrails, metrics) without changes to
+// the loop. A hook implements any of BeforeChatHook, AfterChatHook, BeforeToolHook,
+// AfterToolHook, ReplyHook and DisplayHook; the runner calls the methods it has, in registration order.
+// Hooks are shared by concurrent runs, so they must be safe for concurrent use.
+type Hook interface {
+	Name() string
+}
+
+// ChatCall is a model call about to be made.
+type ChatCall struct {
+	Model    string
+	Messages []providers.Message
+	Tools    []providers.ToolDefinition
+	Options  providers.GenerationOptions
+}
+
+// BeforeChatHook runs before each model call of a run. It may edit call; an error ends the
+// run with StopError.
+type BeforeChatHook interface {
+	BeforeChat(ctx context.Context, call *ChatCall) error
+}
+
+// AfterChatHook runs after each model call, also a failed one (err non-nil). It may edit resp.
+type AfterChatHook interface {
+	AfterChat(ctx context.Context, call ChatCall, resp *providers.LLMResponse, err error)
+}
+
+// BeforeToolHook runs before each tool call. It may replace call.Arguments (with a new map: the
+// old one is also in the assistant message); an error vetoes the call, and the model gets the
+// error as the tool's result.
+type BeforeToolHook interface {
+	BeforeTool(ctx context.Context, call *providers.ToolCall) error
+}
+
+// AfterToolHook runs after each tool call, vetoed ones included. It may rewrite trace.Result,
+// which is what the model sees, and replace trace.Call.Arguments (with a new map), which then
+// replace the arguments in the assistant message kept in the history.
+type AfterToolHook interface {
+	AfterTool(ctx context.Context, trace *ToolTrace)
+}
+
+// ReplyHook runs on the final reply of Run, ProcessDirect and RunSubagent before it is
+// delivered. It may rewrite reply.
+type ReplyHook interface {
+	OnReply(ctx context.Context, res RunResult, reply *string)
+}
+
+// DisplayHook runs on text shown in the chat besides the final reply: streamed partial
+// replies and the model's thinking. It may rewrite text.
+type DisplayHook interface {
+	OnDisplay(ctx context.Context, text *string)
+}
+
+// Hooks is an ordered list of hooks.
+type Hooks []Hook
+
+func (hs Hooks) beforeChat(ctx context.Context, call *ChatCall) error {
+	for _, h := range hs {
+		if bh, ok := h.(BeforeChatHook); ok {
+			if err := bh.BeforeChat(ctx, call); err != nil {
+				log.Printf("hook %s stopped the run: %v", h.Name(), err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (hs Hooks) afterChat(ctx context.Context, call ChatCall, resp *providers.LLMResponse, err error) {
+	for _, h := range hs {
+		if ah, ok := h.(AfterChatHook); ok {
+			ah.AfterChat(ctx, call, resp, err)
+		}
+	}
+}
+
+func (hs Hooks) beforeTool(ctx context.Context, call *providers.ToolCall) error {
+	for _, h := range hs {
+		if bh, ok := h.(BeforeToolHook); ok {
+			if err := bh.BeforeTool(ctx, call); err != nil {
+				log.Printf("hook %s vetoed tool call %s: %v", h.Name(), call.Name, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (hs Hooks) afterTool(ctx context.Context, trace *ToolTrace) {
+	for _, h := range hs {
+		if ah, ok := h.(AfterToolHook); ok {
+			ah.AfterTool(ctx, trace)
+		}
+	}
+}
+
+func (hs Hooks) onReply(ctx context.Context, res RunResult, reply string) string {
+	for _, h := range hs {
+		if rh, ok := h.(ReplyHook); ok {
+			rh.OnReply(ctx, res, &reply)
+		}
+	}
+	return reply
+}
+
+func (hs Hooks) onDisplay(ctx context.Context, text string) string {
+	for _, h := range hs {
+		if dh, ok := h.(DisplayHook); ok {
+			dh.OnDisplay(ctx, &text)
+		}
+	}
+	return text
+}
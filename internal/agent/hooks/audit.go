@@ -0,0 +1,123 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/agent"
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/providers"
+)
+
+// auditResultLen caps the tool results and replies copied into the audit log.
+const auditResultLen = 2000
+
+// AuditRecord is one line of the audit log.
+type AuditRecord struct {
+	Time      time.Time              `json:"time"`
+	Event     string                 `json:"event"` // "chat", "tool" or "reply"
+	Session   string                 `json:"session,omitempty"`
+	Channel   string                 `json:"channel,omitempty"`
+	ChatID    string                 `json:"chatId,omitempty"`
+	Subagent  bool                   `json:"subagent,omitempty"`
+	Model     string                 `json:"model,omitempty"`     // chat
+	Usage     *providers.Usage       `json:"usage,omitempty"`     // chat
+	ToolCalls []string               `json:"toolCalls,omitempty"` // chat: names of the tools the model asked for
+	Tool      string                 `json:"tool,omitempty"`      // tool
+	Arguments map[string]interface{} `json:"arguments,omitempty"` // tool
+	Result    string                 `json:"result,omitempty"`    // tool: truncated; reply: the reply
+	Stop      string                 `json:"stop,omitempty"`      // reply
+	Error     string                 `json:"error,omitempty"`
+}
+
+// AuditLogger appends every model call, tool call and final reply to a JSONL file.
+// It records what the hooks before it have left, so register it after a Redactor.
+type AuditLogger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewAuditLogger returns an AuditLogger writing to path. The file is created on first write.
+func NewAuditLogger(path string) *AuditLogger {
+	return &AuditLogger{path: path}
+}
+
+func (l *AuditLogger) Name() string { return "audit" }
+
+func (l *AuditLogger) AfterChat(ctx context.Context, call agent.ChatCall, resp *providers.LLMResponse, err error) {
+	rec := newAuditRecord(ctx, "chat")
+	rec.Model = call.Model
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		u := resp.Usage
+		rec.Usage = &u
+		for _, tc := range resp.ToolCalls {
+			rec.ToolCalls = append(rec.ToolCalls, tc.Name)
+		}
+	}
+	l.write(rec)
+}
+
+func (l *AuditLogger) AfterTool(ctx context.Context, trace *agent.ToolTrace) {
+	rec := newAuditRecord(ctx, "tool")
+	rec.Tool = trace.Call.Name
+	rec.Arguments = trace.Call.Arguments
+	rec.Result = truncate(trace.Result, auditResultLen)
+	if trace.Err != nil {
+		rec.Error = trace.Err.Error()
+	}
+	l.write(rec)
+}
+
+func (l *AuditLogger) OnReply(ctx context.Context, res agent.RunResult, reply *string) {
+	rec := newAuditRecord(ctx, "reply")
+	rec.Result = truncate(*reply, auditResultLen)
+	rec.Stop = string(res.Stop)
+	if res.Err != nil {
+		rec.Error = res.Err.Error()
+	}
+	l.write(rec)
+}
+
+func newAuditRecord(ctx context.Context, event string) AuditRecord {
+	run := tools.RunInfoFrom(ctx)
+	return AuditRecord{Time: time.Now(), Event: event, Session: run.SessionKey, Channel: run.Channel, ChatID: run.ChatID, Subagent: run.Subagent}
+}
+
+// write appends rec to the log. Failures are logged, never returned: auditing must not
+// break a run.
+func (l *AuditLogger) write(rec AuditRecord) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("audit: %v", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		log.Printf("audit: %v", err)
+		return
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("audit: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
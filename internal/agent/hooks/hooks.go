@@ -0,0 +1,38 @@
+// Package hooks has the built-in agent hooks: an audit logger and a redactor.
+package hooks
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/local/picobot/internal/agent"
+	"github.com/local/picobot/internal/config"
+)
+
+// FromConfig builds the hooks enabled in cfgs, in order. Relative audit log paths are
+// resolved against workspace.
+func FromConfig(cfgs []config.HookConfig, workspace string) ([]agent.Hook, error) {
+	var out []agent.Hook
+	for _, c := range cfgs {
+		switch c.Type {
+		case config.HookAudit:
+			path := c.Path
+			if path == "" {
+				path = "audit.jsonl"
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(workspace, path)
+			}
+			out = append(out, NewAuditLogger(path))
+		case config.HookRedact:
+			r, err := NewRedactor(c.Keys, c.Patterns)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, r)
+		default:
+			return nil, fmt.Errorf("unknown hook type %q", c.Type)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,150 @@
+package hooks
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/agent"
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/session"
+)
+
+func TestRedactorMasksArgumentsAndSecrets(t *testing.T) {
+	r, err := NewRedactor(nil, []string{`hunter\d`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := map[string]interface{}{
+		"url":     "https://example.com",
+		"api_key": "abc",
+		"headers": map[string]interface{}{"Authorization": "Bearer xyz"},
+		"note":    "password is hunter2",
+	}
+	trace := &agent.ToolTrace{
+		Call:   providers.ToolCall{Name: "web", Arguments: args},
+		Result: "OPENAI_API_KEY=sk-abcdefghijklmnopqrstuvwxyz",
+	}
+	r.AfterTool(context.Background(), trace)
+
+	got := trace.Call.Arguments
+	if got["url"] != "https://example.com" || got["api_key"] != Redacted || got["note"] != "password is "+Redacted {
+		t.Errorf("unexpected arguments %v", got)
+	}
+	if h := got["headers"].(map[string]interface{}); h["Authorization"] != Redacted {
+		t.Errorf("nested keys should be masked, got %v", h)
+	}
+	if args["api_key"] != "abc" {
+		t.Error("the original arguments must not be modified")
+	}
+	if trace.Result != "OPENAI_API_KEY="+Redacted {
+		t.Errorf("unexpected result %q", trace.Result)
+	}
+
+	reply := "your key is sk-abcdefghijklmnopqrstuvwxyz"
+	r.OnReply(context.Background(), agent.RunResult{}, &reply)
+	if reply != "your key is "+Redacted {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	partial := "so far: sk-abcdefghijklmnopqrstuvwxyz"
+	r.OnDisplay(context.Background(), &partial)
+	if partial != "so far: "+Redacted {
+		t.Errorf("unexpected partial %q", partial)
+	}
+
+	if _, err := NewRedactor(nil, []string{"("}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestRedactorMasksSavedToolCalls(t *testing.T) {
+	ws := t.TempDir()
+	p, err := providers.NewScriptedProvider(providers.Script{Turns: []providers.ScriptTurn{
+		{ToolCalls: []providers.ScriptToolCall{{Name: "filesystem", Arguments: map[string]interface{}{"action": "list", "path": ".", "token": "s3cr3t-value"}}}},
+		{Text: "done"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRedactor(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ag := agent.NewAgentLoop(chat.NewHub(10), p, p.GetDefaultModel(), 5, ws, nil)
+	ag.AddHook(r)
+	if _, err := ag.ProcessDirect("list files", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []providers.ToolCall
+	for _, m := range session.NewSessionManager(ws).GetOrCreate("cli:direct").Messages {
+		calls = append(calls, m.ToolCalls...)
+	}
+	if len(calls) != 1 || calls[0].Arguments["token"] != Redacted || calls[0].Arguments["action"] != "list" {
+		t.Fatalf("expected the saved tool call to be masked, got %+v", calls)
+	}
+}
+
+func TestAuditLoggerWritesJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	l := NewAuditLogger(path)
+	ctx := tools.WithRunInfo(context.Background(), tools.RunInfo{Channel: "telegram", ChatID: "42", SessionKey: "telegram:42"})
+
+	l.AfterChat(ctx, agent.ChatCall{Model: "m"}, &providers.LLMResponse{ToolCalls: []providers.ToolCall{{Name: "exec"}}, Usage: providers.Usage{PromptTokens: 10}}, nil)
+	l.AfterTool(ctx, &agent.ToolTrace{Call: providers.ToolCall{Name: "exec", Arguments: map[string]interface{}{"cmd": "ls"}}, Result: "(tool error) boom", Err: errors.New("boom")})
+	reply := "done"
+	l.OnReply(ctx, agent.RunResult{Stop: agent.StopFinal}, &reply)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []AuditRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("bad line %q: %v", sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(recs))
+	}
+	if r := recs[0]; r.Event != "chat" || r.Session != "telegram:42" || r.Model != "m" || r.Usage.PromptTokens != 10 || strings.Join(r.ToolCalls, ",") != "exec" {
+		t.Errorf("unexpected chat record %+v", r)
+	}
+	if r := recs[1]; r.Event != "tool" || r.Tool != "exec" || r.Arguments["cmd"] != "ls" || r.Error != "boom" {
+		t.Errorf("unexpected tool record %+v", r)
+	}
+	if r := recs[2]; r.Event != "reply" || r.Result != "done" || r.Stop != "final" {
+		t.Errorf("unexpected reply record %+v", r)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	ws := t.TempDir()
+	hs, err := FromConfig([]config.HookConfig{{Type: config.HookRedact}, {Type: config.HookAudit}}, ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hs) != 2 || hs[0].Name() != "redact" || hs[1].Name() != "audit" {
+		t.Fatalf("unexpected hooks %v", hs)
+	}
+	if got := hs[1].(*AuditLogger).path; got != filepath.Join(ws, "audit.jsonl") {
+		t.Errorf("audit path = %q", got)
+	}
+	if _, err := FromConfig([]config.HookConfig{{Type: "nope"}}, ws); err == nil {
+		t.Error("expected an error for an unknown hook type")
+	}
+}
@@ -0,0 +1,112 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/local/picobot/internal/agent"
+)
+
+// Redacted replaces masked values.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactKeys are the argument names masked when no keys are configured. Names are
+// compared ignoring case, "_" and "-".
+var DefaultRedactKeys = []string{"password", "passwd", "secret", "clientSecret", "token", "accessToken", "apiKey", "authorization"}
+
+// defaultRedactPatterns match well-known secret formats; configured patterns are added to them.
+var defaultRedactPatterns = []string{
+	`sk-[A-Za-z0-9_-]{20,}`,               // OpenAI / Anthropic API keys
+	`gh[pousr]_[A-Za-z0-9]{36,}`,          // GitHub tokens
+	`\b\d{8,10}:[A-Za-z0-9_-]{35}\b`,      // Telegram bot tokens
+	`(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*`, // Authorization headers
+}
+
+// Redactor masks secrets after each tool call: the values of sensitive argument names,
+// and anything matching its patterns in arguments, results and the replies shown in the
+// chat, streamed partials and thinking included. Masked results are what the model sees, so
+// a secret a tool reads never reaches the provider. Arguments are masked only after the tool
+// has run, and the masked ones are what the session keeps and the model sees on later turns.
+type Redactor struct {
+	keys     map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a Redactor for keys (DefaultRedactKeys if empty) and patterns, on
+// top of the built-in secret patterns.
+func NewRedactor(keys, patterns []string) (*Redactor, error) {
+	if len(keys) == 0 {
+		keys = DefaultRedactKeys
+	}
+	r := &Redactor{keys: map[string]bool{}}
+	for _, k := range keys {
+		r.keys[normalizeKey(k)] = true
+	}
+	for _, p := range append(append([]string{}, defaultRedactPatterns...), patterns...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+func (r *Redactor) Name() string { return "redact" }
+
+func (r *Redactor) AfterTool(ctx context.Context, trace *agent.ToolTrace) {
+	if trace.Call.Arguments != nil {
+		trace.Call.Arguments = r.redactMap(trace.Call.Arguments)
+	}
+	trace.Result = r.redactString(trace.Result)
+}
+
+func (r *Redactor) OnReply(ctx context.Context, res agent.RunResult, reply *string) {
+	*reply = r.redactString(*reply)
+}
+
+func (r *Redactor) OnDisplay(ctx context.Context, text *string) {
+	*text = r.redactString(*text)
+}
+
+// redactMap returns a copy of m with sensitive values masked, recursively.
+func (r *Redactor) redactMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if r.keys[normalizeKey(k)] {
+			out[k] = Redacted
+			continue
+		}
+		out[k] = r.redactValue(v)
+	}
+	return out
+}
+
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.redactString(v)
+	case map[string]interface{}:
+		return r.redactMap(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = r.redactValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+func (r *Redactor) redactString(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+func normalizeKey(k string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(k))
+}
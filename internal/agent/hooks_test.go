@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// guardHook vetoes the "upper" tool when its text is "secret", rewrites other arguments
+// to lower case, and counts what it sees.
+type guardHook struct {
+	chats, toolsSeen int
+	replies          []string
+}
+
+func (h *guardHook) Name() string { return "guard" }
+
+func (h *guardHook) AfterChat(ctx context.Context, call ChatCall, resp *providers.LLMResponse, err error) {
+	h.chats++
+}
+
+func (h *guardHook) BeforeTool(ctx context.Context, call *providers.ToolCall) error {
+	text, _ := call.Arguments["text"].(string)
+	if text == "secret" {
+		return errors.New("not allowed")
+	}
+	call.Arguments = map[string]interface{}{"text": strings.ToLower(text) + "!"}
+	return nil
+}
+
+func (h *guardHook) AfterTool(ctx context.Context, trace *ToolTrace) {
+	h.toolsSeen++
+	trace.Result = "<" + trace.Result + ">"
+}
+
+func (h *guardHook) OnReply(ctx context.Context, res RunResult, reply *string) {
+	h.replies = append(h.replies, *reply)
+	*reply += " [checked]"
+}
+
+func TestHooksVetoAndRewriteToolCalls(t *testing.T) {
+	p, err := providers.NewScriptedProvider(providers.Script{Turns: []providers.ScriptTurn{
+		{ToolCalls: []providers.ScriptToolCall{
+			{Name: "upper", Arguments: map[string]interface{}{"text": "secret"}},
+			{Name: "upper", Arguments: map[string]interface{}{"text": "Hi"}},
+		}},
+		{Text: "done"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := tools.NewRegistry()
+	reg.Register(upperTool{})
+	h := &guardHook{}
+	r := newTestRunner(t, p)
+	r.Hooks = Hooks{h}
+
+	res := r.Run(context.Background(), RunRequest{Input: "shout", Model: p.GetDefaultModel(), Tools: reg, MaxIterations: 5})
+	if res.Stop != StopFinal || len(res.Tools) != 2 {
+		t.Fatalf("unexpected result: stop %q, %d tool calls", res.Stop, len(res.Tools))
+	}
+	if got := res.Tools[0]; got.Err == nil || got.Result != "<(tool error) not allowed>" {
+		t.Errorf("first call should be vetoed, got %+v", got)
+	}
+	if got := res.Tools[1].Result; got != "<HI!>" {
+		t.Errorf("second call should run with rewritten arguments and rewritten result, got %q", got)
+	}
+	if h.chats != 2 || h.toolsSeen != 2 {
+		t.Errorf("hook saw %d chats and %d tool calls, want 2 and 2", h.chats, h.toolsSeen)
+	}
+	var toolMsgs []string
+	for _, m := range res.Messages {
+		if m.Role == "tool" {
+			s, _ := m.Content.(string)
+			toolMsgs = append(toolMsgs, s)
+		}
+	}
+	if len(toolMsgs) != 2 || toolMsgs[1] != "<HI!>" {
+		t.Errorf("the model should see the rewritten results, got %q", toolMsgs)
+	}
+}
+
+// stopHook refuses every model call.
+type stopHook struct{}
+
+func (stopHook) Name() string { return "stop" }
+func (stopHook) BeforeChat(ctx context.Context, call *ChatCall) error {
+	return errors.New("over budget")
+}
+
+func TestBeforeChatHookStopsTheRun(t *testing.T) {
+	p := &modelRecordingProvider{}
+	r := newTestRunner(t, p)
+	r.Hooks = Hooks{stopHook{}}
+	res := r.Run(context.Background(), RunRequest{Input: "hi", Model: "main-model", MaxIterations: 3})
+	if res.Stop != StopError || res.Err == nil || len(p.models) != 0 {
+		t.Fatalf("expected the run to stop before calling the provider, got stop %q err %v, %d calls", res.Stop, res.Err, len(p.models))
+	}
+}
+
+func TestReplyHookRewritesTheReply(t *testing.T) {
+	p, err := providers.NewScriptedProvider(providers.Script{Turns: []providers.ScriptTurn{{Text: "hello", Repeat: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ag := NewAgentLoop(chat.NewHub(10), p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+	h := &guardHook{}
+	ag.AddHook(h)
+
+	got, err := ag.ProcessDirect("hi", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello [checked]" || len(h.replies) != 1 || h.replies[0] != "hello" {
+		t.Fatalf("got %q, hook saw %q", got, h.replies)
+	}
+}
@@ -2,10 +2,12 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/local/picobot/internal/agent/memory"
@@ -14,6 +16,7 @@ import (
 	"github.com/local/picobot/internal/cron"
 	"github.com/local/picobot/internal/providers"
 	"github.com/local/picobot/internal/session"
+	"github.com/local/picobot/internal/usage"
 )
 
 var rememberRE = regexp.MustCompile(`(?i)^remember(?:\s+to)?\s+(.+)$`)
@@ -38,14 +41,133 @@ func suggestsIncompleteAction(content string) bool {
 // AgentLoop is the core processing loop; it holds an LLM provider, tools, sessions and context builder.
 type AgentLoop struct {
 	hub           *chat.Hub
-	provider      providers.LLMProvider
+	runner        *Runner
 	tools         *tools.Registry
 	sessions      *session.SessionManager
-	context       *ContextBuilder
 	memory        *memory.MemoryStore
 	model         string
+	routes        ModelRoutes
+	modelChoice   ModelChoice
 	maxIterations int
-	running       bool
+	maxChats      int
+	approvals     *approvals // nil: every tool call runs without asking
+	workspace     string
+	scheduler     *cron.Scheduler // nil when scheduling is not available
+	skills        *tools.SkillManager
+
+	commands     map[string]Command // by name
+	commandOrder []string
+
+	profiles      map[string]*profile // by name
+	profileRoutes []ProfileRoute
+
+	runsMu    sync.Mutex
+	runs      map[string]stoppable            // the current run, by session key
+	subagents map[string]map[string]stoppable // subagents, by requester's and own session key
+}
+
+// ModelRoutes names the model used for secondary kinds of LLM call so cheap work
+// doesn't burn the main chat model. Empty fields fall back to the main model.
+type ModelRoutes struct {
+	Compaction string // CompactIfNeeded summarization
+	Subagent   string // RunSubagent (spawn tool)
+}
+
+// SetModelRoutes sets the per-purpose models.
+func (a *AgentLoop) SetModelRoutes(r ModelRoutes) {
+	a.routes = r
+	a.runner.CompactionModel = r.Compaction
+}
+
+// ModelChoice limits the models /model can switch a chat to. The default, per-purpose and
+// profile models are always allowed.
+type ModelChoice struct {
+	// Allowed lists the other models a chat may use. Empty means any model written with no
+	// prefix or a Providers prefix that the model registry knows.
+	Allowed   []string
+	Providers []string // names of the configured providers
+}
+
+// SetModelChoice sets which models /model accepts.
+func (a *AgentLoop) SetModelChoice(c ModelChoice) {
+	a.modelChoice = c
+}
+
+// SetModelRegistry sets the registry used to look up model capabilities
+// (context window, vision and tool support).
+func (a *AgentLoop) SetModelRegistry(r *providers.ModelRegistry) {
+	a.runner.Models = r
+}
+
+// SetMemoryRanker sets how the memories put in the prompt are picked (default: a
+// memory.SimpleRanker, by keywords). Set it before SetProfiles, whose profiles copy it.
+func (a *AgentLoop) SetMemoryRanker(r memory.Ranker) {
+	a.runner.Context.ranker = r
+}
+
+// SetSessionStore sets where chat sessions are kept (default: JSON files in the workspace's
+// sessions directory). Set it before Run starts.
+func (a *AgentLoop) SetSessionStore(st session.SessionStore) {
+	a.sessions = session.NewSessionManagerWithStore(st)
+}
+
+// DefaultMaxConcurrentChats is how many chats Run processes at the same time by default.
+const DefaultMaxConcurrentChats = 4
+
+// SetMaxConcurrentChats sets how many chats Run processes at the same time (default
+// DefaultMaxConcurrentChats). Messages within one chat are always handled in order.
+func (a *AgentLoop) SetMaxConcurrentChats(n int) {
+	if n <= 0 {
+		n = DefaultMaxConcurrentChats
+	}
+	a.maxChats = n
+}
+
+// SetGenerationOptions sets the options (max tokens, temperature, ...) used for chat calls.
+func (a *AgentLoop) SetGenerationOptions(o providers.GenerationOptions) {
+	a.runner.Options = o
+}
+
+// AddHook registers a hook for every run. Register hooks before Run starts.
+func (a *AgentLoop) AddHook(h Hook) {
+	a.runner.Hooks = append(a.runner.Hooks, h)
+}
+
+// SetApprovalPolicy makes tool calls subject to policy. Calls that need approval are sent
+// to the run's chat and wait for /approve or /deny (or a button press on Telegram). The
+// policy is checked before any other hook. Set it before Run starts.
+func (a *AgentLoop) SetApprovalPolicy(policy ApprovalPolicy) {
+	hooks := Hooks{}
+	for _, h := range a.runner.Hooks {
+		if h != Hook(a.approvals) {
+			hooks = append(hooks, h)
+		}
+	}
+	a.approvals = newApprovals(policy, a.hub)
+	a.runner.Hooks = append(Hooks{a.approvals}, hooks...)
+	a.RegisterCommand(Command{Name: "approve", Description: "Approve a pending tool call", Args: "<id>", Immediate: true, Handle: a.approvals.command(true)})
+	a.RegisterCommand(Command{Name: "deny", Description: "Deny a pending tool call", Args: "<id>", Immediate: true, Handle: a.approvals.command(false)})
+}
+
+// subagentModel returns the model used by subagents spawned from a chat of profile p.
+func (a *AgentLoop) subagentModel(p *profile) string {
+	if a.routes.Subagent != "" {
+		return a.routes.Subagent
+	}
+	return a.modelFor(p)
+}
+
+// providerErrorReply turns a provider failure into a reply for the user.
+func providerErrorReply(err error) string {
+	switch {
+	case errors.Is(err, providers.ErrRateLimited):
+		return "Sorry, the model provider is rate limiting requests right now. Please try again in a minute."
+	case errors.Is(err, providers.ErrAuth):
+		return "Sorry, the model provider rejected my credentials. Please check the API key in the config."
+	case errors.Is(err, providers.ErrContextLength):
+		return "Sorry, this conversation has grown too long for the model, even after summarizing it."
+	}
+	return "Sorry, I encountered an error while processing your request."
 }
 
 // NewAgentLoop creates a new AgentLoop with the given provider.
@@ -91,145 +213,133 @@ func NewAgentLoop(b *chat.Hub, provider providers.LLMProvider, model string, max
 	reg.Register(tools.NewReadSkillTool(skillMgr))
 	reg.Register(tools.NewDeleteSkillTool(skillMgr))
 
-	a := &AgentLoop{hub: b, provider: provider, tools: reg, sessions: sm, context: ctx, memory: mem, model: model, maxIterations: maxIterations}
+	runner := &Runner{Provider: provider, Context: ctx, Memory: mem, Models: providers.NewModelRegistry(nil)}
+	a := &AgentLoop{hub: b, runner: runner, tools: reg, sessions: sm, memory: mem, model: model, maxIterations: maxIterations, maxChats: DefaultMaxConcurrentChats,
+		workspace: workspace, scheduler: scheduler, skills: skillMgr, commands: map[string]Command{}, runs: map[string]stoppable{},
+		subagents: map[string]map[string]stoppable{}}
 	reg.Register(tools.NewSpawnTool(b, a))
+	a.registerBuiltinCommands()
 	return a
 }
 
 // Run starts processing inbound messages. This is a blocking call until context is canceled.
+// Messages are handled by a dispatcher: in arrival order within a chat, and concurrently
+// (up to the SetMaxConcurrentChats limit) across chats.
 func (a *AgentLoop) Run(ctx context.Context) {
-	a.running = true
 	log.Println("Agent loop started")
+	d := newDispatcher(a.maxChats, a.handleInbound)
+	defer d.wait()
 
-	for a.running {
+	for {
 		select {
 		case <-ctx.Done():
 			log.Println("Agent loop received shutdown signal")
-			a.running = false
 			return
 		case msg, ok := <-a.hub.In:
 			if !ok {
 				log.Println("Inbound channel closed, stopping agent loop")
-				a.running = false
 				return
 			}
-
-			log.Printf("Processing message from %s:%s\n", msg.Channel, msg.SenderID)
-
-			// Quick heuristic: if user asks the agent to remember something explicitly,
-			// store it in today's note and reply immediately without calling the LLM.
-			trimmed := strings.TrimSpace(msg.Content)
-			rememberRe := rememberRE
-			if matches := rememberRe.FindStringSubmatch(trimmed); len(matches) == 2 {
-				note := matches[1]
-				if err := a.memory.AppendToday(note); err != nil {
-					log.Printf("error appending to memory: %v", err)
-				}
-				out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: "OK, I've remembered that."}
-				select {
-				case a.hub.Out <- out:
-				default:
-					log.Println("Outbound channel full, dropping message")
-				}
-				// save to session as well
-				session := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
-				session.AddMessage("user", msg.Content)
-				session.AddMessage("assistant", "OK, I've remembered that.")
-				a.sessions.Save(session)
+			// immediate commands (/stop, /approve, /deny) skip the chat's queue: they are
+			// about the run that is holding it
+			if a.immediateCommand(ctx, msg) {
 				continue
 			}
+			d.submit(ctx, msg)
+		}
+	}
+}
 
-			// Set tool context (so message tool knows channel+chat)
-			if mt := a.tools.Get("message"); mt != nil {
-				if mtool, ok := mt.(interface{ SetContext(string, string) }); ok {
-					mtool.SetContext(msg.Channel, msg.ChatID)
-				}
-			}
-			if ct := a.tools.Get("cron"); ct != nil {
-				if ctool, ok := ct.(interface{ SetContext(string, string) }); ok {
-					ctool.SetContext(msg.Channel, msg.ChatID)
-				}
-			}
-			if st := a.tools.Get("spawn"); st != nil {
-				if spawnTool, ok := st.(interface{ SetContext(string, string) }); ok {
-					spawnTool.SetContext(msg.Channel, msg.ChatID)
-				}
-			}
-
-			// Build messages from session, long-term memory, and recent memory
-			session := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
-			// get file-backed memory context (long-term + today)
-			memCtx, _ := a.memory.GetMemoryContext()
-			memories := a.memory.Recent(5)
-			if len(memories) == 0 {
-				memories = a.memory.RecentFromFiles(5)
-			}
-			messages := a.context.BuildMessages(session.GetHistory(), msg.Content, msg.Media, msg.Channel, msg.ChatID, memCtx, memories)
-
-			iteration := 0
-			finalContent := ""
-			lastToolResult := ""
-			toolDefs := a.tools.Definitions()
-			for iteration < a.maxIterations {
-				iteration++
-				messages, _ = CompactIfNeeded(ctx, messages, DefaultContextWindowTokens, a.provider, a.model)
-				resp, err := a.provider.Chat(ctx, messages, toolDefs, a.model)
-				if err != nil {
-					log.Printf("provider error: %v", err)
-					finalContent = "Sorry, I encountered an error while processing your request."
-					break
-				}
-
-				if resp.HasToolCalls {
-					// append assistant message with tool_calls attached
-					messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
-					// Execute each tool call and return results with "tool" role
-					maxChars := CalculateMaxToolResultChars(DefaultContextWindowTokens)
-					for _, tc := range resp.ToolCalls {
-						res, err := a.tools.Execute(ctx, tc.Name, tc.Arguments)
-						if err != nil {
-							res = "(tool error) " + err.Error()
-						}
-						res = TruncateToolResult(res, maxChars)
-						lastToolResult = res
-						messages = append(messages, providers.Message{Role: "tool", Content: res, ToolCallID: tc.ID})
-					}
-					// loop again
-					continue
-				}
-
-				// Text-only response: check if model promised to act but didn't (e.g. "Let me fix the skill:")
-				if lastToolResult != "" && suggestsIncompleteAction(resp.Content) && iteration < a.maxIterations {
-					messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content})
-					messages = append(messages, providers.Message{Role: "user", Content: "Please proceed and make the changes using the tools."})
-					continue
-				}
-
-				finalContent = resp.Content
-				break
-			}
+// handleInbound processes one inbound message and publishes the reply.
+func (a *AgentLoop) handleInbound(ctx context.Context, msg chat.Inbound) {
+	log.Printf("Processing message from %s:%s\n", msg.Channel, msg.SenderID)
 
-			if finalContent == "" && lastToolResult != "" {
-				finalContent = lastToolResult
-			} else if finalContent == "" {
-				finalContent = "I've completed processing but have no response to give."
-			}
+	p := a.profileFor(msg.Channel, msg.ChatID, msg.SenderID)
 
-			// Save session
-			session.AddMessage("user", msg.Content)
-			session.AddMessage("assistant", finalContent)
+	// slash commands are answered without the LLM and not kept in the history, except
+	// prompt commands, which stand for a longer message to the model
+	if c, args, ok := a.command(msg.Content, p); ok {
+		if c.Handle == nil {
+			msg.Content = expandPrompt(c.Prompt, args)
+		} else {
+			session := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
+			reply := c.Handle(ctx, CommandCall{Msg: msg, Args: args, Session: session})
 			a.sessions.Save(session)
-
-			out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: finalContent}
-			select {
-			case a.hub.Out <- out:
-			default:
-				log.Println("Outbound channel full, dropping message")
-			}
+			a.send(msg.Channel, msg.ChatID, reply)
+			return
+		}
+	}
+	trimmed := strings.TrimSpace(msg.Content)
+
+	// Quick heuristic: if user asks the agent to remember something explicitly,
+	// store it in today's note and reply immediately without calling the LLM.
+	rememberRe := rememberRE
+	if matches := rememberRe.FindStringSubmatch(trimmed); len(matches) == 2 {
+		note := matches[1]
+		if err := p.memory.AppendToday(note); err != nil {
+			log.Printf("error appending to memory: %v", err)
+		}
+		out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: "OK, I've remembered that."}
+		select {
+		case a.hub.Out <- out:
 		default:
-			// idle tick
-			time.Sleep(100 * time.Millisecond)
+			log.Println("Outbound channel full, dropping message")
 		}
+		// save to session as well
+		session := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
+		session.AddMessage("user", msg.Content)
+		session.AddMessage("assistant", "OK, I've remembered that.")
+		a.sessions.Save(session)
+		return
+	}
+
+	ctx = usage.WithTags(ctx, usage.Tags{SessionKey: msg.Channel + ":" + msg.ChatID, Channel: msg.Channel, Purpose: usage.PurposeChat})
+	// tools (message, cron, spawn) read the chat to act on from the context
+	ctx = tools.WithRunInfo(ctx, tools.RunInfo{Channel: msg.Channel, ChatID: msg.ChatID, SenderID: msg.SenderID, SessionKey: msg.Channel + ":" + msg.ChatID})
+
+	ctx, done := a.startRun(ctx, msg.Channel+":"+msg.ChatID, msg.SenderID)
+	defer done()
+
+	session := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
+	model := a.modelFor(p)
+	if session.Model != "" {
+		model = session.Model
+	}
+	stream := newReplyStream(a.hub, msg.Channel, msg.ChatID)
+	stream.filter = func(text string) string { return a.runner.Hooks.onDisplay(ctx, text) }
+	res := a.runnerFor(p).Run(ctx, RunRequest{
+		History:       session.GetHistory(),
+		Input:         msg.Content,
+		Media:         msg.Media,
+		Channel:       msg.Channel,
+		ChatID:        msg.ChatID,
+		Model:         model,
+		Tools:         a.toolsFor(p),
+		MaxIterations: a.maxIterations,
+		stream:        stream,
+	})
+
+	finalContent := res.Text()
+	if res.Stop == StopCanceled {
+		finalContent = stoppedReply(res)
+	} else if res.Err != nil {
+		log.Printf("provider error: %v", res.Err)
+		finalContent = providerErrorReply(res.Err)
+	} else if finalContent == "" {
+		finalContent = "I've completed processing but have no response to give."
+	}
+	finalContent = a.runner.Hooks.onReply(ctx, res, finalContent)
+
+	a.saveTurn(session, res, finalContent)
+
+	out := stream.final(finalContent)
+	if session.ShowThinking {
+		out.Thinking = a.runner.Hooks.onDisplay(ctx, strings.Join(res.Reasoning, "\n\n"))
+	}
+	select {
+	case a.hub.Out <- out:
+	default:
+		log.Println("Outbound channel full, dropping message")
 	}
 }
 
@@ -238,134 +348,78 @@ func (a *AgentLoop) Run(ctx context.Context) {
 func (a *AgentLoop) ProcessDirect(content string, timeout time.Duration) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-
-	// Build full context (bootstrap files, skills, memory) just like the main loop
-	memCtx, _ := a.memory.GetMemoryContext()
-	memories := a.memory.Recent(5)
-	if len(memories) == 0 {
-		memories = a.memory.RecentFromFiles(5)
+	ctx = usage.WithTags(ctx, usage.Tags{SessionKey: "cli:direct", Channel: "cli", Purpose: usage.PurposeChat})
+	ctx = tools.WithRunInfo(ctx, tools.RunInfo{Channel: "cli", ChatID: "direct", SessionKey: "cli:direct"})
+
+	p := a.profileFor("cli", "direct", "")
+	session := a.sessions.GetOrCreate("cli:direct")
+	res := a.runnerFor(p).Run(ctx, RunRequest{History: session.GetHistory(), Input: content, Channel: "cli", ChatID: "direct", Model: a.modelFor(p), Tools: a.toolsFor(p), MaxIterations: a.maxIterations})
+	if res.Err != nil {
+		return "", res.Err
 	}
-	messages := a.context.BuildMessages(nil, content, nil, "cli", "direct", memCtx, memories)
-
-	// Support tool calling iterations (similar to main loop)
-	var lastToolResult string
-	for iteration := 0; iteration < a.maxIterations; iteration++ {
-		messages, _ = CompactIfNeeded(ctx, messages, DefaultContextWindowTokens, a.provider, a.model)
-		resp, err := a.provider.Chat(ctx, messages, a.tools.Definitions(), a.model)
-		if err != nil {
-			return "", err
-		}
-
-		if !resp.HasToolCalls {
-			// Check if model promised to act but didn't; if so, prompt to continue
-			if lastToolResult != "" && suggestsIncompleteAction(resp.Content) && iteration < a.maxIterations-1 {
-				messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content})
-				messages = append(messages, providers.Message{Role: "user", Content: "Please proceed and make the changes using the tools."})
-				continue
-			}
-			// No tool calls, return the response (fall back to last tool result if empty)
-			if resp.Content != "" {
-				return resp.Content, nil
-			}
-			if lastToolResult != "" {
-				return lastToolResult, nil
-			}
-			return resp.Content, nil
-		}
-
-		// Execute tool calls
-		messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
-		maxChars := CalculateMaxToolResultChars(DefaultContextWindowTokens)
-		for _, tc := range resp.ToolCalls {
-			result, err := a.tools.Execute(ctx, tc.Name, tc.Arguments)
-			if err != nil {
-				result = "(tool error) " + err.Error()
-			}
-			result = TruncateToolResult(result, maxChars)
-			lastToolResult = result
-			messages = append(messages, providers.Message{Role: "tool", Content: result, ToolCallID: tc.ID})
-		}
+	reply := res.Text()
+	if res.Stop == StopMaxIterations && reply == "" {
+		reply = "Max iterations reached without final response"
 	}
-
-	return "Max iterations reached without final response", nil
+	reply = a.runner.Hooks.onReply(ctx, res, reply)
+	// keep the exchange, so later "picobot agent" calls continue the conversation
+	a.saveTurn(session, res, reply)
+	return reply, nil
 }
 
 // RunSubagent runs a subagent task in an isolated session and returns the final response.
 // It implements tools.SpawnRunner for use by the spawn tool.
 func (a *AgentLoop) RunSubagent(ctx context.Context, sessionKey string, task string, timeout time.Duration, requesterChannel, requesterChatID string) (string, error) {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx, cancel := context.WithTimeout(withoutSlot(ctx), timeout) // runs in the background, after the requester's handler
 	defer cancel()
-
-	// Set tool context so subagent's message/cron sends go to the requester
-	if mt := a.tools.Get("message"); mt != nil {
-		if mtool, ok := mt.(interface{ SetContext(string, string) }); ok {
-			mtool.SetContext(requesterChannel, requesterChatID)
-		}
-	}
-	if ct := a.tools.Get("cron"); ct != nil {
-		if ctool, ok := ct.(interface{ SetContext(string, string) }); ok {
-			ctool.SetContext(requesterChannel, requesterChatID)
-		}
+	senderID := tools.RunInfoFrom(ctx).SenderID
+	// /stop in the requester's chat stops it too
+	ctx, done := a.startSubagent(ctx, requesterChannel+":"+requesterChatID, sessionKey, senderID)
+	defer done()
+	ctx = usage.WithTags(ctx, usage.Tags{SessionKey: sessionKey, Channel: requesterChannel, Purpose: usage.PurposeSubagent})
+	// message and cron sends go to the requester, and approvals to its sender; spawn refuses to nest
+	ctx = tools.WithRunInfo(ctx, tools.RunInfo{Channel: requesterChannel, ChatID: requesterChatID, SenderID: senderID, SessionKey: sessionKey, Subagent: true})
+
+	// subagents work for the requester's profile, with its tools
+	p := a.profileFor(requesterChannel, requesterChatID, senderID)
+	childSession := a.sessions.GetOrCreate(sessionKey)
+	res := a.runnerFor(p).Run(ctx, RunRequest{
+		History:       childSession.GetHistory(),
+		Input:         task,
+		Channel:       "subagent",
+		ChatID:        sessionKey,
+		Model:         a.subagentModel(p),
+		Tools:         a.toolsFor(p),
+		MaxIterations: a.maxIterations,
+	})
+	if res.Stop == StopCanceled && errors.Is(res.Err, context.Canceled) {
+		reply := stoppedReply(res)
+		a.saveTurn(childSession, res, reply)
+		return reply, nil
 	}
-	if st := a.tools.Get("spawn"); st != nil {
-		if spawnTool, ok := st.(interface{ SetContext(string, string) }); ok {
-			spawnTool.SetContext("subagent", sessionKey)
-		}
+	if res.Err != nil {
+		// keep what the subagent did before it failed
+		a.saveTurn(childSession, res, "")
+		return "", res.Err
 	}
 
-	childSession := a.sessions.GetOrCreate(sessionKey)
-	memCtx, _ := a.memory.GetMemoryContext()
-	memories := a.memory.Recent(5)
-	if len(memories) == 0 {
-		memories = a.memory.RecentFromFiles(5)
+	reply := a.runner.Hooks.onReply(ctx, res, res.Text())
+	if res.Stop == StopMaxIterations && reply == "" {
+		reply = "Max iterations reached without final response"
 	}
-	messages := a.context.BuildMessages(childSession.GetHistory(), task, nil, "subagent", sessionKey, memCtx, memories)
-
-	var lastToolResult string
-	for iteration := 0; iteration < a.maxIterations; iteration++ {
-		messages, _ = CompactIfNeeded(ctx, messages, DefaultContextWindowTokens, a.provider, a.model)
-		resp, err := a.provider.Chat(ctx, messages, a.tools.Definitions(), a.model)
-		if err != nil {
-			return "", err
-		}
-
-		if !resp.HasToolCalls {
-			// Check if model promised to act but didn't; if so, prompt to continue
-			if lastToolResult != "" && suggestsIncompleteAction(resp.Content) && iteration < a.maxIterations-1 {
-				messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content})
-				messages = append(messages, providers.Message{Role: "user", Content: "Please proceed and make the changes using the tools."})
-				continue
-			}
-			if resp.Content != "" {
-				childSession.AddMessage("user", task)
-				childSession.AddMessage("assistant", resp.Content)
-				_ = a.sessions.Save(childSession)
-				return resp.Content, nil
-			}
-			if lastToolResult != "" {
-				return lastToolResult, nil
-			}
-			return resp.Content, nil
-		}
+	a.saveTurn(childSession, res, reply)
+	return reply, nil
+}
 
-		messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
-		maxChars := CalculateMaxToolResultChars(DefaultContextWindowTokens)
-		for _, tc := range resp.ToolCalls {
-			result, err := a.tools.Execute(ctx, tc.Name, tc.Arguments)
-			if err != nil {
-				result = "(tool error) " + err.Error()
-			}
-			result = TruncateToolResult(result, maxChars)
-			lastToolResult = result
-			messages = append(messages, providers.Message{Role: "tool", Content: result, ToolCallID: tc.ID})
-		}
+// saveTurn adds a run's turn (the input, the tool calls and their results) and the reply as
+// sent to s, and saves it. Every run that keeps a session saves it this way. An empty reply
+// is not added.
+func (a *AgentLoop) saveTurn(s *session.Session, res RunResult, reply string) {
+	s.Append(res.Turn...)
+	if reply != "" {
+		s.AddMessage("assistant", reply)
 	}
-
-	childSession.AddMessage("user", task)
-	childSession.AddMessage("assistant", lastToolResult)
-	_ = a.sessions.Save(childSession)
-	if lastToolResult != "" {
-		return lastToolResult, nil
+	if err := a.sessions.Save(s); err != nil {
+		log.Printf("error saving session %s: %v", s.Key, err)
 	}
-	return "Max iterations reached without final response", nil
 }
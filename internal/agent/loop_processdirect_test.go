@@ -2,12 +2,14 @@ package agent
 
 import (
 	"context"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/local/picobot/internal/chat"
 	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/session"
 )
 
 // provider that issues a write_memory tool call on first Chat, and returns a final reply on second
@@ -15,7 +17,7 @@ type writeMemoryCallingProvider struct {
 	calls int
 }
 
-func (p *writeMemoryCallingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+func (p *writeMemoryCallingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
 	p.calls++
 	// verify tools include write_memory
 	found := false
@@ -41,7 +43,7 @@ func (p *writeMemoryCallingProvider) GetDefaultModel() string { return "test" }
 func TestProcessDirectExecutesToolCall(t *testing.T) {
 	b := chat.NewHub(10)
 	prov := &writeMemoryCallingProvider{}
-	ag := NewAgentLoop(b, prov, prov.GetDefaultModel(), 5, "", nil)
+	ag := NewAgentLoop(b, prov, prov.GetDefaultModel(), 5, t.TempDir(), nil)
 
 	resp, err := ag.ProcessDirect("please remember Test note", 2*time.Second)
 	if err != nil {
@@ -63,3 +65,31 @@ func TestProcessDirectExecutesToolCall(t *testing.T) {
 }
 
 func contains(s, sub string) bool { return strings.Contains(s, sub) }
+
+// TestProcessDirectSharesSessionStore runs two agents on one SQLite store, as the gateway
+// and "picobot agent" would: the second sees the conversation the first saved.
+func TestProcessDirectSharesSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	for _, input := range []string{"my name is Ada", "what is my name?"} {
+		st, err := session.OpenSQLiteStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ag := NewAgentLoop(chat.NewHub(10), &inputRecordingProvider{}, "main-model", 3, t.TempDir(), nil)
+		ag.SetSessionStore(st)
+		if _, err := ag.ProcessDirect(input, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		st.Close()
+	}
+
+	st, err := session.OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	h := session.NewSessionManagerWithStore(st).GetOrCreate("cli:direct").GetHistory()
+	if len(h) != 4 || h[0].Content != "my name is Ada" || h[2].Content != "what is my name?" || h[3].Content != "ok" {
+		t.Fatalf("unexpected cli:direct history %+v", h)
+	}
+}
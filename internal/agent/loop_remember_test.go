@@ -14,7 +14,7 @@ import (
 // Provider that fails the test if called (ensures remember shortcut skips provider)
 type FailingProvider struct{}
 
-func (f *FailingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+func (f *FailingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
 	panic("Chat should not be called when handling remember messages")
 }
 func (f *FailingProvider) GetDefaultModel() string { return "fail" }
@@ -22,7 +22,7 @@ func (f *FailingProvider) GetDefaultModel() string { return "fail" }
 func TestAgentRemembersToday(t *testing.T) {
 	b := chat.NewHub(10)
 	p := &FailingProvider{}
-	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, "", nil)
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, t.TempDir(), nil)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
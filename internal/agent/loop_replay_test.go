@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// TestProcessDirectReplaysRecordedSession records a tool-calling exchange with a fake
+// provider and replays it without the provider, as a regression test would.
+func TestProcessDirectReplaysRecordedSession(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "session.json")
+
+	rec, err := providers.NewReplayProvider(cassette, providers.ReplayRecord, &FakeProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ag := NewAgentLoop(chat.NewHub(10), rec, "fake", 3, t.TempDir(), nil)
+	want, err := ag.ProcessDirect("trigger", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	play, err := providers.NewReplayProvider(cassette, providers.ReplayPlayback, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ag = NewAgentLoop(chat.NewHub(10), play, "fake", 3, t.TempDir(), nil)
+	got, err := ag.ProcessDirect("trigger", time.Second)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if got != want || got != "All done!" {
+		t.Fatalf("replayed reply = %q, recorded %q", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// streamingProvider streams a fixed reply in two fragments.
+type streamingProvider struct{}
+
+func (p *streamingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	return providers.LLMResponse{Content: "Hello world"}, nil
+}
+
+func (p *streamingProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions, onDelta func(string)) (providers.LLMResponse, error) {
+	onDelta("Hello")
+	onDelta(" world")
+	return providers.LLMResponse{Content: "Hello world"}, nil
+}
+
+func (p *streamingProvider) GetDefaultModel() string { return "stream" }
+
+func TestAgentStreamsPartialReplies(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &streamingProvider{}
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	b.In <- chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "c", Content: "hi"}
+
+	var partial *chat.Outbound
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case out := <-b.Out:
+			if out.Partial {
+				if partial == nil {
+					partial = &out
+				}
+				continue
+			}
+			if partial == nil {
+				t.Fatal("expected a partial update before the final message")
+			}
+			if partial.Content != "Hello" {
+				t.Errorf("partial content = %q, want %q", partial.Content, "Hello")
+			}
+			if out.Content != "Hello world" || out.StreamID == "" || out.StreamID != partial.StreamID {
+				t.Fatalf("unexpected final message %+v (partial stream %q)", out, partial.StreamID)
+			}
+			return
+		case <-deadline:
+			t.Fatal("timeout waiting for final outbound message")
+		}
+	}
+}
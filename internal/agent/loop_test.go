@@ -34,7 +34,7 @@ func TestProcessDirectWithStub(t *testing.T) {
 	b := chat.NewHub(10)
 	p := providers.NewStubProvider()
 
-	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, "", nil)
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, t.TempDir(), nil)
 
 	resp, err := ag.ProcessDirect("hello", 1*time.Second)
 	if err != nil {
@@ -48,7 +48,7 @@ func TestProcessDirectWithStub(t *testing.T) {
 func TestRunSubagentWithStub(t *testing.T) {
 	b := chat.NewHub(10)
 	p := providers.NewStubProvider()
-	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, "", nil)
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, t.TempDir(), nil)
 
 	ctx := context.Background()
 	resp, err := ag.RunSubagent(ctx, "subagent:test-123", "what is 2+2?", 5*time.Second, "discord", "456")
@@ -59,3 +59,132 @@ func TestRunSubagentWithStub(t *testing.T) {
 		t.Errorf("expected stub to echo task, got %q", resp)
 	}
 }
+
+// modelRecordingProvider records the model requested on each call.
+type modelRecordingProvider struct {
+	models []string
+}
+
+func (p *modelRecordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	p.models = append(p.models, model)
+	return providers.LLMResponse{Content: "ok"}, nil
+}
+func (p *modelRecordingProvider) GetDefaultModel() string { return "main-model" }
+
+func TestRunSubagentUsesSubagentModel(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &modelRecordingProvider{}
+	ag := NewAgentLoop(b, p, "main-model", 5, t.TempDir(), nil)
+	ag.SetModelRoutes(ModelRoutes{Subagent: "cheap-model"})
+
+	if _, err := ag.RunSubagent(context.Background(), "subagent:x", "task", 5*time.Second, "discord", "1"); err != nil {
+		t.Fatalf("RunSubagent: %v", err)
+	}
+	if _, err := ag.ProcessDirect("hello", time.Second); err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if len(p.models) != 2 || p.models[0] != "cheap-model" || p.models[1] != "main-model" {
+		t.Fatalf("expected [cheap-model main-model], got %v", p.models)
+	}
+}
+
+// emptyReplyProvider answers every call with nothing.
+type emptyReplyProvider struct{}
+
+func (emptyReplyProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	return providers.LLMResponse{}, nil
+}
+func (emptyReplyProvider) GetDefaultModel() string { return "empty" }
+
+func TestRunSubagentSavesTurnWithoutReply(t *testing.T) {
+	ag := NewAgentLoop(chat.NewHub(10), emptyReplyProvider{}, "empty", 5, t.TempDir(), nil)
+	if _, err := ag.RunSubagent(context.Background(), "subagent:quiet", "say nothing", 5*time.Second, "discord", "1"); err != nil {
+		t.Fatalf("RunSubagent: %v", err)
+	}
+	msgs := ag.sessions.GetOrCreate("subagent:quiet").Messages
+	if len(msgs) != 1 || msgs[0].Role != "user" || msgs[0].Content != "say nothing" {
+		t.Fatalf("expected the task to be kept, got %+v", msgs)
+	}
+}
+
+// lastRequestProvider records the last request it received.
+type lastRequestProvider struct {
+	messages []providers.Message
+	tools    []providers.ToolDefinition
+}
+
+func (p *lastRequestProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	p.messages, p.tools = messages, tools
+	return providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *lastRequestProvider) GetDefaultModel() string { return "llama3:8b" }
+
+func TestRunDropsImagesAndToolsForIncapableModel(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &lastRequestProvider{}
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	b.In <- chat.Inbound{Channel: "discord", SenderID: "u", ChatID: "c", Content: "what is this?", Media: []string{"data:image/png;base64,AAAA"}}
+	select {
+	case <-b.Out:
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for reply")
+	}
+
+	last := p.messages[len(p.messages)-1]
+	text, ok := last.Content.(string)
+	if !ok {
+		t.Fatalf("expected text-only user content for a non-vision model, got %T", last.Content)
+	}
+	if !strings.Contains(text, "1 image(s) attached but not shown") {
+		t.Errorf("expected a note about the dropped image, got %q", text)
+	}
+	if p.tools != nil {
+		t.Errorf("expected no tools for a model without tool support, got %d", len(p.tools))
+	}
+}
+
+// optsRecordingProvider records the generation options of each call.
+type optsRecordingProvider struct {
+	opts []providers.GenerationOptions
+}
+
+func (p *optsRecordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	p.opts = append(p.opts, opts)
+	return providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *optsRecordingProvider) GetDefaultModel() string { return "gpt-3.5-turbo" }
+
+func TestGenerationOptionsAreClampedToModel(t *testing.T) {
+	p := &optsRecordingProvider{}
+	ag := NewAgentLoop(chat.NewHub(10), p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+	temp := 0.7
+	ag.SetGenerationOptions(providers.GenerationOptions{MaxTokens: 8192, Temperature: &temp})
+
+	if _, err := ag.ProcessDirect("hello", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.opts) != 1 {
+		t.Fatalf("expected one call, got %d", len(p.opts))
+	}
+	got := p.opts[0]
+	if got.MaxTokens != 4096 {
+		t.Errorf("MaxTokens = %d, want 4096 (gpt-3.5-turbo limit)", got.MaxTokens)
+	}
+	if got.Temperature == nil || *got.Temperature != 0.7 {
+		t.Errorf("Temperature = %v, want 0.7", got.Temperature)
+	}
+	if c := ag.runner.compactionOptions(ag.model); c.Temperature == nil || *c.Temperature != 0 {
+		t.Errorf("compaction should use temperature 0, got %v", c.Temperature)
+	}
+	ag.SetGenerationOptions(providers.GenerationOptions{MaxTokens: 8192})
+	if c := ag.runner.compactionOptions(ag.model); c.Temperature != nil {
+		t.Errorf("compaction should keep the provider's temperature when none is configured, got %v", *c.Temperature)
+	}
+}
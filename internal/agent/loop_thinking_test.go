@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// reasoningProvider reasons before a tool call, then answers; it records what it was sent.
+type reasoningProvider struct {
+	calls [][]providers.Message
+}
+
+func (p *reasoningProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	p.calls = append(p.calls, messages)
+	if len(p.calls)%2 == 1 {
+		return providers.LLMResponse{
+			HasToolCalls:     true,
+			ToolCalls:        []providers.ToolCall{{ID: "1", Name: "list_skills", Arguments: map[string]interface{}{}}},
+			Reasoning:        "Check the skills first.",
+			ReasoningDetails: []map[string]interface{}{{"type": "thinking", "thinking": "Check the skills first.", "signature": "sig"}},
+		}, nil
+	}
+	return providers.LLMResponse{Content: "No skills yet.", Reasoning: "Nothing installed."}, nil
+}
+func (p *reasoningProvider) GetDefaultModel() string { return "reasoner" }
+
+func TestThinkingToggleShowsReasoning(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &reasoningProvider{}
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, t.TempDir(), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	send := func(content string) chat.Outbound {
+		b.In <- chat.Inbound{Channel: "cli", SenderID: "user", ChatID: "one", Content: content}
+		for {
+			select {
+			case out := <-b.Out:
+				if !out.Partial {
+					return out
+				}
+			case <-ctx.Done():
+				t.Fatalf("timeout waiting for reply to %q", content)
+			}
+		}
+	}
+
+	if out := send("any skills?"); out.Content != "No skills yet." || out.Thinking != "" {
+		t.Fatalf("thinking must be hidden by default, got %+v", out)
+	}
+	// the reasoning stays on the in-flight assistant message for the follow-up call
+	if msgs := p.calls[1]; msgs[len(msgs)-2].ReasoningDetails == nil {
+		t.Fatalf("expected reasoning details on the assistant tool call message, got %+v", msgs[len(msgs)-2])
+	}
+
+	if out := send("/thinking on"); out.Content == "" || len(p.calls) != 2 {
+		t.Fatalf("expected the command to be answered without the model, got %+v", out)
+	}
+	out := send("any skills?")
+	if out.Thinking != "Check the skills first.\n\nNothing installed." {
+		t.Fatalf("unexpected thinking %q", out.Thinking)
+	}
+	// two turns of user, tool call, tool result and reply; no command
+	if h := ag.sessions.GetOrCreate("cli:one").GetHistory(); len(h) != 8 {
+		t.Fatalf("the command must not be kept in history, got %q", h)
+	}
+
+	send("/thinking off")
+	if out := send("any skills?"); out.Thinking != "" {
+		t.Fatalf("expected thinking hidden after /thinking off, got %q", out.Thinking)
+	}
+}
+
+func TestThinkingCommand(t *testing.T) {
+	show := false
+	if thinkingCommand("ON", &show); !show {
+		t.Fatal("expected /thinking on to enable")
+	}
+	if reply := thinkingCommand("", &show); !show || reply == "" {
+		t.Fatalf("bare /thinking must only report, got %q show=%v", reply, show)
+	}
+	if thinkingCommand("off", &show); show {
+		t.Fatal("expected /thinking off to disable")
+	}
+	if reply := thinkingCommand("about it", &show); show || reply != "Send /thinking on or /thinking off." {
+		t.Fatalf("other arguments must only explain the command, got %q show=%v", reply, show)
+	}
+}
@@ -14,7 +14,7 @@ type FakeProvider struct {
 	count int
 }
 
-func (f *FakeProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+func (f *FakeProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
 	f.count++
 	if f.count == 1 {
 		// request message tool
@@ -31,7 +31,7 @@ func (f *FakeProvider) GetDefaultModel() string { return "fake" }
 func TestAgentExecutesToolCall(t *testing.T) {
 	b := chat.NewHub(10)
 	p := &FakeProvider{}
-	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 3, "", nil)
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 3, t.TempDir(), nil)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -59,3 +59,73 @@ func TestAgentExecutesToolCall(t *testing.T) {
 		}
 	}
 }
+
+// echoToolProvider asks the message tool to echo the user's message, then finishes.
+type echoToolProvider struct{}
+
+func (echoToolProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	last := messages[len(messages)-1]
+	if last.Role == "tool" {
+		return providers.LLMResponse{Content: "ok"}, nil
+	}
+	time.Sleep(20 * time.Millisecond) // let the other chat's run start
+	return providers.LLMResponse{
+		HasToolCalls: true,
+		ToolCalls:    []providers.ToolCall{{ID: "1", Name: "message", Arguments: map[string]interface{}{"content": "echo " + last.Content.(string)}}},
+	}, nil
+}
+func (echoToolProvider) GetDefaultModel() string { return "echo" }
+
+func TestConcurrentRunsSendToolMessagesToTheirOwnChat(t *testing.T) {
+	b := chat.NewHub(20)
+	ag := NewAgentLoop(b, echoToolProvider{}, "echo", 3, t.TempDir(), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	b.In <- chat.Inbound{Channel: "cli", ChatID: "a", Content: "a"}
+	b.In <- chat.Inbound{Channel: "cli", ChatID: "b", Content: "b"}
+	// two tool messages and two final replies
+	for seen, done := 0, 0; seen < 2 || done < 2; {
+		select {
+		case out := <-b.Out:
+			if out.Content == "ok" {
+				done++
+				continue
+			}
+			if out.Content != "echo "+out.ChatID {
+				t.Fatalf("message %q was sent to chat %q", out.Content, out.ChatID)
+			}
+			seen++
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for tool messages")
+		}
+	}
+}
+
+func TestNextTurnSeesPreviousToolCalls(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &reasoningProvider{}
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, t.TempDir(), nil)
+	startCommandLoop(t, ag)
+
+	for i := 0; i < 2; i++ {
+		b.In <- chat.Inbound{Channel: "test", ChatID: "a", Content: "any skills?"}
+		nextOut(t, b)
+	}
+
+	// the second turn's first call replays the first turn: call, result and reply
+	msgs := p.calls[2]
+	n := len(msgs)
+	call, result, reply := msgs[n-4], msgs[n-3], msgs[n-2]
+	if len(call.ToolCalls) != 1 || call.ToolCalls[0].Name != "list_skills" || call.ReasoningDetails != nil {
+		t.Fatalf("expected the earlier tool call without its reasoning, got %+v", call)
+	}
+	if result.Role != "tool" || result.ToolCallID != "1" || result.Content != "No skills found" {
+		t.Fatalf("expected the earlier tool result, got %+v", result)
+	}
+	if reply.Role != "assistant" || reply.Content != "No skills yet." {
+		t.Fatalf("expected the earlier reply, got %+v", reply)
+	}
+}
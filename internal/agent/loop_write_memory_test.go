@@ -17,7 +17,7 @@ type toolCallingProvider struct {
 	calls int
 }
 
-func (p *toolCallingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+func (p *toolCallingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
 	p.calls++
 	if p.calls == 1 {
 		// instruct a write_memory call
@@ -32,10 +32,10 @@ func (p *toolCallingProvider) GetDefaultModel() string { return "fake-model" }
 func TestAgentExecutesWriteMemoryToolCall(t *testing.T) {
 	b := chat.NewHub(10)
 	p := &toolCallingProvider{}
-	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, "", nil)
+	tmp := t.TempDir()
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 5, tmp, nil)
 
 	// replace memory with temp workspace and re-register write_memory tool
-	tmp := t.TempDir()
 	m := memory.NewMemoryStoreWithWorkspace(tmp, 100)
 	ag.memory = m
 	ag.tools.Register(tools.NewWriteMemoryTool(m))
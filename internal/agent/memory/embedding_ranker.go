@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/usage"
+)
+
+// embedTimeout bounds one ranking's embedding call, so a slow server delays a reply only so long.
+const embedTimeout = 30 * time.Second
+
+// EmbeddingRanker ranks memories by the cosine similarity of their embeddings to the query's.
+// With a cached embedder only the query and new memories are embedded. It falls back to a
+// SimpleRanker if embedding fails.
+type EmbeddingRanker struct {
+	embedder providers.Embedder
+	model    string
+	fallback *SimpleRanker
+}
+
+// NewEmbeddingRanker constructs an EmbeddingRanker using the given embedder and model.
+func NewEmbeddingRanker(e providers.Embedder, model string) *EmbeddingRanker {
+	return &EmbeddingRanker{embedder: e, model: model, fallback: NewSimpleRanker()}
+}
+
+func (r *EmbeddingRanker) Rank(query string, memories []MemoryItem, top int) []MemoryItem {
+	if len(memories) == 0 || top <= 0 {
+		return nil
+	}
+	if top > len(memories) {
+		top = len(memories)
+	}
+	texts := make([]string, 0, len(memories)+1)
+	texts = append(texts, query)
+	for _, m := range memories {
+		texts = append(texts, m.Text)
+	}
+	ctx, cancel := context.WithTimeout(usage.WithPurpose(context.Background(), usage.PurposeRanking), embedTimeout)
+	defer cancel()
+	vecs, err := r.embedder.Embed(ctx, texts, r.model)
+	if err != nil || len(vecs) != len(texts) {
+		log.Printf("EmbeddingRanker: %v; ranking by keywords", err)
+		return r.fallback.Rank(query, memories, top)
+	}
+
+	type scored struct {
+		m     MemoryItem
+		score float32
+		idx   int
+	}
+	scores := make([]scored, len(memories))
+	for i, m := range memories {
+		scores[i] = scored{m: m, score: providers.Cosine(vecs[0], vecs[i+1]), idx: i}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].score != scores[j].score {
+			return scores[i].score > scores[j].score
+		}
+		// tiebreaker: more recent (higher index => newer)
+		return scores[i].idx > scores[j].idx
+	})
+	out := make([]MemoryItem, 0, top)
+	for _, s := range scores[:top] {
+		out = append(out, s.m)
+	}
+	return out
+}
@@ -0,0 +1,33 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+type failingEmbedder struct{}
+
+func (failingEmbedder) Embed(context.Context, []string, string) ([][]float32, error) {
+	return nil, errors.New("no embeddings here")
+}
+
+func TestEmbeddingRankerRanksBySimilarity(t *testing.T) {
+	mems := []MemoryItem{
+		{Kind: "long", Text: "call mom tomorrow"},
+		{Kind: "short", Text: "the cat likes tuna and cream"},
+		{Kind: "short", Text: "dentist appointment on friday"},
+	}
+	res := NewEmbeddingRanker(providers.NewHashEmbedder(256), "hash").Rank("what does the cat like", mems, 2)
+	if len(res) != 2 || res[0].Text != "the cat likes tuna and cream" {
+		t.Fatalf("unexpected ranking %+v", res)
+	}
+
+	// without embeddings it ranks by keywords
+	res = NewEmbeddingRanker(failingEmbedder{}, "none").Rank("dentist", mems, 1)
+	if len(res) != 1 || res[0].Text != "dentist appointment on friday" {
+		t.Fatalf("unexpected fallback ranking %+v", res)
+	}
+}
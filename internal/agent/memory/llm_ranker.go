@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/usage"
 )
 
 // LLMMemoryRanker uses an LLM provider to rank memories relative to a query.
@@ -15,6 +16,7 @@ import (
 type LLMMemoryRanker struct {
 	provider providers.LLMProvider
 	model    string
+	opts     providers.GenerationOptions
 	fallback *SimpleRanker
 	logger   *log.Logger // optional per-instance logger for diagnostics
 }
@@ -29,7 +31,14 @@ func NewLLMRankerWithLogger(provider providers.LLMProvider, model string, logger
 	if model == "" && provider != nil {
 		model = provider.GetDefaultModel()
 	}
-	return &LLMMemoryRanker{provider: provider, model: model, fallback: NewSimpleRanker(), logger: logger}
+	zero := 0.0
+	opts := providers.GenerationOptions{Temperature: &zero} // rankings should be repeatable
+	return &LLMMemoryRanker{provider: provider, model: model, opts: opts, fallback: NewSimpleRanker(), logger: logger}
+}
+
+// SetGenerationOptions replaces the options sent with ranking requests (default: temperature 0).
+func (r *LLMMemoryRanker) SetGenerationOptions(o providers.GenerationOptions) {
+	r.opts = o
 }
 
 // logf logs using the instance logger if present, else falls back to package log.
@@ -52,106 +61,35 @@ func (r *LLMMemoryRanker) Rank(query string, memories []MemoryItem, top int) []M
 		return r.fallback.Rank(query, memories, top)
 	}
 
-	// Build a simple prompt listing memories with indices and expose a 'rank_memories' tool.
+	// Build a simple prompt listing memories with indices; the reply is structured output.
 	var sb strings.Builder
-	sb.WriteString("You are a ranking assistant. Given the query and a list of memories numbered 0..N-1, return only an ordered list of indices (most relevant first). Respond either by calling the tool 'rank_memories' with argument {\"indices\": [i, j, ...]} or by returning a JSON array like [i,j,...] in the assistant content. Do not return other text around the array; if you must, ensure the array appears in full (e.g. 'Result: [1,0]')." + "\n\n")
+	sb.WriteString("You are a ranking assistant. Given the query and a list of memories numbered 0..N-1, return the indices of the memories ordered by relevance (most relevant first) as JSON: {\"indices\": [i, j, ...]}." + "\n\n")
 	sb.WriteString("Query: " + query + "\n\n")
 	sb.WriteString("Memories (index: text):\n")
 	for i, m := range memories {
 		sb.WriteString(fmt.Sprintf("%d: %s\n", i, m.Text))
 	}
 
-	messages := []providers.Message{{Role: "system", Content: sb.String()}, {Role: "user", Content: "Return an ordered list of indices ranked by relevance, or call the 'rank_memories' tool."}}
+	messages := []providers.Message{{Role: "system", Content: sb.String()}, {Role: "user", Content: "Return the indices ranked by relevance."}}
 
-	// expose a tool definition to allow function-call style responses from providers
-	rankTool := providers.ToolDefinition{
-		Name:        "rank_memories",
-		Description: "Return ranking indices for memories",
-		Parameters: map[string]interface{}{
-			"type":     "object",
-			"required": []string{"indices"},
-			"properties": map[string]interface{}{
-				"indices": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "number"}},
-			},
-		},
-	}
 	// diagnostic log
 	r.logf("LLMMemoryRanker: sending ranking request for query=%q with %d memories", query, len(memories))
-	resp, err := r.provider.Chat(context.Background(), messages, []providers.ToolDefinition{rankTool}, r.model)
-	if err != nil {
-		r.logf("LLMMemoryRanker provider error: %v", err)
-		return r.fallback.Rank(query, memories, top)
-	}
+	res := rankResult{n: len(memories)}
+	resp, err := providers.ChatJSON(usage.WithPurpose(context.Background(), usage.PurposeRanking), r.provider, messages, r.model, r.opts, &res)
 	// log response summary
 	if resp.HasToolCalls {
 		r.logf("LLMMemoryRanker: provider returned %d tool calls", len(resp.ToolCalls))
-	} else {
+	} else if resp.Content != "" {
 		r.logf("LLMMemoryRanker: provider returned content=%q", strings.TrimSpace(resp.Content))
 	}
-
-	// Prefer function call results (ToolCalls) if present
-	if resp.HasToolCalls && len(resp.ToolCalls) > 0 {
-		for _, tc := range resp.ToolCalls {
-			if tc.Name != "rank_memories" {
-				continue
-			}
-			// expected argument: indices: [int]
-			if raw, ok := tc.Arguments["indices"]; ok {
-				if idxs, err := parseIndicesFromArgs(raw); err == nil {
-					out := make([]MemoryItem, 0, top)
-					seen := make(map[int]struct{})
-					for _, idx := range idxs {
-						if idx < 0 || idx >= len(memories) {
-							continue
-						}
-						if _, ok := seen[idx]; ok {
-							continue
-						}
-						out = append(out, memories[idx])
-						seen[idx] = struct{}{}
-						if len(out) >= top {
-							break
-						}
-					}
-					// pad if needed
-					if len(out) < top {
-						fallback := r.fallback.Rank(query, memories, len(memories))
-						for _, m := range fallback {
-							if len(out) >= top {
-								break
-							}
-							skip := false
-							for _, s := range out {
-								if s.Text == m.Text && s.Kind == m.Kind {
-									skip = true
-									break
-								}
-							}
-							if !skip {
-								out = append(out, m)
-							}
-						}
-					}
-					return out
-				}
-			}
-		}
-	}
-
-	// Attempt to parse JSON array of ints from resp.Content as a fallback
-	var idxs []int
-	body := strings.TrimSpace(resp.Content)
-	if err := json.Unmarshal([]byte(body), &idxs); err != nil {
-		// try to be forgiving: extract digits from content
-		if err2 := parseIndicesFromText(body, &idxs); err2 != nil {
-			r.logf("LLMMemoryRanker parse error: %v (content=%q)", err2, body)
-			return r.fallback.Rank(query, memories, top)
-		}
+	if err != nil {
+		r.logf("LLMMemoryRanker provider error: %v", err)
+		return r.fallback.Rank(query, memories, top)
 	}
 
 	out := make([]MemoryItem, 0, top)
 	seen := make(map[int]struct{})
-	for _, idx := range idxs {
+	for _, idx := range res.Indices {
 		if idx < 0 || idx >= len(memories) {
 			continue
 		}
@@ -187,48 +125,38 @@ func (r *LLMMemoryRanker) Rank(query string, memories []MemoryItem, top int) []M
 	return out
 }
 
-// parseIndicesFromText attempts to extract a JSON-like array of ints from arbitrary text.
-func parseIndicesFromText(s string, out *[]int) error {
-	// find the first [ ... ] substring
-	start := strings.Index(s, "[")
-	end := strings.LastIndex(s, "]")
-	if start == -1 || end == -1 || start >= end {
-		return ErrNoIndicesFound
-	}
-	sub := s[start : end+1]
-	return json.Unmarshal([]byte(sub), out)
+// rankResult is the structured reply to a ranking request.
+type rankResult struct {
+	Indices []int `json:"indices" desc:"memory indices, most relevant first"`
+	n       int   // number of memories ranked
 }
 
-// parseIndicesFromArgs parses an arguments value that may be []int, []float64 or []interface{} and returns []int.
-func parseIndicesFromArgs(v interface{}) ([]int, error) {
-	switch t := v.(type) {
-	case []int:
-		return t, nil
-	case []float64:
-		out := make([]int, len(t))
-		for i, f := range t {
-			out[i] = int(f)
-		}
-		return out, nil
-	case []interface{}:
-		out := make([]int, 0, len(t))
-		for _, it := range t {
-			switch x := it.(type) {
-			case float64:
-				out = append(out, int(x))
-			case int:
-				out = append(out, x)
-			case int64:
-				out = append(out, int(x))
-			default:
-				// ignore non-numeric
-			}
+// UnmarshalJSON also accepts a bare array of indices, which some models return.
+// Fractional indices (e.g. 1.0) are truncated.
+func (r *rankResult) UnmarshalJSON(b []byte) error {
+	var obj struct {
+		Indices []float64 `json:"indices"`
+	}
+	var arr []float64
+	if err := json.Unmarshal(b, &arr); err != nil {
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return err
 		}
-		if len(out) == 0 {
-			return nil, ErrNoIndicesFound
+		arr = obj.Indices
+	}
+	r.Indices = make([]int, len(arr))
+	for i, f := range arr {
+		r.Indices[i] = int(f)
+	}
+	return nil
+}
+
+// Validate requires at least one index that refers to a memory.
+func (r *rankResult) Validate() error {
+	for _, idx := range r.Indices {
+		if idx >= 0 && idx < r.n {
+			return nil
 		}
-		return out, nil
-	default:
-		return nil, ErrNoIndicesFound
 	}
+	return fmt.Errorf("%w: expected indices between 0 and %d", ErrNoIndicesFound, r.n-1)
 }
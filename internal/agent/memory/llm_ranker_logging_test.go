@@ -14,7 +14,7 @@ type loggingFakeProvider struct {
 	resp string
 }
 
-func (f *loggingFakeProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+func (f *loggingFakeProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
 	return providers.LLMResponse{Content: f.resp, HasToolCalls: false}, nil
 }
 func (f *loggingFakeProvider) GetDefaultModel() string { return "m" }
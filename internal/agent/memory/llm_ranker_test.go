@@ -13,7 +13,7 @@ type fakeProvider struct {
 	calls []providers.ToolCall
 }
 
-func (f *fakeProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+func (f *fakeProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
 	if len(f.calls) > 0 {
 		return providers.LLMResponse{Content: "", HasToolCalls: true, ToolCalls: f.calls}, nil
 	}
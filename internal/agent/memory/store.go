@@ -53,6 +53,15 @@ func NewMemoryStoreWithWorkspace(workspace string, limit int) *MemoryStore {
 	return ms
 }
 
+// NewMemoryStoreWithNamespace creates a MemoryStore backed by files under
+// workspace/memory/<namespace>/, kept apart from the shared workspace memory.
+func NewMemoryStoreWithNamespace(workspace, namespace string, limit int) *MemoryStore {
+	ms := NewMemoryStoreWithWorkspace(workspace, limit)
+	ms.memoryDir = filepath.Join(ms.memoryDir, namespace)
+	_ = os.MkdirAll(ms.memoryDir, 0o755)
+	return ms
+}
+
 // AddShort adds a short-term memory entry.
 func (s *MemoryStore) AddShort(text string) {
 	s.mu.Lock()
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/local/picobot/internal/agent/memory"
+	"github.com/local/picobot/internal/agent/tools"
+)
+
+// Profile is a named agent setup: its own bootstrap files, model, tools, skills and memory.
+// Zero fields keep the defaults of the AgentLoop.
+type Profile struct {
+	Name string
+	// BootstrapDir holds the profile's SOUL.md, AGENTS.md, USER.md and TOOLS.md; relative
+	// paths are inside the workspace. Empty means the workspace itself.
+	BootstrapDir string
+	Model        string
+	Tools        []string // names of the tools the profile may use; nil means all
+	Skills       []string // names of the skills in its prompt, commands and skill tools; nil means all
+	// Memory is the memory namespace, kept under memory/<name>/ in the workspace. Empty
+	// means the shared workspace memory.
+	Memory string
+}
+
+// ProfileRoute sends the messages it matches to a profile. Empty fields match anything.
+type ProfileRoute struct {
+	Profile  string
+	Channel  string
+	ChatID   string
+	SenderID string
+}
+
+func (r ProfileRoute) matches(channel, chatID, senderID string) bool {
+	return (r.Channel == "" || r.Channel == channel) &&
+		(r.ChatID == "" || r.ChatID == chatID) &&
+		(r.SenderID == "" || r.SenderID == senderID)
+}
+
+// profile is a Profile ready to run.
+type profile struct {
+	Profile
+	context *ContextBuilder
+	memory  *memory.MemoryStore
+}
+
+// SetProfiles sets the agent profiles and the routes that pick one for each message. The
+// first matching route wins; messages no route matches use the default profile, which is
+// the workspace's bootstrap files, model, tools, skills and memory. Set them before Run.
+func (a *AgentLoop) SetProfiles(profiles []Profile, routes []ProfileRoute) error {
+	byName := make(map[string]*profile, len(profiles))
+	for _, p := range profiles {
+		if p.Name == "" {
+			return fmt.Errorf("profile without a name")
+		}
+		if _, ok := byName[p.Name]; ok {
+			return fmt.Errorf("profile %q is defined twice", p.Name)
+		}
+		if p.Memory != "" && (p.Memory != filepath.Base(p.Memory) || strings.HasPrefix(p.Memory, ".")) {
+			return fmt.Errorf("profile %q: memory namespace %q must be a plain name", p.Name, p.Memory)
+		}
+		rp := &profile{Profile: p, context: a.runner.Context, memory: a.memory}
+		if p.BootstrapDir != "" || p.Skills != nil {
+			dir := p.BootstrapDir
+			if dir != "" && !filepath.IsAbs(dir) {
+				dir = filepath.Join(a.workspace, dir)
+			}
+			rp.context = a.runner.Context.forProfile(dir, p.Skills)
+		}
+		if p.Memory != "" {
+			rp.memory = memory.NewMemoryStoreWithNamespace(a.workspace, p.Memory, 100)
+		}
+		byName[p.Name] = rp
+	}
+	for _, r := range routes {
+		if _, ok := byName[r.Profile]; !ok {
+			return fmt.Errorf("route to unknown profile %q", r.Profile)
+		}
+	}
+	a.profiles, a.profileRoutes = byName, routes
+	return nil
+}
+
+// profileFor returns the profile that handles a message, or the default profile.
+func (a *AgentLoop) profileFor(channel, chatID, senderID string) *profile {
+	for _, r := range a.profileRoutes {
+		if r.matches(channel, chatID, senderID) {
+			return a.profiles[r.Profile]
+		}
+	}
+	return &profile{context: a.runner.Context, memory: a.memory}
+}
+
+// modelFor returns the model p uses.
+func (a *AgentLoop) modelFor(p *profile) string {
+	if p.Model != "" {
+		return p.Model
+	}
+	return a.model
+}
+
+// runnerFor returns the runner for p's runs: the shared one, with p's context and memory.
+func (a *AgentLoop) runnerFor(p *profile) *Runner {
+	r := *a.runner
+	r.Context, r.Memory = p.context, p.memory
+	return &r
+}
+
+// toolsFor returns the tools p may use. write_memory writes to p's memory, and the skill
+// tools only see p's skills.
+func (a *AgentLoop) toolsFor(p *profile) *tools.Registry {
+	if p.Tools == nil && p.memory == a.memory && p.Skills == nil {
+		return a.tools
+	}
+	allowed := map[string]bool{}
+	for _, name := range p.Tools {
+		allowed[name] = true
+	}
+	reg := a.tools.Filter(func(name string) bool { return p.Tools == nil || allowed[name] })
+	if reg.Get("write_memory") != nil {
+		reg.Register(tools.NewWriteMemoryTool(p.memory))
+	}
+	if p.Skills != nil {
+		sm := a.skills.Only(p.Skills)
+		for _, t := range []tools.Tool{tools.NewCreateSkillTool(sm), tools.NewListSkillsTool(sm), tools.NewReadSkillTool(sm), tools.NewDeleteSkillTool(sm)} {
+			if reg.Get(t.Name()) != nil {
+				reg.Register(t)
+			}
+		}
+	}
+	return reg
+}
+
+// skillAllowed reports whether p includes the skill called name.
+func (p *profile) skillAllowed(name string) bool {
+	if p.Skills == nil {
+		return true
+	}
+	for _, s := range p.Skills {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// callRecordingProvider records the model, system prompt and tool names of the last call.
+type callRecordingProvider struct {
+	model  string
+	system string
+	tools  []string
+}
+
+func (p *callRecordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	p.model, p.system, p.tools = model, "", nil
+	for _, m := range messages {
+		if m.Role == "system" {
+			p.system += providers.ContentToString(m.Content) + "\n"
+		}
+	}
+	for _, t := range tools {
+		p.tools = append(p.tools, t.Name)
+	}
+	sort.Strings(p.tools)
+	return providers.LLMResponse{Content: "ok"}, nil
+}
+func (p *callRecordingProvider) GetDefaultModel() string { return "main-model" }
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfilesAreRoutedByChat(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "SOUL.md"), "Be warm and chatty.")
+	writeFile(t, filepath.Join(workspace, "profiles", "ops", "SOUL.md"), "Be terse.")
+	writeFile(t, filepath.Join(workspace, "skills", "deploy", "SKILL.md"), "---\nname: deploy\ndescription: Ship it\n---\n\nRun the deploy script.\n")
+	writeFile(t, filepath.Join(workspace, "skills", "recipes", "SKILL.md"), "---\nname: recipes\ndescription: Cook dinner\n---\n\nSuggest a recipe.\n")
+
+	b := chat.NewHub(10)
+	p := &callRecordingProvider{}
+	ag := NewAgentLoop(b, p, "main-model", 5, workspace, nil)
+	err := ag.SetProfiles(
+		[]Profile{{Name: "ops", BootstrapDir: "profiles/ops", Model: "ops-model", Tools: []string{"exec", "write_memory"}, Skills: []string{"deploy"}, Memory: "ops"}},
+		[]ProfileRoute{{Profile: "ops", Channel: "discord", ChatID: "d1"}},
+	)
+	if err != nil {
+		t.Fatalf("SetProfiles: %v", err)
+	}
+	startCommandLoop(t, ag)
+	send := func(channel, chatID, content string) {
+		t.Helper()
+		b.In <- chat.Inbound{Channel: channel, ChatID: chatID, SenderID: "u", Content: content}
+		nextOut(t, b)
+	}
+
+	send("discord", "d1", "status?")
+	if p.model != "ops-model" || !strings.Contains(p.system, "Be terse.") || strings.Contains(p.system, "chatty") {
+		t.Fatalf("expected the ops profile, got model %q and system prompt:\n%s", p.model, p.system)
+	}
+	if !strings.Contains(p.system, "## deploy") || strings.Contains(p.system, "## recipes") {
+		t.Fatalf("expected only the deploy skill in the prompt:\n%s", p.system)
+	}
+	if strings.Join(p.tools, ",") != "exec,write_memory" {
+		t.Fatalf("expected only the ops tools, got %v", p.tools)
+	}
+
+	send("discord", "d2", "what's for dinner?")
+	if p.model != "main-model" || !strings.Contains(p.system, "chatty") || !strings.Contains(p.system, "## recipes") || len(p.tools) < 5 {
+		t.Fatalf("expected the default profile in another chat, got model %q, tools %v", p.model, p.tools)
+	}
+
+	// memory is namespaced, including the write_memory tool
+	send("discord", "d1", "remember the db is on port 5433")
+	if _, err := ag.toolsFor(ag.profiles["ops"]).Execute(context.Background(), "write_memory", map[string]interface{}{"target": "long", "content": "deploys happen on Tuesdays"}); err != nil {
+		t.Fatalf("write_memory: %v", err)
+	}
+	ops := ag.profiles["ops"].memory
+	if today, _ := ops.ReadToday(); !strings.Contains(today, "port 5433") {
+		t.Fatalf("expected the note in the ops memory, got %q", today)
+	}
+	if long, _ := ops.ReadLongTerm(); !strings.Contains(long, "Tuesdays") {
+		t.Fatalf("expected write_memory to use the ops memory, got %q", long)
+	}
+	if today, _ := ag.memory.ReadToday(); today != "" {
+		t.Fatalf("the shared memory must stay empty, got %q", today)
+	}
+}
+
+func TestProfileSkillToolsSeeOnlyItsSkills(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "skills", "deploy", "SKILL.md"), "---\nname: deploy\ndescription: Ship it\n---\n\nRun the deploy script.\n")
+	writeFile(t, filepath.Join(workspace, "skills", "recipes", "SKILL.md"), "---\nname: recipes\ndescription: Cook dinner\n---\n\nSuggest a recipe.\n")
+	ag := NewAgentLoop(chat.NewHub(10), &callRecordingProvider{}, "main-model", 5, workspace, nil)
+	if err := ag.SetProfiles([]Profile{{Name: "ops", Skills: []string{"deploy"}}}, nil); err != nil {
+		t.Fatalf("SetProfiles: %v", err)
+	}
+	reg := ag.toolsFor(ag.profiles["ops"])
+	ctx := context.Background()
+
+	if got, err := reg.Get("read_skill").Execute(ctx, map[string]interface{}{"name": "deploy"}); err != nil || !strings.Contains(got, "Run the deploy script.") {
+		t.Fatalf("read_skill deploy: %q, %v", got, err)
+	}
+	if got, err := reg.Get("read_skill").Execute(ctx, map[string]interface{}{"name": "recipes"}); err == nil {
+		t.Fatalf("expected recipes to be hidden from the profile, read %q", got)
+	}
+	if got, err := reg.Get("list_skills").Execute(ctx, map[string]interface{}{}); err != nil || strings.Contains(got, "recipes") {
+		t.Fatalf("list_skills: %q, %v", got, err)
+	}
+	if _, err := reg.Get("delete_skill").Execute(ctx, map[string]interface{}{"name": "recipes"}); err == nil {
+		t.Fatal("expected the profile not to delete recipes")
+	}
+	if _, err := reg.Get("create_skill").Execute(ctx, map[string]interface{}{"name": "recipes", "description": "x", "content": "x"}); err == nil {
+		t.Fatal("expected the profile not to overwrite recipes")
+	}
+	// the default profile still sees every skill
+	if _, err := ag.tools.Get("read_skill").Execute(ctx, map[string]interface{}{"name": "recipes"}); err != nil {
+		t.Fatalf("read_skill recipes without a profile: %v", err)
+	}
+}
+
+func TestSubagentsKeepTheSendersProfile(t *testing.T) {
+	p := &callRecordingProvider{}
+	ag := NewAgentLoop(chat.NewHub(10), p, "main-model", 5, t.TempDir(), nil)
+	err := ag.SetProfiles(
+		[]Profile{{Name: "guest", Model: "guest-model", Tools: []string{"spawn", "web"}}},
+		[]ProfileRoute{{Profile: "guest", SenderID: "g1"}},
+	)
+	if err != nil {
+		t.Fatalf("SetProfiles: %v", err)
+	}
+
+	// the spawn tool passes on the context of the guest's run
+	ctx := tools.WithRunInfo(context.Background(), tools.RunInfo{Channel: "telegram", ChatID: "group", SenderID: "g1", SessionKey: "telegram:group"})
+	if _, err := ag.RunSubagent(ctx, "subagent:g", "run rm -rf /", 5*time.Second, "telegram", "group"); err != nil {
+		t.Fatalf("RunSubagent: %v", err)
+	}
+	if p.model != "guest-model" || strings.Join(p.tools, ",") != "spawn,web" {
+		t.Fatalf("expected the guest profile, got model %q and tools %v", p.model, p.tools)
+	}
+}
+
+func TestSetProfilesRejectsBadConfig(t *testing.T) {
+	ag := NewAgentLoop(chat.NewHub(1), &callRecordingProvider{}, "main-model", 5, t.TempDir(), nil)
+	if err := ag.SetProfiles(nil, []ProfileRoute{{Profile: "missing"}}); err == nil {
+		t.Error("expected an error for a route to an unknown profile")
+	}
+	if err := ag.SetProfiles([]Profile{{Name: "x", Memory: "../elsewhere"}}, nil); err == nil {
+		t.Error("expected an error for a memory namespace that is a path")
+	}
+	if err := ag.SetProfiles([]Profile{{Name: "x"}, {Name: "x"}}, nil); err == nil {
+		t.Error("expected an error for a duplicate profile")
+	}
+}
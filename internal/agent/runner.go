@@ -0,0 +1,275 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/local/picobot/internal/agent/memory"
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/providers"
+)
+
+// StopReason says why a run ended.
+type StopReason string
+
+const (
+	StopFinal         StopReason = "final"          // the model replied without tool calls
+	StopMaxIterations StopReason = "max_iterations" // the iteration limit was reached first
+	StopError         StopReason = "error"          // the provider or a BeforeChatHook failed; see RunResult.Err
+	StopCanceled      StopReason = "canceled"       // the run's context was canceled
+)
+
+// RunRequest is one agent run: a new user input on top of a session history.
+type RunRequest struct {
+	History       []providers.Message // session history, oldest first
+	Input         string              // the user's message or task
+	Media         []string            // image URLs or data URLs attached to Input
+	Channel       string              // channel and chat shown to the model in the system prompt
+	ChatID        string              //
+	Model         string              // model for every chat call of the run
+	Tools         *tools.Registry     // tools offered to the model; nil offers none
+	MaxIterations int                 // upper bound on model calls
+
+	stream *replyStream // streams partial replies to a chat (Run only)
+}
+
+// ToolTrace records one executed tool call.
+type ToolTrace struct {
+	Call   providers.ToolCall
+	Result string // as sent to the model: truncated, and "(tool error) ..." on failure
+	Err    error  // the tool's error, or the veto of a BeforeToolHook
+}
+
+// RunResult is the outcome of a run.
+type RunResult struct {
+	Content    string   // the model's final reply; empty if it gave none
+	Reasoning  []string // reasoning of each model call that returned some
+	Tools      []ToolTrace
+	Usage      providers.Usage // summed over the run's chat calls
+	Iterations int             // model calls made
+	Stop       StopReason
+	Err        error               // set when Stop is StopError or StopCanceled
+	Messages   []providers.Message // the conversation as last sent, plus the final reply
+	// Turn is what the run adds to the session history: the input, then each assistant
+	// message with tool calls followed by the results. The final reply is Content.
+	Turn []providers.Message
+}
+
+// Text returns the final reply, or the last tool result when the model gave no text.
+func (r RunResult) Text() string {
+	if r.Content != "" || len(r.Tools) == 0 {
+		return r.Content
+	}
+	return r.Tools[len(r.Tools)-1].Result
+}
+
+// Runner executes agent runs: it builds the prompt, calls the model, executes the tool calls it
+// asks for and loops until a final reply, compacting the history when it outgrows the context
+// window. Run, ProcessDirect and RunSubagent are all built on it.
+type Runner struct {
+	Provider        providers.LLMProvider
+	Context         *ContextBuilder
+	Memory          *memory.MemoryStore
+	Models          *providers.ModelRegistry    // model capabilities
+	Options         providers.GenerationOptions // clamped to each model's limits
+	CompactionModel string                      // model that summarizes history; "" means the run's model
+	Hooks           Hooks                       // called around model and tool calls; set before the first run
+}
+
+// Run performs one run. It never returns a partial result without a StopReason.
+func (r *Runner) Run(ctx context.Context, req RunRequest) RunResult {
+	run := tools.RunInfoFrom(ctx)
+	run.Provider, run.Model = r.Provider, req.Model
+	ctx = tools.WithRunInfo(ctx, run)
+	info := r.Models.Lookup(req.Model)
+	input, media := req.Input, req.Media
+	if len(media) > 0 && !info.Vision {
+		log.Printf("model %s does not support images; dropping %d attachment(s)", req.Model, len(media))
+		input += fmt.Sprintf("\n\n[%d image(s) attached but not shown: the current model cannot read images]", len(media))
+		media = nil
+	}
+	history := req.History
+	if !info.Vision {
+		history = withoutImages(history)
+	}
+	memCtx, memories := r.memoryContext()
+	messages := r.Context.BuildMessages(history, input, media, req.Channel, req.ChatID, memCtx, memories)
+
+	var toolDefs []providers.ToolDefinition
+	if req.Tools != nil && info.Tools {
+		toolDefs = req.Tools.Definitions()
+	}
+	opts := r.generationOptions(req.Model)
+	maxChars := CalculateMaxToolResultChars(info.ContextWindow)
+
+	var res RunResult
+	res.Turn = append(res.Turn, messages[len(messages)-1])
+	for res.Iterations < req.MaxIterations {
+		if err := ctx.Err(); err != nil {
+			res.Stop, res.Err = StopCanceled, err
+			break
+		}
+		res.Iterations++
+		messages, _ = CompactIfNeeded(ctx, messages, info.ContextWindow, r.Provider, r.compactionModel(req.Model), r.compactionOptions(req.Model))
+		call := ChatCall{Model: req.Model, Messages: messages, Tools: toolDefs, Options: opts}
+		if err := r.Hooks.beforeChat(ctx, &call); err != nil {
+			res.Stop, res.Err = StopError, err
+			break
+		}
+		resp, sent, err := r.chat(ctx, call.Messages, call.Tools, call.Model, call.Options, req.stream)
+		messages = sent
+		call.Messages = sent
+		r.Hooks.afterChat(ctx, call, &resp, err)
+		if err != nil {
+			res.Stop, res.Err = StopError, err
+			if ctx.Err() != nil {
+				res.Stop = StopCanceled
+			}
+			break
+		}
+		res.Usage = addUsage(res.Usage, resp.Usage)
+		if resp.Reasoning != "" {
+			res.Reasoning = append(res.Reasoning, resp.Reasoning)
+		}
+
+		if resp.HasToolCalls {
+			// Execute the tool calls (read-only ones in parallel) and return results with "tool" role, in call order
+			traces := r.executeTools(ctx, req.Tools, resp.ToolCalls, maxChars)
+			// keep the arguments as the hooks left them (masked, say), not as the model sent them
+			msg := assistantMessage(resp)
+			msg.ToolCalls = make([]providers.ToolCall, len(resp.ToolCalls))
+			for i, tc := range resp.ToolCalls {
+				tc.Arguments = traces[i].Call.Arguments
+				msg.ToolCalls[i] = tc
+			}
+			messages = append(messages, msg)
+			res.Turn = append(res.Turn, msg)
+			for _, trace := range traces {
+				res.Tools = append(res.Tools, trace)
+				messages = append(messages, providers.Message{Role: "tool", Content: trace.Result, ToolCallID: trace.Call.ID})
+				res.Turn = append(res.Turn, messages[len(messages)-1])
+			}
+			continue
+		}
+
+		// Text-only response: check if model promised to act but didn't (e.g. "Let me fix the skill:")
+		if len(res.Tools) > 0 && suggestsIncompleteAction(resp.Content) && res.Iterations < req.MaxIterations {
+			messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content})
+			messages = append(messages, providers.Message{Role: "user", Content: "Please proceed and make the changes using the tools."})
+			continue
+		}
+
+		messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content, Reasoning: resp.Reasoning})
+		res.Content = resp.Content
+		res.Stop = StopFinal
+		break
+	}
+	if res.Stop == "" {
+		res.Stop = StopMaxIterations
+	}
+	res.Messages = messages
+	return res
+}
+
+// executeTools runs calls with reg and returns their traces in call order. Calls pass
+// through the BeforeToolHooks first, and vetoed ones are not executed.
+func (r *Runner) executeTools(ctx context.Context, reg *tools.Registry, calls []providers.ToolCall, maxChars int) []ToolTrace {
+	traces := make([]ToolTrace, len(calls))
+	var run []providers.ToolCall // calls to execute, in order
+	var runIdx []int             // their index in calls
+	for i, tc := range calls {
+		traces[i].Call = tc
+		if err := r.Hooks.beforeTool(ctx, &traces[i].Call); err != nil {
+			traces[i].Err = err
+			continue
+		}
+		if reg == nil {
+			traces[i].Err = errors.New("tool not found")
+			continue
+		}
+		run = append(run, traces[i].Call)
+		runIdx = append(runIdx, i)
+	}
+	if len(run) > 0 {
+		for j, cr := range reg.ExecuteCalls(ctx, run) {
+			traces[runIdx[j]].Result, traces[runIdx[j]].Err = cr.Output, cr.Err
+		}
+	}
+	for i := range traces {
+		if traces[i].Err != nil {
+			traces[i].Result = "(tool error) " + traces[i].Err.Error()
+		}
+		traces[i].Result = TruncateToolResult(traces[i].Result, maxChars)
+		r.Hooks.afterTool(ctx, &traces[i])
+	}
+	return traces
+}
+
+// memoryContext returns the file-backed memory context (long-term + today) and recent memories.
+func (r *Runner) memoryContext() (string, []memory.MemoryItem) {
+	memCtx, _ := r.Memory.GetMemoryContext()
+	memories := r.Memory.Recent(5)
+	if len(memories) == 0 {
+		memories = r.Memory.RecentFromFiles(5)
+	}
+	return memCtx, memories
+}
+
+// generationOptions returns the options for a chat call to model, with MaxTokens
+// clamped to what the model can produce.
+func (r *Runner) generationOptions(model string) providers.GenerationOptions {
+	o := r.Options
+	if limit := r.Models.Lookup(model).MaxOutputTokens; limit > 0 && o.MaxTokens > limit {
+		o.MaxTokens = limit
+	}
+	return o
+}
+
+// compactionModel returns the model used to summarize history in a run of model.
+func (r *Runner) compactionModel(model string) string {
+	if r.CompactionModel != "" {
+		return r.CompactionModel
+	}
+	return model
+}
+
+// compactionOptions returns the options for summarizing history: no tools, and temperature 0
+// if a temperature is configured at all (otherwise the provider's default is kept).
+func (r *Runner) compactionOptions(model string) providers.GenerationOptions {
+	o := r.generationOptions(r.compactionModel(model))
+	if o.Temperature != nil {
+		zero := 0.0
+		o.Temperature = &zero
+	}
+	o.ToolChoice, o.ParallelToolCalls = "", nil
+	return o
+}
+
+// chat calls the provider (streaming into stream when non-nil). If the provider rejects
+// the request because it no longer fits the context window, the history is compacted
+// and the call retried once. It returns the messages actually sent.
+// Any reasoning in the reply is logged.
+func (r *Runner) chat(ctx context.Context, messages []providers.Message, toolDefs []providers.ToolDefinition, model string, opts providers.GenerationOptions, stream *replyStream) (providers.LLMResponse, []providers.Message, error) {
+	resp, err := chatWithStream(ctx, r.Provider, messages, toolDefs, model, opts, stream)
+	if errors.Is(err, providers.ErrContextLength) {
+		if compacted, _ := Compact(ctx, messages, r.Provider, r.compactionModel(model), r.compactionOptions(model)); len(compacted) < len(messages) {
+			log.Printf("context length exceeded; compacted history from %d to %d messages and retrying", len(messages), len(compacted))
+			messages = compacted
+			resp, err = chatWithStream(ctx, r.Provider, messages, toolDefs, model, opts, stream)
+		}
+	}
+	if err == nil {
+		logReasoning(model, resp.Reasoning)
+	}
+	return resp, messages, err
+}
+
+func addUsage(a, b providers.Usage) providers.Usage {
+	return providers.Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		CachedTokens:     a.CachedTokens + b.CachedTokens,
+	}
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/local/picobot/internal/agent/memory"
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/providers"
+)
+
+type upperTool struct{}
+
+func (upperTool) Name() string        { return "upper" }
+func (upperTool) Description() string { return "Uppercase text" }
+func (upperTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}}}
+}
+func (upperTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	s, _ := args["text"].(string)
+	return strings.ToUpper(s), nil
+}
+
+// errProvider fails every call with the context's error, or with err if the context is live.
+type errProvider struct{ err error }
+
+func (p errProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	if ctx.Err() != nil {
+		return providers.LLMResponse{}, ctx.Err()
+	}
+	return providers.LLMResponse{}, p.err
+}
+func (p errProvider) GetDefaultModel() string { return "err" }
+
+func newTestRunner(t *testing.T, p providers.LLMProvider) *Runner {
+	t.Helper()
+	dir := t.TempDir()
+	return &Runner{
+		Provider: p,
+		Context:  NewContextBuilder(dir, memory.NewSimpleRanker(), 5),
+		Memory:   memory.NewMemoryStoreWithWorkspace(dir, 100),
+	}
+}
+
+func TestRunnerReturnsTraceAndStopReason(t *testing.T) {
+	p, err := providers.NewScriptedProvider(providers.Script{Turns: []providers.ScriptTurn{
+		{ToolCalls: []providers.ScriptToolCall{{Name: "upper", Arguments: map[string]interface{}{"text": "hi"}}}},
+		{Text: "done"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := tools.NewRegistry()
+	reg.Register(upperTool{})
+
+	res := newTestRunner(t, p).Run(context.Background(), RunRequest{Input: "shout hi", Model: p.GetDefaultModel(), Tools: reg, MaxIterations: 5})
+	if res.Stop != StopFinal || res.Content != "done" || res.Iterations != 2 {
+		t.Fatalf("unexpected result: stop %q, content %q, %d iterations", res.Stop, res.Content, res.Iterations)
+	}
+	if len(res.Tools) != 1 || res.Tools[0].Call.Name != "upper" || res.Tools[0].Result != "HI" {
+		t.Fatalf("unexpected tool trace %+v", res.Tools)
+	}
+	if last := res.Messages[len(res.Messages)-1]; last.Role != "assistant" || last.Content != "done" {
+		t.Errorf("last message should be the final reply, got %+v", last)
+	}
+	// the turn is what the session keeps: input, tool call and result, but not the reply
+	turn := res.Turn
+	if len(turn) != 3 || turn[0].Content != "shout hi" || turn[1].ToolCalls[0].Name != "upper" || turn[2].Role != "tool" || turn[2].Content != "HI" || turn[2].ToolCallID != turn[1].ToolCalls[0].ID {
+		t.Errorf("unexpected turn %+v", turn)
+	}
+}
+
+func TestRunnerStopsAtMaxIterations(t *testing.T) {
+	p, err := providers.NewScriptedProvider(providers.Script{Turns: []providers.ScriptTurn{
+		{ToolCalls: []providers.ScriptToolCall{{Name: "upper", Arguments: map[string]interface{}{"text": "again"}}}, Repeat: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := tools.NewRegistry()
+	reg.Register(upperTool{})
+
+	res := newTestRunner(t, p).Run(context.Background(), RunRequest{Input: "loop", Model: p.GetDefaultModel(), Tools: reg, MaxIterations: 3})
+	if res.Stop != StopMaxIterations || res.Iterations != 3 || len(res.Tools) != 3 {
+		t.Fatalf("unexpected result: stop %q, %d iterations, %d tool calls", res.Stop, res.Iterations, len(res.Tools))
+	}
+	if res.Content != "" || res.Text() != "AGAIN" {
+		t.Errorf("Text should fall back to the last tool result, got content %q text %q", res.Content, res.Text())
+	}
+}
+
+func TestRunnerReportsProviderError(t *testing.T) {
+	res := newTestRunner(t, errProvider{providers.ErrRateLimited}).Run(context.Background(), RunRequest{Input: "hi", Model: "err", MaxIterations: 3})
+	if res.Stop != StopError || !errors.Is(res.Err, providers.ErrRateLimited) || res.Iterations != 1 {
+		t.Fatalf("unexpected result: stop %q, err %v, %d iterations", res.Stop, res.Err, res.Iterations)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res = newTestRunner(t, errProvider{providers.ErrRateLimited}).Run(ctx, RunRequest{Input: "hi", Model: "err", MaxIterations: 3})
+	if res.Stop != StopCanceled || !errors.Is(res.Err, context.Canceled) {
+		t.Fatalf("expected a canceled run, got stop %q, err %v", res.Stop, res.Err)
+	}
+}
+
+// verdictTool asks the run's model whether its text is spam, as a tool wanting typed
+// results would.
+type verdictTool struct{}
+
+func (verdictTool) Name() string                       { return "verdict" }
+func (verdictTool) Description() string                { return "Judge text" }
+func (verdictTool) Parameters() map[string]interface{} { return nil }
+func (verdictTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	run := tools.RunInfoFrom(ctx)
+	if run.Provider == nil {
+		return "", errors.New("no provider on the context")
+	}
+	var v struct {
+		Spam bool `json:"spam"`
+	}
+	if _, err := providers.ChatJSON(ctx, run.Provider, []providers.Message{{Role: "user", Content: "spam?"}}, run.Model, providers.GenerationOptions{}, &v); err != nil {
+		return "", err
+	}
+	if v.Spam {
+		return "spam", nil
+	}
+	return "ham", nil
+}
+
+func TestRunnerGivesToolsTheRunsProvider(t *testing.T) {
+	p, err := providers.NewScriptedProvider(providers.Script{Turns: []providers.ScriptTurn{
+		{ToolCalls: []providers.ScriptToolCall{{Name: "verdict"}}},
+		{Text: `{"spam": true}`},
+		{Text: "done"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := tools.NewRegistry()
+	reg.Register(verdictTool{})
+
+	res := newTestRunner(t, p).Run(context.Background(), RunRequest{Input: "judge", Model: p.GetDefaultModel(), Tools: reg, MaxIterations: 5})
+	if res.Stop != StopFinal || len(res.Tools) != 1 || res.Tools[0].Result != "spam" {
+		t.Fatalf("unexpected result: stop %q, tools %+v", res.Stop, res.Tools)
+	}
+}
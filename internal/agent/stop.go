@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// stopSummaryLen caps each tool result quoted in the reply of a stopped run.
+const stopSummaryLen = 120
+
+// stoppable is a run that /stop can cancel.
+type stoppable struct {
+	cancel   context.CancelFunc
+	senderID string // who may stop it; "" means anyone in the chat
+}
+
+// stoppableBy returns a stoppable run started by senderID. Like an approval, a run of a cron
+// job has no one who asked for it, so anyone in the chat may stop it.
+func stoppableBy(cancel context.CancelFunc, senderID string) stoppable {
+	if senderID == cronSenderID {
+		senderID = ""
+	}
+	return stoppable{cancel: cancel, senderID: senderID}
+}
+
+// startRun returns a context for a run of chat key, started by senderID, that /stop can
+// cancel, and a function that ends the run. Each chat runs one message at a time, so there is
+// at most one per key.
+func (a *AgentLoop) startRun(ctx context.Context, key, senderID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	a.runsMu.Lock()
+	a.runs[key] = stoppableBy(cancel, senderID)
+	a.runsMu.Unlock()
+	return ctx, func() {
+		a.runsMu.Lock()
+		delete(a.runs, key)
+		a.runsMu.Unlock()
+		cancel()
+	}
+}
+
+// startSubagent returns a context for subagent sessionKey, spawned from chat key at the
+// request of senderID, that /stop in that chat cancels, and a function that ends the
+// subagent's run.
+func (a *AgentLoop) startSubagent(ctx context.Context, key, sessionKey, senderID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	a.runsMu.Lock()
+	if a.subagents[key] == nil {
+		a.subagents[key] = map[string]stoppable{}
+	}
+	a.subagents[key][sessionKey] = stoppableBy(cancel, senderID)
+	a.runsMu.Unlock()
+	return ctx, func() {
+		a.runsMu.Lock()
+		delete(a.subagents[key], sessionKey)
+		if len(a.subagents[key]) == 0 {
+			delete(a.subagents, key)
+		}
+		a.runsMu.Unlock()
+		cancel()
+	}
+}
+
+// stopCommand answers /stop by canceling the current run of the chat and the subagents it
+// spawned, as far as the sender started them: in a group, one member cannot stop another's
+// run. It is immediate, so it overtakes the run it cancels; channels also turn a stop
+// reaction into it. The canceled runs send their own replies.
+func (a *AgentLoop) stopCommand(ctx context.Context, call CommandCall) string {
+	key := call.Msg.Channel + ":" + call.Msg.ChatID
+	var cancels []context.CancelFunc
+	notTheirs := false // a run of this chat belongs to someone else
+	add := func(r stoppable) {
+		if r.senderID != "" && r.senderID != call.Msg.SenderID {
+			notTheirs = true
+			return
+		}
+		cancels = append(cancels, r.cancel)
+	}
+	a.runsMu.Lock()
+	if r, ok := a.runs[key]; ok {
+		add(r)
+	}
+	for _, r := range a.subagents[key] {
+		add(r)
+	}
+	a.runsMu.Unlock()
+	if len(cancels) == 0 {
+		if notTheirs {
+			return "Only the person who started it can stop this run."
+		}
+		return "Nothing to stop."
+	}
+	log.Printf("stopping %d run(s) of %s", len(cancels), key)
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return ""
+}
+
+// stoppedReply tells the user a run was stopped and what it had done by then.
+func stoppedReply(res RunResult) string {
+	if len(res.Tools) == 0 {
+		return "Stopped."
+	}
+	var b strings.Builder
+	b.WriteString("Stopped. Done so far:")
+	for _, tr := range res.Tools {
+		result := strings.Join(strings.Fields(tr.Result), " ")
+		if r := []rune(result); len(r) > stopSummaryLen {
+			result = string(r[:stopSummaryLen]) + "…"
+		}
+		fmt.Fprintf(&b, "\n- %s: %s", tr.Call.Name, result)
+	}
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// stallingProvider calls the upper tool once, then blocks until the run is canceled.
+type stallingProvider struct{ stalled chan struct{} }
+
+func (p *stallingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	if messages[len(messages)-1].Role != "tool" {
+		return providers.LLMResponse{
+			HasToolCalls: true,
+			ToolCalls:    []providers.ToolCall{{ID: "1", Name: "upper", Arguments: map[string]interface{}{"text": "hi"}}},
+		}, nil
+	}
+	p.stalled <- struct{}{}
+	<-ctx.Done()
+	return providers.LLMResponse{}, ctx.Err()
+}
+func (p *stallingProvider) GetDefaultModel() string { return "stall" }
+
+func TestStopCancelsTheRunAndReportsProgress(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &stallingProvider{stalled: make(chan struct{}, 1)}
+	ag := NewAgentLoop(b, p, "stall", 5, t.TempDir(), nil)
+	ag.tools.Register(upperTool{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { ag.Run(ctx); close(done) }()
+	defer func() { cancel(); <-done }()
+
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", Content: "/stop"}
+	if out := nextOut(t, b); out.Content != "Nothing to stop." {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", Content: "work"}
+	select {
+	case <-p.stalled:
+	case <-time.After(time.Second):
+		t.Fatal("the run never reached its second model call")
+	}
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", Content: "/stop"}
+	if out := nextOut(t, b); out.ChatID != "a" || out.Content != "Stopped. Done so far:\n- upper: HI" {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+}
+
+func TestStopCancelsSubagentsOfTheChat(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &stallingProvider{stalled: make(chan struct{}, 1)}
+	ag := NewAgentLoop(b, p, "stall", 5, t.TempDir(), nil)
+	ag.tools.Register(upperTool{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { ag.Run(ctx); close(done) }()
+	defer func() { cancel(); <-done }()
+
+	type result struct {
+		reply string
+		err   error
+	}
+	sub := make(chan result, 1)
+	go func() {
+		reply, err := ag.RunSubagent(context.Background(), "subagent:s1", "work", time.Minute, "test", "a")
+		sub <- result{reply, err}
+	}()
+	select {
+	case <-p.stalled:
+	case <-time.After(time.Second):
+		t.Fatal("the subagent never reached its second model call")
+	}
+
+	// /stop in another chat leaves it alone
+	b.In <- chat.Inbound{Channel: "test", ChatID: "b", Content: "/stop"}
+	if out := nextOut(t, b); out.Content != "Nothing to stop." {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", Content: "/stop"}
+	select {
+	case r := <-sub:
+		if r.err != nil || r.reply != "Stopped. Done so far:\n- upper: HI" {
+			t.Fatalf("unexpected subagent result %q, %v", r.reply, r.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("/stop did not reach the subagent")
+	}
+}
+
+func TestStopOnlyBySenderUnlessCron(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &stallingProvider{stalled: make(chan struct{}, 1)}
+	ag := NewAgentLoop(b, p, "stall", 5, t.TempDir(), nil)
+	ag.tools.Register(upperTool{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { ag.Run(ctx); close(done) }()
+	defer func() { cancel(); <-done }()
+	stalled := func() {
+		t.Helper()
+		select {
+		case <-p.stalled:
+		case <-time.After(time.Second):
+			t.Fatal("the run never reached its second model call")
+		}
+	}
+
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: "alice", Content: "work"}
+	stalled()
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: "bob", Content: "/stop"}
+	if out := nextOut(t, b); out.Content != "Only the person who started it can stop this run." {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: "alice", Content: "/stop"}
+	if out := nextOut(t, b); out.Content != "Stopped. Done so far:\n- upper: HI" {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+
+	// no one asked for a cron job, so anyone in the chat may stop it
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: cronSenderID, Content: "work"}
+	stalled()
+	b.In <- chat.Inbound{Channel: "test", ChatID: "a", SenderID: "bob", Content: "/stop"}
+	if out := nextOut(t, b); out.Content != "Stopped. Done so far:\n- upper: HI" {
+		t.Fatalf("unexpected reply %+v", out)
+	}
+}
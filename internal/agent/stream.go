@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// streamUpdateInterval coalesces streamed deltas so the hub is not flooded with one
+// partial Outbound per token; channels apply their own (slower) edit throttling.
+const streamUpdateInterval = 500 * time.Millisecond
+
+// replyStream publishes partial reply text for one inbound message to the hub.
+// Channels that cannot edit messages ignore the partial updates.
+type replyStream struct {
+	hub      *chat.Hub
+	channel  string
+	chatID   string
+	id       string
+	buf      strings.Builder
+	lastSent time.Time
+	started  bool
+	filter   func(text string) string // rewrites each partial before it is shown; nil keeps it
+}
+
+func newReplyStream(hub *chat.Hub, channel, chatID string) *replyStream {
+	return &replyStream{hub: hub, channel: channel, chatID: chatID, id: uuid.New().String()}
+}
+
+// reset starts a new model turn; the next partial replaces what was shown before.
+func (s *replyStream) reset() {
+	s.buf.Reset()
+}
+
+// delta appends a content fragment and publishes the text so far if the interval has elapsed.
+func (s *replyStream) delta(d string) {
+	s.buf.WriteString(d)
+	if time.Since(s.lastSent) < streamUpdateInterval {
+		return
+	}
+	text := strings.TrimSpace(s.buf.String())
+	if s.filter != nil {
+		text = s.filter(text)
+	}
+	if text == "" {
+		return
+	}
+	select {
+	case s.hub.Out <- chat.Outbound{Channel: s.channel, ChatID: s.chatID, Content: text, StreamID: s.id, Partial: true}:
+		s.started = true
+		s.lastSent = time.Now()
+	default:
+		// outbound channel busy; skip this update, the final message carries the full text
+	}
+}
+
+// final returns the outbound message for the finished reply, tagged with the stream ID
+// if any partial update was published so channels replace it instead of posting anew.
+func (s *replyStream) final(content string) chat.Outbound {
+	out := chat.Outbound{Channel: s.channel, ChatID: s.chatID, Content: content}
+	if s.started {
+		out.StreamID = s.id
+	}
+	return out
+}
+
+// chatWithStream calls the provider, streaming partial content into stream when the
+// provider supports it. A nil stream, or a non-streaming provider, falls back to Chat.
+func chatWithStream(ctx context.Context, p providers.LLMProvider, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions, stream *replyStream) (providers.LLMResponse, error) {
+	sp, ok := p.(providers.StreamingProvider)
+	if !ok || stream == nil {
+		return p.Chat(ctx, messages, tools, model, opts)
+	}
+	stream.reset()
+	return sp.ChatStream(ctx, messages, tools, model, opts, stream.delta)
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"log"
+	"strings"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+// reasoningLogLen caps how much of the model's reasoning is written to the log per call.
+const reasoningLogLen = 2000
+
+// thinkingCommand applies the argument of a "/thinking [on|off]" command to a chat's
+// show-thinking setting and returns the reply. Without an argument it reports the setting.
+func thinkingCommand(arg string, show *bool) string {
+	switch strings.ToLower(arg) {
+	case "on":
+		*show = true
+		return "Thinking summaries are on for this chat: replies from reasoning models will include a collapsed summary of the model's thinking."
+	case "off":
+		*show = false
+		return "Thinking summaries are off for this chat."
+	case "":
+	default:
+		return "Send /thinking on or /thinking off."
+	}
+	state := "off"
+	if *show {
+		state = "on"
+	}
+	return "Thinking summaries are " + state + " for this chat. Send /thinking on or /thinking off to change it."
+}
+
+// logReasoning writes the reasoning behind a model reply to the log, truncated.
+func logReasoning(model string, reasoning string) {
+	if reasoning == "" {
+		return
+	}
+	if r := []rune(reasoning); len(r) > reasoningLogLen {
+		reasoning = string(r[:reasoningLogLen]) + "..."
+	}
+	log.Printf("model %s reasoning: %s", model, reasoning)
+}
+
+// assistantMessage is the in-flight assistant message for a reply with tool calls. It keeps
+// the reasoning, which some providers require back on the next call of the same turn.
+func assistantMessage(resp providers.LLMResponse) providers.Message {
+	return providers.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls, Reasoning: resp.Reasoning, ReasoningDetails: resp.ReasoningDetails}
+}
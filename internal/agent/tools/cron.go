@@ -10,12 +10,10 @@ import (
 )
 
 // CronTool schedules delayed/recurring tasks via the cron scheduler.
-// It holds a channel/chatID context (set per-incoming-message) so fired jobs
+// Jobs are tied to the run's channel and chat (see RunInfo) so fired jobs
 // know where to send their notification.
 type CronTool struct {
 	scheduler *cron.Scheduler
-	channel   string
-	chatID    string
 }
 
 func NewCronTool(scheduler *cron.Scheduler) *CronTool {
@@ -61,14 +59,9 @@ func (t *CronTool) Parameters() map[string]interface{} {
 	}
 }
 
-// SetContext sets the originating channel and chat for scheduled jobs.
-func (t *CronTool) SetContext(channel, chatID string) {
-	t.channel = channel
-	t.chatID = chatID
-}
-
 func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	action, _ := args["action"].(string)
+	run := RunInfoFrom(ctx)
 
 	switch action {
 	case "add":
@@ -109,12 +102,12 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) (st
 			if interval < 2*time.Minute {
 				return "", fmt.Errorf("cron add: recurring interval must be at least 2m (got %v)", interval)
 			}
-			id := t.scheduler.AddRecurring(name, message, delay, interval, t.channel, t.chatID)
+			id := t.scheduler.AddRecurring(name, message, delay, interval, run.Channel, run.ChatID)
 			return fmt.Sprintf("Scheduled recurring job %q (id: %s). Will fire in %v, then repeat every %v.", name, id, delay, interval), nil
 		}
 
 		// One-time job
-		id := t.scheduler.Add(name, message, delay, t.channel, t.chatID)
+		id := t.scheduler.Add(name, message, delay, run.Channel, run.ChatID)
 		return fmt.Sprintf("Scheduled job %q (id: %s). Will fire in %v.", name, id, delay), nil
 
 	case "list":
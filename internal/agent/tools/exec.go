@@ -32,6 +32,9 @@ func NewExecToolWithWorkspace(timeoutSecs int, allowedDir string) *ExecTool {
 	return &ExecTool{timeout: time.Duration(timeoutSecs) * time.Second, allowedDir: allowedDir}
 }
 
+// execWaitDelay bounds how long a killed command's output is waited for.
+const execWaitDelay = 2 * time.Second
+
 func (t *ExecTool) Name() string { return "exec" }
 func (t *ExecTool) Description() string {
 	return "Execute shell commands (array form only, restricted for safety)"
@@ -123,6 +126,10 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) (st
 	}
 
 	cmd := exec.CommandContext(cctx, prog, argv[1:]...)
+	// on timeout or cancellation (/stop) kill everything the command started, and don't wait
+	// long for output pipes a stray grandchild may still hold
+	killProcessGroup(cmd)
+	cmd.WaitDelay = execWaitDelay
 	if t.allowedDir != "" {
 		cmd.Dir = t.allowedDir
 	}
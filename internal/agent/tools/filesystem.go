@@ -59,6 +59,12 @@ func (t *FilesystemTool) Parameters() map[string]interface{} {
 	}
 }
 
+// ConcurrencySafe reports whether the call only reads (read and list actions).
+func (t *FilesystemTool) ConcurrencySafe(args map[string]interface{}) bool {
+	action, _ := args["action"].(string)
+	return action == "read" || action == "list"
+}
+
 func (t *FilesystemTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	actionRaw, ok := args["action"]
 	if !ok {
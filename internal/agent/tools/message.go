@@ -9,11 +9,9 @@ import (
 )
 
 // MessageTool sends messages to a channel via the chat Hub.
-// It holds a context (channel + chatID) which should be set per-incoming-message.
+// The channel and chat are those of the run, taken from the context (see RunInfo).
 type MessageTool struct {
-	hub     *chat.Hub
-	channel string
-	chatID  string
+	hub *chat.Hub
 }
 
 func NewMessageTool(b *chat.Hub) *MessageTool {
@@ -36,12 +34,6 @@ func (m *MessageTool) Parameters() map[string]interface{} {
 	}
 }
 
-// SetContext sets the current channel and chat id for outgoing messages.
-func (m *MessageTool) SetContext(channel, chatID string) {
-	m.channel = channel
-	m.chatID = chatID
-}
-
 // Expected args: {"content": "..."}
 func (m *MessageTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	content := ""
@@ -58,9 +50,10 @@ func (m *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		return "", fmt.Errorf("message tool: 'content' argument required")
 	}
 	// Publish outbound message to hub
+	run := RunInfoFrom(ctx)
 	out := chat.Outbound{
-		Channel: m.channel,
-		ChatID:  m.chatID,
+		Channel: run.Channel,
+		ChatID:  run.ChatID,
 		Content: content,
 	}
 	select {
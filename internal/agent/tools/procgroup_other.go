@@ -0,0 +1,9 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+// killProcessGroup leaves cmd as is: without process groups only the command itself is
+// killed when its context is done.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExecCancelKillsChildProcesses(t *testing.T) {
+	e := NewExecTool(60)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	// the backgrounded sleep keeps the output pipe open unless the whole group is killed
+	_, err := e.Execute(ctx, map[string]interface{}{"cmd": []interface{}{"sh", "-c", "sleep 30 & sleep 30"}})
+	if err == nil {
+		t.Fatal("expected an error for a canceled command")
+	}
+	if d := time.Since(start); d > execWaitDelay/2 {
+		t.Fatalf("Execute returned after %v; the child process was not killed", d)
+	}
+}
@@ -20,6 +20,22 @@ type Tool interface {
 	Execute(ctx context.Context, args map[string]interface{}) (string, error)
 }
 
+// ConcurrencySafe is implemented by tools whose calls may run at the same time as other
+// concurrency-safe calls because they only read state. It is asked per call, so a tool can
+// allow some actions (read) and not others (write). Tools without it always run alone.
+type ConcurrencySafe interface {
+	ConcurrencySafe(args map[string]interface{}) bool
+}
+
+// MaxParallelToolCalls bounds how many concurrency-safe calls ExecuteCalls runs at once.
+const MaxParallelToolCalls = 4
+
+// CallResult is the outcome of one tool call run by ExecuteCalls.
+type CallResult struct {
+	Output string
+	Err    error
+}
+
 // Registry holds registered tools.
 type Registry struct {
 	mu    sync.RWMutex
@@ -45,6 +61,19 @@ func (r *Registry) Get(name string) Tool {
 	return r.tools[name]
 }
 
+// Filter returns a new registry holding the tools of r for which keep returns true.
+func (r *Registry) Filter(keep func(name string) bool) *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := NewRegistry()
+	for name, t := range r.tools {
+		if keep(name) {
+			out.tools[name] = t
+		}
+	}
+	return out
+}
+
 // Definitions returns the list of tool definitions to expose to the model.
 func (r *Registry) Definitions() []providers.ToolDefinition {
 	r.mu.RLock()
@@ -75,3 +104,45 @@ func (r *Registry) Execute(ctx context.Context, name string, args map[string]int
 	log.Printf("tool %s executing: %s", name, argsJSON)
 	return t.Execute(ctx, args)
 }
+
+// ExecuteCalls runs the tool calls of one model reply and returns their results in call
+// order. Consecutive calls to concurrency-safe tools run in parallel, at most
+// MaxParallelToolCalls at a time; every other call runs alone, after the calls before it
+// have finished and before any after it start, so reads never race a write.
+func (r *Registry) ExecuteCalls(ctx context.Context, calls []providers.ToolCall) []CallResult {
+	results := make([]CallResult, len(calls))
+	run := func(i int) {
+		results[i].Output, results[i].Err = r.Execute(ctx, calls[i].Name, calls[i].Arguments)
+	}
+	for i := 0; i < len(calls); {
+		if !r.concurrencySafe(calls[i]) {
+			run(i)
+			i++
+			continue
+		}
+		// run the whole batch of consecutive safe calls
+		end := i + 1
+		for end < len(calls) && r.concurrencySafe(calls[end]) {
+			end++
+		}
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, MaxParallelToolCalls)
+		for j := i; j < end; j++ {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(j int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				run(j)
+			}(j)
+		}
+		wg.Wait()
+		i = end
+	}
+	return results
+}
+
+func (r *Registry) concurrencySafe(tc providers.ToolCall) bool {
+	cs, ok := r.Get(tc.Name).(ConcurrencySafe)
+	return ok && cs.ConcurrencySafe(tc.Arguments)
+}
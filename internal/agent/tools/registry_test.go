@@ -2,19 +2,22 @@ package tools
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
 )
 
 func TestMessageToolPublishesOutbound(t *testing.T) {
 	b := chat.NewHub(10)
 	mt := NewMessageTool(b)
-	mt.SetContext("cli", "test-chat")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
+	ctx = WithRunInfo(ctx, RunInfo{Channel: "cli", ChatID: "test-chat"})
 	res, err := mt.Execute(ctx, map[string]interface{}{"content": "hello world"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -25,10 +28,84 @@ func TestMessageToolPublishesOutbound(t *testing.T) {
 
 	select {
 	case out := <-b.Out:
-		if out.Content != "hello world" {
+		if out.Content != "hello world" || out.Channel != "cli" || out.ChatID != "test-chat" {
 			t.Fatalf("unexpected content: %s", out.Content)
 		}
 	default:
 		t.Fatalf("no outbound message published")
 	}
 }
+
+// slowTool sleeps, then returns its "id" argument; it tracks how many calls overlap.
+type slowTool struct {
+	name    string
+	safe    bool
+	running atomic.Int32
+	mu      sync.Mutex
+	peak    int32
+}
+
+func (t *slowTool) Name() string                       { return t.name }
+func (t *slowTool) Description() string                { return "" }
+func (t *slowTool) Parameters() map[string]interface{} { return nil }
+func (t *slowTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	n := t.running.Add(1)
+	t.mu.Lock()
+	t.peak = max(t.peak, n)
+	t.mu.Unlock()
+	time.Sleep(30 * time.Millisecond)
+	t.running.Add(-1)
+	return args["id"].(string), nil
+}
+
+type safeSlowTool struct{ *slowTool }
+
+func (t safeSlowTool) ConcurrencySafe(args map[string]interface{}) bool { return true }
+
+func TestExecuteCallsParallelizesSafeTools(t *testing.T) {
+	reader := &slowTool{name: "reader"}
+	writer := &slowTool{name: "writer"}
+	r := NewRegistry()
+	r.Register(safeSlowTool{reader})
+	r.Register(writer)
+
+	var calls []providers.ToolCall
+	ids := []string{"r1", "r2", "r3", "r4", "r5", "r6", "w1", "w2", "r7"}
+	for _, id := range ids {
+		name := "reader"
+		if id[0] == 'w' {
+			name = "writer"
+		}
+		calls = append(calls, providers.ToolCall{ID: id, Name: name, Arguments: map[string]interface{}{"id": id}})
+	}
+
+	start := time.Now()
+	results := r.ExecuteCalls(context.Background(), calls)
+	elapsed := time.Since(start)
+
+	for i, id := range ids {
+		if results[i].Err != nil || results[i].Output != id {
+			t.Fatalf("result %d = %+v, want %q", i, results[i], id)
+		}
+	}
+	if reader.peak < 2 || reader.peak > MaxParallelToolCalls {
+		t.Errorf("expected reads to overlap, at most %d at a time; peak %d", MaxParallelToolCalls, reader.peak)
+	}
+	if writer.peak != 1 {
+		t.Errorf("expected writes to run alone, peak %d", writer.peak)
+	}
+	// serial would be 9 sleeps; batches are 2 (six reads) + 2 writes + 1 read
+	if elapsed > 8*30*time.Millisecond {
+		t.Errorf("expected parallel execution, took %v", elapsed)
+	}
+}
+
+func TestFilesystemToolOnlyReadsAreConcurrencySafe(t *testing.T) {
+	fs := &FilesystemTool{}
+	if !fs.ConcurrencySafe(map[string]interface{}{"action": "read"}) || !fs.ConcurrencySafe(map[string]interface{}{"action": "list"}) {
+		t.Error("expected read and list to be concurrency-safe")
+	}
+	if fs.ConcurrencySafe(map[string]interface{}{"action": "write"}) {
+		t.Error("expected write to run alone")
+	}
+}
@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"context"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+// RunInfo describes the agent run a tool call belongs to. The agent loop puts it on the
+// context passed to Execute, so tools shared by concurrent runs never see another run's chat.
+type RunInfo struct {
+	Channel    string // channel replies go to, e.g. "telegram"
+	ChatID     string // chat replies go to
+	SenderID   string // user who sent the message that started the run, or the subagent's requester
+	SessionKey string // session the run reads and writes, e.g. "telegram:42" or "subagent:<uuid>"
+	Subagent   bool   // the run was started by the spawn tool
+
+	// Provider and Model are what the run talks to, for tools that ask the model for
+	// typed results with providers.ChatJSON. Set by the Runner; nil outside a run.
+	Provider providers.LLMProvider
+	Model    string
+}
+
+type runInfoKey struct{}
+
+// WithRunInfo returns a copy of ctx carrying info.
+func WithRunInfo(ctx context.Context, info RunInfo) context.Context {
+	return context.WithValue(ctx, runInfoKey{}, info)
+}
+
+// RunInfoFrom returns the RunInfo on ctx, or the zero RunInfo if there is none.
+func RunInfoFrom(ctx context.Context) RunInfo {
+	info, _ := ctx.Value(runInfoKey{}).(RunInfo)
+	return info
+}
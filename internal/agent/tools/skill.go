@@ -12,12 +12,15 @@ import (
 type SkillMetadata struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Command, if set, is a slash command (without the slash) that runs the skill.
+	Command string `json:"command,omitempty"`
 }
 
 // SkillManager provides tools for managing skills in the workspace.
 // All file operations are sandboxed via os.Root (Go 1.24+).
 type SkillManager struct {
-	root *os.Root // rooted at the workspace directory
+	root *os.Root        // rooted at the workspace directory
+	only map[string]bool // the skills it may list, read, create and delete; nil means all
 }
 
 // NewSkillManager creates a new skill manager backed by an os.Root.
@@ -25,6 +28,28 @@ func NewSkillManager(root *os.Root) *SkillManager {
 	return &SkillManager{root: root}
 }
 
+// Only returns a copy of sm that sees only the named skills, as if the others were not
+// installed. nil means all.
+func (sm *SkillManager) Only(names []string) *SkillManager {
+	c := *sm
+	c.only = nil
+	if names != nil {
+		c.only = make(map[string]bool, len(names))
+		for _, name := range names {
+			c.only[name] = true
+		}
+	}
+	return &c
+}
+
+// check returns an error if sm may not touch the skill called name.
+func (sm *SkillManager) check(name string) error {
+	if sm.only != nil && !sm.only[strings.TrimSpace(name)] {
+		return fmt.Errorf("skill %q is not available", name)
+	}
+	return nil
+}
+
 // ListSkills returns a list of all skills in the skills directory.
 func (sm *SkillManager) ListSkills() ([]SkillMetadata, error) {
 	f, err := sm.root.Open("skills")
@@ -49,8 +74,8 @@ func (sm *SkillManager) ListSkills() ([]SkillMetadata, error) {
 		skillFile := "skills/" + entry.Name() + "/SKILL.md"
 		if _, err := sm.root.Stat(skillFile); err == nil {
 			meta, err := sm.parseSkillMetadata(skillFile)
-			if err != nil {
-				// skip invalid skills
+			if err != nil || sm.check(meta.Name) != nil {
+				// skip invalid skills, and those hidden from sm
 				continue
 			}
 			skills = append(skills, meta)
@@ -61,6 +86,9 @@ func (sm *SkillManager) ListSkills() ([]SkillMetadata, error) {
 
 // GetSkill reads a skill's content by name.
 func (sm *SkillManager) GetSkill(name string) (string, error) {
+	if err := sm.check(name); err != nil {
+		return "", err
+	}
 	content, err := sm.root.ReadFile("skills/" + name + "/SKILL.md")
 	if err != nil {
 		return "", err
@@ -75,6 +103,9 @@ func (sm *SkillManager) CreateSkill(name, description, content string) error {
 		return fmt.Errorf("skill name is required")
 	}
 	name = strings.TrimSpace(name)
+	if err := sm.check(name); err != nil {
+		return err
+	}
 
 	skillDir := "skills/" + name
 	if err := sm.root.MkdirAll(skillDir, 0o755); err != nil {
@@ -90,6 +121,9 @@ func (sm *SkillManager) CreateSkill(name, description, content string) error {
 
 // DeleteSkill removes a skill directory.
 func (sm *SkillManager) DeleteSkill(name string) error {
+	if err := sm.check(name); err != nil {
+		return err
+	}
 	return sm.root.RemoveAll("skills/" + name)
 }
 
@@ -100,7 +134,7 @@ func (sm *SkillManager) parseSkillMetadata(skillPath string) (SkillMetadata, err
 		return SkillMetadata{}, err
 	}
 
-	// parse YAML frontmatter (simple parser for name and description)
+	// parse YAML frontmatter (simple parser for name, description and command)
 	lines := strings.Split(string(content), "\n")
 	if len(lines) < 3 || lines[0] != "---" {
 		return SkillMetadata{}, fmt.Errorf("invalid frontmatter")
@@ -128,6 +162,8 @@ func (sm *SkillManager) parseSkillMetadata(skillPath string) (SkillMetadata, err
 			meta.Name = value
 		case "description":
 			meta.Description = value
+		case "command":
+			meta.Command = value
 		}
 	}
 
@@ -219,6 +255,8 @@ func (t *ListSkillsTool) Parameters() map[string]interface{} {
 	}
 }
 
+func (t *ListSkillsTool) ConcurrencySafe(args map[string]interface{}) bool { return true }
+
 func (t *ListSkillsTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	skills, err := t.manager.ListSkills()
 	if err != nil {
@@ -262,6 +300,8 @@ func (t *ReadSkillTool) Parameters() map[string]interface{} {
 	}
 }
 
+func (t *ReadSkillTool) ConcurrencySafe(args map[string]interface{}) bool { return true }
+
 func (t *ReadSkillTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	name, ok := args["name"].(string)
 	if !ok {
@@ -16,13 +16,11 @@ type SpawnRunner interface {
 	RunSubagent(ctx context.Context, sessionKey string, task string, timeout time.Duration, requesterChannel, requesterChatID string) (string, error)
 }
 
-// SpawnTool spawns a background subagent that runs the task and announces the result to the requester.
+// SpawnTool spawns a background subagent that runs the task and announces the result to the
+// requester, the run's channel and chat (see RunInfo).
 type SpawnTool struct {
 	hub    *chat.Hub
 	runner SpawnRunner
-	// Context set per-message by the agent loop
-	channel string
-	chatID  string
 }
 
 // NewSpawnTool creates a SpawnTool. runner must implement SpawnRunner (e.g. *agent.AgentLoop).
@@ -30,12 +28,6 @@ func NewSpawnTool(hub *chat.Hub, runner SpawnRunner) *SpawnTool {
 	return &SpawnTool{hub: hub, runner: runner}
 }
 
-// SetContext sets the requester channel and chat id for announcement delivery.
-func (t *SpawnTool) SetContext(channel, chatID string) {
-	t.channel = channel
-	t.chatID = chatID
-}
-
 func (t *SpawnTool) Name() string        { return "spawn" }
 func (t *SpawnTool) Description() string { return "Spawn a background subagent to run a task; the result will be announced to the chat when done." }
 
@@ -65,7 +57,8 @@ func (t *SpawnTool) Execute(ctx context.Context, args map[string]interface{}) (s
 	if task == "" {
 		return "", fmt.Errorf("spawn: 'task' required")
 	}
-	if t.channel == "subagent" {
+	run := RunInfoFrom(ctx)
+	if run.Subagent {
 		return "", fmt.Errorf("spawn: not allowed from subagent sessions")
 	}
 	if t.runner == nil {
@@ -79,11 +72,14 @@ func (t *SpawnTool) Execute(ctx context.Context, args map[string]interface{}) (s
 		timeout = time.Duration(s) * time.Second
 	}
 
-	channel := t.channel
-	chatID := t.chatID
+	channel := run.Channel
+	chatID := run.ChatID
+	// the subagent outlives this tool call (and possibly the run); keep ctx values such as usage
+	// tags only. /stop in the requester's chat reaches it through the runner.
+	subCtx := context.WithoutCancel(ctx)
 
 	go func() {
-		result, err := t.runner.RunSubagent(ctx, childSessionKey, task, timeout, channel, chatID)
+		result, err := t.runner.RunSubagent(subCtx, childSessionKey, task, timeout, channel, chatID)
 		if err != nil {
 			result = fmt.Sprintf("(error) %v", err)
 		}
@@ -30,9 +30,9 @@ func TestSpawnTool_Execute_ReturnsAccepted(t *testing.T) {
 	hub := chat.NewHub(10)
 	runner := &mockSpawnRunner{runResult: "subagent done"}
 	tool := NewSpawnTool(hub, runner)
-	tool.SetContext("discord", "123")
+	ctx := WithRunInfo(context.Background(), RunInfo{Channel: "discord", ChatID: "123"})
 
-	result, err := tool.Execute(context.Background(), map[string]interface{}{"task": "do something"})
+	result, err := tool.Execute(ctx, map[string]interface{}{"task": "do something"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,9 +52,9 @@ func TestSpawnTool_Execute_RejectsFromSubagent(t *testing.T) {
 	hub := chat.NewHub(10)
 	runner := &mockSpawnRunner{}
 	tool := NewSpawnTool(hub, runner)
-	tool.SetContext("subagent", "abc-123")
+	ctx := WithRunInfo(context.Background(), RunInfo{Channel: "discord", ChatID: "123", SessionKey: "subagent:abc-123", Subagent: true})
 
-	_, err := tool.Execute(context.Background(), map[string]interface{}{"task": "do something"})
+	_, err := tool.Execute(ctx, map[string]interface{}{"task": "do something"})
 	if err == nil {
 		t.Fatal("expected error when spawning from subagent")
 	}
@@ -67,9 +67,9 @@ func TestSpawnTool_Execute_RequiresTask(t *testing.T) {
 	hub := chat.NewHub(10)
 	runner := &mockSpawnRunner{}
 	tool := NewSpawnTool(hub, runner)
-	tool.SetContext("discord", "123")
+	ctx := WithRunInfo(context.Background(), RunInfo{Channel: "discord", ChatID: "123"})
 
-	_, err := tool.Execute(context.Background(), map[string]interface{}{})
+	_, err := tool.Execute(ctx, map[string]interface{}{})
 	if err == nil {
 		t.Fatal("expected error when task is missing")
 	}
@@ -79,9 +79,9 @@ func TestSpawnTool_Execute_CallsRunner(t *testing.T) {
 	hub := chat.NewHub(10)
 	runner := &mockSpawnRunner{runResult: "done"}
 	tool := NewSpawnTool(hub, runner)
-	tool.SetContext("discord", "123")
+	ctx := WithRunInfo(context.Background(), RunInfo{Channel: "discord", ChatID: "123"})
 
-	_, err := tool.Execute(context.Background(), map[string]interface{}{"task": "my task"})
+	_, err := tool.Execute(ctx, map[string]interface{}{"task": "my task"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -95,3 +95,39 @@ func TestSpawnTool_Execute_CallsRunner(t *testing.T) {
 		t.Errorf("runner lastKey = %q, want subagent:...", runner.lastKey)
 	}
 }
+
+// ctxSpawnRunner reports the context RunSubagent was called with.
+type ctxSpawnRunner struct{ got chan context.Context }
+
+func (r *ctxSpawnRunner) RunSubagent(ctx context.Context, sessionKey string, task string, timeout time.Duration, requesterChannel, requesterChatID string) (string, error) {
+	r.got <- ctx
+	return "done", nil
+}
+
+func TestSpawnTool_SubagentOutlivesTheCall(t *testing.T) {
+	hub := chat.NewHub(10)
+	runner := &ctxSpawnRunner{got: make(chan context.Context, 1)}
+	tool := NewSpawnTool(hub, runner)
+
+	ctx, cancel := context.WithCancel(WithRunInfo(context.Background(), RunInfo{Channel: "discord", ChatID: "123"}))
+	if _, err := tool.Execute(ctx, map[string]interface{}{"task": "my task"}); err != nil {
+		t.Fatal(err)
+	}
+	cancel() // the run that spawned the subagent ends
+
+	sub := <-runner.got
+	if sub.Err() != nil {
+		t.Fatal("subagent context must not be canceled with the spawning run")
+	}
+	if info := RunInfoFrom(sub); info.ChatID != "123" {
+		t.Errorf("expected the run info to be kept, got %+v", info)
+	}
+	select {
+	case out := <-hub.Out:
+		if out.Channel != "discord" || out.ChatID != "123" {
+			t.Errorf("result announced to %s:%s, want discord:123", out.Channel, out.ChatID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the result to be announced")
+	}
+}
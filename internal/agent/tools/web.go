@@ -35,6 +35,9 @@ func (t *WebTool) Parameters() map[string]interface{} {
 	}
 }
 
+// ConcurrencySafe reports true: a fetch changes nothing locally.
+func (t *WebTool) ConcurrencySafe(args map[string]interface{}) bool { return true }
+
 func (t *WebTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	u, ok := args["url"].(string)
 	if !ok || u == "" {
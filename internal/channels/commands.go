@@ -0,0 +1,32 @@
+package channels
+
+import "regexp"
+
+// Command is a slash command offered in a chat app's command menu.
+type Command struct {
+	Name        string // without the slash
+	Description string
+	Args        string // what the argument is, e.g. "<name>"; empty if it takes none
+}
+
+// menuCommandRE is what both Telegram and Discord accept as a command name.
+var menuCommandRE = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// menuCommands returns the commands a command menu can show, with descriptions filled in
+// and cut to descLen runes.
+func menuCommands(cmds []Command, descLen int) []Command {
+	var out []Command
+	for _, c := range cmds {
+		if !menuCommandRE.MatchString(c.Name) {
+			continue
+		}
+		if c.Description == "" {
+			c.Description = "/" + c.Name
+		}
+		if r := []rune(c.Description); len(r) > descLen {
+			c.Description = string(r[:descLen-1]) + "…"
+		}
+		out = append(out, c)
+	}
+	return out
+}
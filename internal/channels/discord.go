@@ -53,9 +53,9 @@ func splitContent(content string, maxLen int) []string {
 }
 
 // StartDiscord connects to the Discord Gateway, receives DM messages only,
-// and forwards them to the hub. Replies are sent via the Discord REST API.
+// and forwards them to the hub. Replies are sent via the Discord REST API by a sender registered with router.
 // allowFrom restricts which Discord user IDs may send messages. Empty means allow all.
-func StartDiscord(ctx context.Context, hub *chat.Hub, token string, allowFrom []string) error {
+func StartDiscord(ctx context.Context, hub *chat.Hub, router *chat.Router, token string, allowFrom []string) error {
 	if token == "" {
 		return fmt.Errorf("discord token not provided")
 	}
@@ -100,54 +100,115 @@ func StartDiscord(ctx context.Context, hub *chat.Hub, token string, allowFrom []
 		}
 	}()
 
-	// Outbound sender goroutine
-	go func() {
-		client := &http.Client{Timeout: 10 * time.Second}
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("discord: stopping outbound sender")
-				return
-			case out := <-hub.Out:
-				if out.Channel != "discord" {
-					continue
-				}
-				// Stop typing indicator for this channel
-				typingMu.Lock()
-				delete(typingChannels, out.ChatID)
-				typingMu.Unlock()
-				u := discordAPIBase + "/channels/" + out.ChatID + "/messages"
-				for _, chunk := range splitContent(out.Content, discordMaxLen) {
-					body := map[string]interface{}{"content": chunk}
-					b, _ := json.Marshal(body)
-					req, err := http.NewRequest("POST", u, bytes.NewReader(b))
-					if err != nil {
-						log.Printf("discord sendMessage error: %v", err)
-						continue
-					}
-					req.Header.Set("Authorization", "Bot "+token)
-					req.Header.Set("Content-Type", "application/json")
-					resp, err := client.Do(req)
-					if err != nil {
-						log.Printf("discord sendMessage error: %v", err)
-						continue
-					}
-					io.Copy(io.Discard, resp.Body)
-					resp.Body.Close()
-					if resp.StatusCode >= 400 {
-						log.Printf("discord sendMessage HTTP %d", resp.StatusCode)
-						break
-					}
-				}
-			}
-		}
-	}()
+	router.Register(&discordSender{
+		apiBase:        discordAPIBase,
+		token:          token,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		typingMu:       &typingMu,
+		typingChannels: typingChannels,
+		streams:        newStreamEditor(streamEditInterval),
+	})
 
 	// Gateway connection loop with reconnect
 	go runGateway(ctx, hub, token, allowed, &typingMu, typingChannels)
 	return nil
 }
 
+// discordSender delivers outbound messages to a DM channel via the REST API.
+// Streamed replies are rendered by PATCHing the first message.
+type discordSender struct {
+	apiBase        string
+	token          string
+	client         *http.Client
+	typingMu       *sync.Mutex
+	typingChannels map[string]struct{}
+	streams        *streamEditor
+}
+
+func (d *discordSender) Name() string { return "discord" }
+
+func (d *discordSender) Send(out chat.Outbound) error {
+	// Stop typing indicator for this channel
+	d.typingMu.Lock()
+	delete(d.typingChannels, out.ChatID)
+	d.typingMu.Unlock()
+	chunks := splitContent(discordThinking(out.Thinking)+out.Content, discordMaxLen)
+	if msgID, shown, ok := d.streams.finish(out.StreamID); ok {
+		if chunks[0] != shown {
+			if err := d.editMessage(out.ChatID, msgID, chunks[0]); err != nil {
+				return err
+			}
+		}
+		chunks = chunks[1:]
+	}
+	for _, chunk := range chunks {
+		if _, err := d.createMessage(out.ChatID, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *discordSender) SendPartial(out chat.Outbound) error {
+	out.Content = splitContent(out.Content, discordMaxLen)[0]
+	return d.streams.partial(out,
+		func(text string) (string, error) { return d.createMessage(out.ChatID, text) },
+		func(msgID, text string) error { return d.editMessage(out.ChatID, msgID, text) },
+	)
+}
+
+// createMessage posts a new message and returns its ID.
+func (d *discordSender) createMessage(channelID, content string) (string, error) {
+	body, err := d.do("POST", "/channels/"+channelID+"/messages", content)
+	if err != nil {
+		return "", fmt.Errorf("sendMessage: %w", err)
+	}
+	var msg struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(body, &msg)
+	return msg.ID, nil
+}
+
+// editMessage replaces the content of a message previously sent by the bot.
+func (d *discordSender) editMessage(channelID, messageID, content string) error {
+	if _, err := d.do("PATCH", "/channels/"+channelID+"/messages/"+messageID, content); err != nil {
+		return fmt.Errorf("editMessage: %w", err)
+	}
+	return nil
+}
+
+func (d *discordSender) do(method, path, content string) ([]byte, error) {
+	return d.request(method, path, map[string]interface{}{"content": content})
+}
+
+// request calls the REST API with payload, if not nil, as the JSON body.
+func (d *discordSender) request(method, path string, payload interface{}) ([]byte, error) {
+	var r io.Reader
+	if payload != nil {
+		b, _ := json.Marshal(payload)
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, d.apiBase+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bot "+d.token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
 func runGateway(ctx context.Context, hub *chat.Hub, token string, allowed map[string]struct{}, typingMu *sync.Mutex, typingChannels map[string]struct{}) {
 	for {
 		select {
@@ -227,6 +288,12 @@ func connectGateway(ctx context.Context, hub *chat.Hub, token string, allowed ma
 				if payload.T == "MESSAGE_CREATE" {
 					handleMessageCreate(payload.D, hub, token, allowed, typingMu, typingChannels)
 				}
+				if payload.T == "MESSAGE_REACTION_ADD" {
+					handleReactionAdd(payload.D, hub, allowed)
+				}
+				if payload.T == "INTERACTION_CREATE" {
+					handleInteractionCreate(payload.D, hub, discordAPIBase, allowed)
+				}
 			}
 		}
 	}()
@@ -247,7 +314,7 @@ func connectGateway(ctx context.Context, hub *chat.Hub, token string, allowed ma
 				"browser": "picobot",
 				"device":  "picobot",
 			},
-			"intents": 1<<12 | 1<<15, // DIRECT_MESSAGES | MESSAGE_CONTENT
+			"intents": 1<<12 | 1<<13 | 1<<15, // DIRECT_MESSAGES | DIRECT_MESSAGE_REACTIONS | MESSAGE_CONTENT
 		},
 	}
 	if err := conn.WriteJSON(identify); err != nil {
@@ -349,6 +416,130 @@ func handleMessageCreate(d json.RawMessage, hub *chat.Hub, token string, allowed
 	}
 }
 
+// handleReactionAdd turns a stop reaction in a DM into a /stop message for the agent.
+func handleReactionAdd(d json.RawMessage, hub *chat.Hub, allowed map[string]struct{}) {
+	var r struct {
+		UserID    string `json:"user_id"`
+		ChannelID string `json:"channel_id"`
+		GuildID   string `json:"guild_id"`
+		Emoji     struct {
+			Name string `json:"name"`
+		} `json:"emoji"`
+	}
+	if err := json.Unmarshal(d, &r); err != nil || r.GuildID != "" || !isStopReaction(r.Emoji.Name) {
+		return
+	}
+	if _, ok := allowed[r.UserID]; len(allowed) > 0 && !ok {
+		return
+	}
+	hub.In <- chat.Inbound{Channel: "discord", SenderID: r.UserID, ChatID: r.ChannelID, Content: stopCommand, Timestamp: time.Now()}
+}
+
+// handleInteractionCreate turns a slash command used in a DM into a "/name args" message for
+// the agent. The interaction is answered with the command itself; the agent's reply follows
+// as a normal message.
+func handleInteractionCreate(d json.RawMessage, hub *chat.Hub, apiBase string, allowed map[string]struct{}) {
+	var in struct {
+		ID        string `json:"id"`
+		Token     string `json:"token"`
+		Type      int    `json:"type"`
+		ChannelID string `json:"channel_id"`
+		GuildID   string `json:"guild_id"`
+		User      *struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		Data struct {
+			Name    string `json:"name"`
+			Options []struct {
+				Value interface{} `json:"value"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(d, &in); err != nil || in.Type != 2 || in.GuildID != "" || in.User == nil { // 2 = APPLICATION_COMMAND
+		return
+	}
+	content := "/" + in.Data.Name
+	for _, o := range in.Data.Options {
+		content += " " + fmt.Sprint(o.Value)
+	}
+	reply := content
+	_, ok := allowed[in.User.ID]
+	authorized := ok || len(allowed) == 0
+	if !authorized {
+		log.Printf("discord: dropping command from unauthorized user %s", in.User.ID)
+		reply = "Sorry, you are not allowed to use this bot."
+	}
+	// CHANNEL_MESSAGE_WITH_SOURCE; Discord shows an error unless the interaction is answered
+	b, _ := json.Marshal(map[string]interface{}{"type": 4, "data": map[string]string{"content": reply}})
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(apiBase+"/interactions/"+in.ID+"/"+in.Token+"/callback", "application/json", bytes.NewReader(b))
+	if err != nil {
+		log.Printf("discord: interaction callback error: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+	if !authorized {
+		return
+	}
+	hub.In <- chat.Inbound{Channel: "discord", SenderID: in.User.ID, ChatID: in.ChannelID, Content: content, Timestamp: time.Now()}
+}
+
+// SetDiscordCommands registers cmds as the bot's slash commands in DMs, so they
+// autocomplete after "/". Commands with Args get one optional text option.
+func SetDiscordCommands(token string, cmds []Command) error {
+	if token == "" {
+		return fmt.Errorf("discord token not provided")
+	}
+	return setDiscordCommands(&http.Client{Timeout: 10 * time.Second}, discordAPIBase, token, cmds)
+}
+
+// discordCommandDescLen is Discord's limit for command and option descriptions.
+const discordCommandDescLen = 100
+
+func setDiscordCommands(client *http.Client, apiBase, token string, cmds []Command) error {
+	d := &discordSender{apiBase: apiBase, token: token, client: client}
+	body, err := d.request("GET", "/applications/@me", nil)
+	if err != nil {
+		return fmt.Errorf("get application: %w", err)
+	}
+	var app struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &app); err != nil || app.ID == "" {
+		return fmt.Errorf("get application: no id in response")
+	}
+
+	type option struct {
+		Type        int    `json:"type"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	type command struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Type        int      `json:"type"`
+		Options     []option `json:"options,omitempty"`
+		Contexts    []int    `json:"contexts"`
+	}
+	list := []command{}
+	for _, c := range menuCommands(cmds, discordCommandDescLen) {
+		// type 1 = CHAT_INPUT (slash command), option type 3 = STRING, context 1 = BOT_DM
+		cmd := command{Name: c.Name, Description: c.Description, Type: 1, Contexts: []int{1}}
+		if c.Args != "" {
+			desc := []rune(c.Args)
+			if len(desc) > discordCommandDescLen {
+				desc = desc[:discordCommandDescLen]
+			}
+			cmd.Options = []option{{Type: 3, Name: "args", Description: string(desc)}}
+		}
+		list = append(list, cmd)
+	}
+	if _, err := d.request("PUT", "/applications/"+app.ID+"/commands", list); err != nil {
+		return fmt.Errorf("set commands: %w", err)
+	}
+	return nil
+}
+
 type discordAttachment struct {
 	URL         string `json:"url"`
 	ContentType string `json:"content_type"`
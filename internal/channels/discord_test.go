@@ -1,6 +1,17 @@
 package channels
 
-import "testing"
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
 
 func TestSplitContent(t *testing.T) {
 	tests := []struct {
@@ -37,3 +48,130 @@ func TestSplitContent(t *testing.T) {
 		})
 	}
 }
+
+func TestDiscordSenderStreamsByEditing(t *testing.T) {
+	type call struct{ method, path, content string }
+	var mu sync.Mutex
+	var calls []call
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload struct {
+			Content string `json:"content"`
+		}
+		json.Unmarshal(body, &payload)
+		mu.Lock()
+		calls = append(calls, call{r.Method, r.URL.Path, payload.Content})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"m1"}`))
+	}))
+	defer h.Close()
+
+	var typingMu sync.Mutex
+	d := &discordSender{
+		apiBase:        h.URL,
+		token:          "t",
+		client:         &http.Client{Timeout: 2 * time.Second},
+		typingMu:       &typingMu,
+		typingChannels: map[string]struct{}{"c1": {}},
+		streams:        newStreamEditor(time.Hour),
+	}
+
+	// first partial posts, second is throttled, final edits the posted message
+	if err := d.SendPartial(chat.Outbound{Channel: "discord", ChatID: "c1", Content: "Hel", StreamID: "s1", Partial: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SendPartial(chat.Outbound{Channel: "discord", ChatID: "c1", Content: "Hello wo", StreamID: "s1", Partial: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Send(chat.Outbound{Channel: "discord", ChatID: "c1", Content: "Hello world", StreamID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []call{
+		{"POST", "/channels/c1/messages", "Hel"},
+		{"PATCH", "/channels/c1/messages/m1", "Hello world"},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got calls %+v, want %+v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call[%d] = %+v, want %+v", i, calls[i], want[i])
+		}
+	}
+	if _, typing := d.typingChannels["c1"]; typing {
+		t.Error("expected final send to stop the typing indicator")
+	}
+}
+
+func TestDiscordStopReaction(t *testing.T) {
+	hub := chat.NewHub(4)
+	allowed := map[string]struct{}{"u1": {}}
+	handleReactionAdd([]byte(`{"user_id":"u1","channel_id":"c1","emoji":{"name":"👍"}}`), hub, allowed)
+	handleReactionAdd([]byte(`{"user_id":"u2","channel_id":"c1","emoji":{"name":"🛑"}}`), hub, allowed)
+	handleReactionAdd([]byte(`{"user_id":"u1","channel_id":"c1","guild_id":"g","emoji":{"name":"🛑"}}`), hub, allowed)
+	handleReactionAdd([]byte(`{"user_id":"u1","channel_id":"c1","emoji":{"name":"🛑"}}`), hub, allowed)
+	if len(hub.In) != 1 {
+		t.Fatalf("expected only the DM stop reaction of an allowed user to pass, got %d messages", len(hub.In))
+	}
+	if msg := <-hub.In; msg.Content != "/stop" || msg.ChatID != "c1" || msg.SenderID != "u1" {
+		t.Fatalf("unexpected inbound %+v", msg)
+	}
+}
+
+func TestSetDiscordCommands(t *testing.T) {
+	var put []byte
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/applications/@me":
+			w.Write([]byte(`{"id":"app1"}`))
+		case r.Method == "PUT" && r.URL.Path == "/applications/app1/commands":
+			put, _ = io.ReadAll(r.Body)
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer h.Close()
+
+	cmds := []Command{{Name: "model", Description: "Change the model", Args: "model name"}, {Name: "help", Description: "List the commands"}}
+	if err := setDiscordCommands(h.Client(), h.URL, "tok", cmds); err != nil {
+		t.Fatalf("setDiscordCommands: %v", err)
+	}
+	want := `[{"name":"model","description":"Change the model","type":1,"options":[{"type":3,"name":"args","description":"model name"}],"contexts":[1]},` +
+		`{"name":"help","description":"List the commands","type":1,"contexts":[1]}]`
+	if string(put) != want {
+		t.Fatalf("PUT body = %s\nwant %s", put, want)
+	}
+}
+
+func TestDiscordInteractionBecomesCommand(t *testing.T) {
+	callbacks := make(chan string, 2)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		callbacks <- r.URL.Path + " " + string(b)
+		w.WriteHeader(204)
+	}))
+	defer h.Close()
+
+	hub := chat.NewHub(4)
+	allowed := map[string]struct{}{"u1": {}}
+	handleInteractionCreate([]byte(`{"id":"i1","token":"t1","type":2,"channel_id":"c1","user":{"id":"u1"},"data":{"name":"model","options":[{"name":"args","type":3,"value":"gpt-4o"}]}}`), hub, h.URL, allowed)
+	handleInteractionCreate([]byte(`{"id":"i2","token":"t2","type":2,"channel_id":"c1","user":{"id":"u2"},"data":{"name":"reset"}}`), hub, h.URL, allowed)
+
+	if got := <-callbacks; got != `/interactions/i1/t1/callback {"data":{"content":"/model gpt-4o"},"type":4}` {
+		t.Fatalf("unexpected callback %s", got)
+	}
+	if got := <-callbacks; !strings.Contains(got, "not allowed") {
+		t.Fatalf("expected the unauthorized user to be told off, got %s", got)
+	}
+	if len(hub.In) != 1 {
+		t.Fatalf("expected only the allowed user's command to reach the agent, got %d", len(hub.In))
+	}
+	if msg := <-hub.In; msg.Content != "/model gpt-4o" || msg.ChatID != "c1" || msg.SenderID != "u1" {
+		t.Fatalf("unexpected inbound %+v", msg)
+	}
+}
@@ -0,0 +1,14 @@
+package channels
+
+// stopCommand is sent to the agent when a user reacts with a stop emoji: it cancels the
+// chat's current run.
+const stopCommand = "/stop"
+
+// stopReactions are the emoji that stop a run. Telegram only allows a fixed set of
+// reactions, hence 👎 next to the more natural 🛑 and ✋.
+var stopReactions = map[string]bool{"🛑": true, "⛔": true, "✋": true, "👎": true}
+
+// isStopReaction reports whether emoji asks to stop the current run.
+func isStopReaction(emoji string) bool {
+	return stopReactions[emoji]
+}
@@ -0,0 +1,113 @@
+package channels
+
+import (
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// streamEditInterval is the minimum time between edits of a streamed message.
+// Both Telegram and Discord rate-limit message edits to roughly one per second per chat.
+const streamEditInterval = 1200 * time.Millisecond
+
+// streamStaleAfter is how long a stream may go without updates before it is forgotten. A run
+// that fails before its final message would otherwise leave its stream tracked forever.
+const streamStaleAfter = 10 * time.Minute
+
+// streamEditor tracks messages that are being rendered progressively, keyed by Outbound.StreamID.
+// The first partial update posts a new message; later updates edit it at most once per interval;
+// the final message always replaces whatever partial text was shown. The router sends to
+// different chats concurrently, and the lock is not held during send and edit calls, so a
+// slow edit only delays its own chat.
+type streamEditor struct {
+	mu       sync.Mutex
+	interval time.Duration
+	streams  map[string]*streamState
+}
+
+type streamState struct {
+	messageID string
+	text      string
+	lastEdit  time.Time
+	lastSeen  time.Time
+	busy      bool // a send or edit is in flight; updates meanwhile are skipped
+}
+
+func newStreamEditor(interval time.Duration) *streamEditor {
+	return &streamEditor{interval: interval, streams: make(map[string]*streamState)}
+}
+
+// partial renders an in-progress update. send posts a new message and returns its ID;
+// edit replaces the text of a previously posted message.
+func (e *streamEditor) partial(out chat.Outbound, send func(text string) (string, error), edit func(messageID, text string) error) error {
+	if out.StreamID == "" || out.Content == "" {
+		return nil
+	}
+	now := time.Now()
+	e.mu.Lock()
+	e.expire(now)
+	st := e.streams[out.StreamID]
+	if st == nil {
+		st = &streamState{lastSeen: now, busy: true}
+		e.streams[out.StreamID] = st
+		e.mu.Unlock()
+		id, err := send(out.Content)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		st.busy = false
+		if err != nil {
+			if e.streams[out.StreamID] == st {
+				delete(e.streams, out.StreamID)
+			}
+			return err
+		}
+		st.messageID, st.text, st.lastEdit = id, out.Content, time.Now()
+		return nil
+	}
+	st.lastSeen = now
+	if st.busy || out.Content == st.text || now.Sub(st.lastEdit) < e.interval {
+		e.mu.Unlock()
+		return nil // throttled; the final message will carry the complete text
+	}
+	st.busy = true
+	messageID := st.messageID
+	e.mu.Unlock()
+	err := edit(messageID, out.Content)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st.busy = false
+	if err != nil {
+		return err
+	}
+	st.text, st.lastEdit = out.Content, time.Now()
+	return nil
+}
+
+// expire forgets streams not updated for streamStaleAfter. The caller holds e.mu.
+func (e *streamEditor) expire(now time.Time) {
+	for id, st := range e.streams {
+		if !st.busy && now.Sub(st.lastSeen) > streamStaleAfter {
+			delete(e.streams, id)
+		}
+	}
+}
+
+// finish takes the tracked message for a stream, if any. It returns ok=false when no partial
+// was ever shown, in which case the caller should send the final message normally.
+func (e *streamEditor) finish(streamID string) (messageID, shownText string, ok bool) {
+	if streamID == "" {
+		return "", "", false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st := e.streams[streamID]
+	if st == nil {
+		return "", "", false
+	}
+	delete(e.streams, streamID)
+	if st.messageID == "" {
+		return "", "", false // the first partial is still being posted
+	}
+	return st.messageID, st.text, true
+}
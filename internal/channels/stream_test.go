@@ -0,0 +1,65 @@
+package channels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestStreamEditorSlowSendDoesNotBlockOtherStreams(t *testing.T) {
+	e := newStreamEditor(0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- e.partial(chat.Outbound{StreamID: "slow", Content: "a"},
+			func(string) (string, error) { close(started); <-release; return "1", nil },
+			func(string, string) error { return nil })
+	}()
+	<-started
+
+	fast := make(chan error)
+	go func() {
+		fast <- e.partial(chat.Outbound{StreamID: "fast", Content: "b"},
+			func(string) (string, error) { return "2", nil },
+			func(string, string) error { return nil })
+	}()
+	select {
+	case err := <-fast:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow send blocked another stream")
+	}
+	// an update while the first message is still being posted is skipped
+	if err := e.partial(chat.Outbound{StreamID: "slow", Content: "ab"},
+		func(string) (string, error) { t.Fatal("posted twice"); return "", nil },
+		func(string, string) error { t.Fatal("edited during send"); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if id, shown, ok := e.finish("slow"); !ok || id != "1" || shown != "a" {
+		t.Fatalf("finish = %q, %q, %v", id, shown, ok)
+	}
+}
+
+func TestStreamEditorExpiresStaleStreams(t *testing.T) {
+	e := newStreamEditor(0)
+	send := func(string) (string, error) { return "1", nil }
+	edit := func(string, string) error { return nil }
+	if err := e.partial(chat.Outbound{StreamID: "old", Content: "a"}, send, edit); err != nil {
+		t.Fatal(err)
+	}
+	e.streams["old"].lastSeen = time.Now().Add(-2 * streamStaleAfter)
+	if err := e.partial(chat.Outbound{StreamID: "new", Content: "b"}, send, edit); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.streams["old"]; ok || len(e.streams) != 1 {
+		t.Fatalf("expected the stale stream to be dropped, have %v", e.streams)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
@@ -18,17 +19,18 @@ import (
 // with the standard Telegram base URL.
 // allowFrom is a list of Telegram user IDs permitted to interact with the bot.
 // If empty, ALL users are allowed (open mode).
-func StartTelegram(ctx context.Context, hub *chat.Hub, token string, allowFrom []string) error {
+// Replies are delivered by registering a sender with router.
+func StartTelegram(ctx context.Context, hub *chat.Hub, router *chat.Router, token string, allowFrom []string) error {
 	if token == "" {
 		return fmt.Errorf("telegram token not provided")
 	}
 	base := "https://api.telegram.org/bot" + token
-	return StartTelegramWithBase(ctx, hub, token, base, allowFrom)
+	return StartTelegramWithBase(ctx, hub, router, token, base, allowFrom)
 }
 
 // StartTelegramWithBase starts long-polling against the given base URL (e.g., https://api.telegram.org/bot<TOKEN> or a test server URL).
 // allowFrom restricts which Telegram user IDs may send messages. Empty means allow all.
-func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base string, allowFrom []string) error {
+func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, router *chat.Router, token, base string, allowFrom []string) error {
 	if base == "" {
 		return fmt.Errorf("base URL is required")
 	}
@@ -55,6 +57,7 @@ func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base strin
 			values := url.Values{}
 			values.Set("offset", strconv.FormatInt(offset, 10))
 			values.Set("timeout", "30")
+			values.Set("allowed_updates", `["message","callback_query","message_reaction"]`)
 			u := base + "/getUpdates"
 			resp, err := client.PostForm(u, values)
 			if err != nil {
@@ -78,6 +81,31 @@ func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base strin
 						} `json:"chat"`
 						Text string `json:"text"`
 					} `json:"message"`
+					CallbackQuery *struct {
+						ID   string `json:"id"`
+						From struct {
+							ID int64 `json:"id"`
+						} `json:"from"`
+						Message *struct {
+							MessageID int64 `json:"message_id"`
+							Chat      struct {
+								ID int64 `json:"id"`
+							} `json:"chat"`
+						} `json:"message"`
+						Data string `json:"data"`
+					} `json:"callback_query"`
+					MessageReaction *struct {
+						Chat struct {
+							ID int64 `json:"id"`
+						} `json:"chat"`
+						User *struct {
+							ID int64 `json:"id"`
+						} `json:"user"`
+						NewReaction []struct {
+							Type  string `json:"type"`
+							Emoji string `json:"emoji"`
+						} `json:"new_reaction"`
+					} `json:"message_reaction"`
 				} `json:"result"`
 			}
 			if err := json.Unmarshal(body, &gu); err != nil {
@@ -88,6 +116,38 @@ func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base strin
 				if upd.UpdateID >= offset {
 					offset = upd.UpdateID + 1
 				}
+				if cq := upd.CallbackQuery; cq != nil && cq.Message != nil {
+					// an inline keyboard button was pressed: acknowledge it, remove the
+					// keyboard so it can't be pressed twice, and pass its data on as a message
+					fromID := strconv.FormatInt(cq.From.ID, 10)
+					chatID := strconv.FormatInt(cq.Message.Chat.ID, 10)
+					telegramPost(client, base, "answerCallbackQuery", url.Values{"callback_query_id": {cq.ID}})
+					if _, ok := allowed[fromID]; len(allowed) > 0 && !ok {
+						log.Printf("telegram: dropping button press from unauthorized user %s", fromID)
+						continue
+					}
+					telegramPost(client, base, "editMessageReplyMarkup", url.Values{
+						"chat_id":      {chatID},
+						"message_id":   {strconv.FormatInt(cq.Message.MessageID, 10)},
+						"reply_markup": {`{"inline_keyboard":[]}`},
+					})
+					hub.In <- chat.Inbound{Channel: "telegram", SenderID: fromID, ChatID: chatID, Content: cq.Data, Timestamp: time.Now()}
+					continue
+				}
+				if mr := upd.MessageReaction; mr != nil && mr.User != nil {
+					// a stop reaction on any message cancels the chat's current run
+					fromID := strconv.FormatInt(mr.User.ID, 10)
+					if _, ok := allowed[fromID]; len(allowed) > 0 && !ok {
+						continue
+					}
+					for _, r := range mr.NewReaction {
+						if r.Type == "emoji" && isStopReaction(r.Emoji) {
+							hub.In <- chat.Inbound{Channel: "telegram", SenderID: fromID, ChatID: strconv.FormatInt(mr.Chat.ID, 10), Content: stopCommand, Timestamp: time.Now()}
+							break
+						}
+					}
+					continue
+				}
 				if upd.Message == nil {
 					continue
 				}
@@ -115,33 +175,181 @@ func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base strin
 		}
 	}()
 
-	// outbound sender goroutine
-	go func() {
-		client := &http.Client{Timeout: 10 * time.Second}
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("telegram: stopping outbound sender")
-				return
-			case out := <-hub.Out:
-				if out.Channel != "telegram" {
-					// ignore messages for other channels
-					continue
-				}
-				u := base + "/sendMessage"
-				v := url.Values{}
-				v.Set("chat_id", out.ChatID)
-				v.Set("text", out.Content)
-				resp, err := client.PostForm(u, v)
-				if err != nil {
-					log.Printf("telegram sendMessage error: %v", err)
-					continue
-				}
-				io.ReadAll(resp.Body)
-				resp.Body.Close()
+	router.Register(&telegramSender{
+		base:    base,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		streams: newStreamEditor(streamEditInterval),
+	})
+	return nil
+}
+
+// telegramPost calls a Bot API method from the polling loop, where failures are only logged.
+func telegramPost(client *http.Client, base, method string, v url.Values) {
+	resp, err := client.PostForm(base+"/"+method, v)
+	if err != nil {
+		log.Printf("telegram %s error: %v", method, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// SetTelegramCommands registers cmds as the bot's command menu, so they autocomplete after "/".
+func SetTelegramCommands(token string, cmds []Command) error {
+	if token == "" {
+		return fmt.Errorf("telegram token not provided")
+	}
+	return setTelegramCommands(&http.Client{Timeout: 10 * time.Second}, "https://api.telegram.org/bot"+token, cmds)
+}
+
+// telegramCommandDescLen is the Bot API limit for a command description.
+const telegramCommandDescLen = 256
+
+func setTelegramCommands(client *http.Client, base string, cmds []Command) error {
+	type botCommand struct {
+		Command     string `json:"command"`
+		Description string `json:"description"`
+	}
+	list := []botCommand{}
+	for _, c := range menuCommands(cmds, telegramCommandDescLen) {
+		list = append(list, botCommand{Command: c.Name, Description: c.Description})
+	}
+	b, _ := json.Marshal(list)
+	resp, err := client.PostForm(base+"/setMyCommands", url.Values{"commands": {string(b)}})
+	if err != nil {
+		return fmt.Errorf("setMyCommands: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("setMyCommands HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// telegramMaxLen is the Bot API limit for message text.
+const telegramMaxLen = 4096
+
+// telegramSender delivers outbound messages via the Bot API. Streamed replies are
+// rendered by editing the first message with editMessageText.
+type telegramSender struct {
+	base    string
+	client  *http.Client
+	streams *streamEditor
+}
+
+func (t *telegramSender) Name() string { return "telegram" }
+
+func (t *telegramSender) Send(out chat.Outbound) error {
+	thinking := telegramThinking(out.Thinking)
+	maxLen := telegramMaxLen
+	if thinking != "" {
+		// the limit counts text after entity parsing: the summary, its emoji and the newline
+		maxLen -= len([]rune(thinkingSummary(out.Thinking))) + 4
+	}
+	chunks := splitContent(out.Content, maxLen)
+	// only the first chunk carries the summary, and is then sent as HTML
+	first, parseMode := chunks[0], ""
+	if thinking != "" {
+		first, parseMode = thinking+html.EscapeString(chunks[0]), "HTML"
+	}
+	// buttons go on the last chunk
+	buttons := func(i int) []chat.Button {
+		if i == len(chunks)-1 {
+			return out.Buttons
+		}
+		return nil
+	}
+	if msgID, shown, ok := t.streams.finish(out.StreamID); ok {
+		if first != shown || len(buttons(0)) > 0 {
+			if err := t.editMessage(out.ChatID, msgID, first, parseMode, buttons(0)); err != nil {
+				return err
 			}
 		}
-	}()
-
+	} else if _, err := t.sendMessage(out.ChatID, first, parseMode, buttons(0)); err != nil {
+		return err
+	}
+	for i, chunk := range chunks[1:] {
+		if _, err := t.sendMessage(out.ChatID, chunk, "", buttons(i+1)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func (t *telegramSender) SendPartial(out chat.Outbound) error {
+	text := splitContent(out.Content, telegramMaxLen)[0]
+	out.Content = text
+	return t.streams.partial(out,
+		func(text string) (string, error) { return t.sendMessage(out.ChatID, text, "", nil) },
+		func(msgID, text string) error { return t.editMessage(out.ChatID, msgID, text, "", nil) },
+	)
+}
+
+// sendMessage posts a new message and returns its message_id. parseMode is "" for plain text;
+// buttons, if any, are shown as an inline keyboard.
+func (t *telegramSender) sendMessage(chatID, text, parseMode string, buttons []chat.Button) (string, error) {
+	v := url.Values{}
+	v.Set("chat_id", chatID)
+	v.Set("text", text)
+	if parseMode != "" {
+		v.Set("parse_mode", parseMode)
+	}
+	if len(buttons) > 0 {
+		v.Set("reply_markup", inlineKeyboard(buttons))
+	}
+	body, err := t.call("sendMessage", v)
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		Result struct {
+			MessageID int64 `json:"message_id"`
+		} `json:"result"`
+	}
+	_ = json.Unmarshal(body, &res)
+	return strconv.FormatInt(res.Result.MessageID, 10), nil
+}
+
+// inlineKeyboard returns the reply_markup JSON for buttons, laid out in one row.
+func inlineKeyboard(buttons []chat.Button) string {
+	type button struct {
+		Text         string `json:"text"`
+		CallbackData string `json:"callback_data"`
+	}
+	row := make([]button, len(buttons))
+	for i, b := range buttons {
+		row[i] = button{Text: b.Text, CallbackData: b.Data}
+	}
+	b, _ := json.Marshal(map[string][][]button{"inline_keyboard": {row}})
+	return string(b)
+}
+
+// editMessage replaces the text of a message previously sent by the bot.
+func (t *telegramSender) editMessage(chatID, messageID, text, parseMode string, buttons []chat.Button) error {
+	v := url.Values{}
+	v.Set("chat_id", chatID)
+	v.Set("message_id", messageID)
+	v.Set("text", text)
+	if parseMode != "" {
+		v.Set("parse_mode", parseMode)
+	}
+	if len(buttons) > 0 {
+		v.Set("reply_markup", inlineKeyboard(buttons))
+	}
+	_, err := t.call("editMessageText", v)
+	return err
+}
+
+// call posts form values to a Bot API method and returns the response body.
+func (t *telegramSender) call(method string, v url.Values) ([]byte, error) {
+	resp, err := t.client.PostForm(t.base+"/"+method, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s HTTP %d", method, resp.StatusCode)
+	}
+	return body, nil
+}
@@ -47,7 +47,9 @@ func TestStartTelegramWithBase(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err := StartTelegramWithBase(ctx, b, token, base, nil); err != nil {
+	router := chat.NewRouter(b)
+	go router.Run(ctx)
+	if err := StartTelegramWithBase(ctx, b, router, token, base, nil); err != nil {
 		t.Fatalf("StartTelegramWithBase failed: %v", err)
 	}
 
@@ -82,3 +84,95 @@ func TestStartTelegramWithBase(t *testing.T) {
 	// give a small grace period
 	time.Sleep(50 * time.Millisecond)
 }
+
+func TestTelegramButtonsAndReactions(t *testing.T) {
+	calls := make(chan string, 8)
+	sent := make(chan url.Values, 4)
+	first := true
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch method {
+		case "getUpdates":
+			if first {
+				first = false
+				w.Write([]byte(`{"ok":true,"result":[{"update_id":1,"callback_query":{"id":"cb1","from":{"id":123},"message":{"message_id":7,"chat":{"id":456}},"data":"/approve abc"}},{"update_id":2,"message_reaction":{"chat":{"id":456},"user":{"id":123},"new_reaction":[{"type":"emoji","emoji":"👎"}]}}]}`))
+				return
+			}
+			w.Write([]byte(`{"ok":true,"result":[]}`))
+		case "sendMessage":
+			sent <- r.PostForm
+			w.Write([]byte(`{"ok":true,"result":{"message_id":8}}`))
+		default:
+			calls <- method
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router := chat.NewRouter(b)
+	go router.Run(ctx)
+	if err := StartTelegramWithBase(ctx, b, router, "tok", h.URL+"/bottok", []string{"123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-b.In:
+		if msg.Content != "/approve abc" || msg.ChatID != "456" || msg.SenderID != "123" {
+			t.Fatalf("unexpected inbound %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the button press")
+	}
+	for _, want := range []string{"answerCallbackQuery", "editMessageReplyMarkup"} {
+		if got := <-calls; got != want {
+			t.Errorf("called %s, want %s", got, want)
+		}
+	}
+
+	select {
+	case msg := <-b.In:
+		if msg.Content != "/stop" || msg.ChatID != "456" {
+			t.Fatalf("a stop reaction should become /stop, got %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the stop reaction")
+	}
+
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: "456", Content: "ok?", Buttons: []chat.Button{{Text: "Yes", Data: "/approve x"}}}
+	select {
+	case v := <-sent:
+		if got := v.Get("reply_markup"); got != `{"inline_keyboard":[[{"text":"Yes","callback_data":"/approve x"}]]}` {
+			t.Fatalf("unexpected reply_markup %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for sendMessage")
+	}
+}
+
+func TestSetTelegramCommands(t *testing.T) {
+	var got url.Values
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/setMyCommands") {
+			w.WriteHeader(404)
+			return
+		}
+		r.ParseForm()
+		got = r.PostForm
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer h.Close()
+
+	cmds := []Command{{Name: "reset", Description: "Forget this conversation"}, {Name: "Bad-Name"}, {Name: "jobs"}}
+	if err := setTelegramCommands(h.Client(), h.URL+"/botx", cmds); err != nil {
+		t.Fatalf("setTelegramCommands: %v", err)
+	}
+	want := `[{"command":"reset","description":"Forget this conversation"},{"command":"jobs","description":"/jobs"}]`
+	if got.Get("commands") != want {
+		t.Fatalf("commands = %s, want %s", got.Get("commands"), want)
+	}
+}
@@ -0,0 +1,40 @@
+package channels
+
+import (
+	"html"
+	"strings"
+)
+
+// thinkingSummaryLen caps the reasoning shown above a reply, in runes; the full text is in the log.
+const thinkingSummaryLen = 600
+
+// thinkingSummary flattens reasoning into one paragraph of at most thinkingSummaryLen runes.
+func thinkingSummary(reasoning string) string {
+	s := strings.Join(strings.Fields(reasoning), " ")
+	if r := []rune(s); len(r) > thinkingSummaryLen {
+		s = string(r[:thinkingSummaryLen-1]) + "…"
+	}
+	return s
+}
+
+// discordThinking renders reasoning as a small spoiler line to put above the reply,
+// or "" if there is none. The reader clicks the spoiler to reveal it.
+func discordThinking(reasoning string) string {
+	s := thinkingSummary(reasoning)
+	if s == "" {
+		return ""
+	}
+	// a "||" inside would end the spoiler early
+	s = strings.ReplaceAll(s, "||", "| |")
+	return "-# 💭 Thinking: ||" + s + "||\n"
+}
+
+// telegramThinking renders reasoning as an HTML expandable blockquote to put above the
+// reply, or "" if there is none. The message must then be sent with parse_mode HTML.
+func telegramThinking(reasoning string) string {
+	s := thinkingSummary(reasoning)
+	if s == "" {
+		return ""
+	}
+	return "<blockquote expandable>💭 " + html.EscapeString(s) + "</blockquote>\n"
+}
@@ -0,0 +1,64 @@
+package channels
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestThinkingSummary(t *testing.T) {
+	if got := thinkingSummary("  step one\n\n  step   two "); got != "step one step two" {
+		t.Fatalf("expected whitespace collapsed, got %q", got)
+	}
+	long := thinkingSummary(strings.Repeat("x", 2*thinkingSummaryLen))
+	if n := len([]rune(long)); n != thinkingSummaryLen || !strings.HasSuffix(long, "…") {
+		t.Fatalf("expected %d runes ending in an ellipsis, got %d", thinkingSummaryLen, n)
+	}
+	if discordThinking("") != "" || telegramThinking(" \n") != "" {
+		t.Fatal("expected no header without reasoning")
+	}
+	if got := discordThinking("a || b"); got != "-# 💭 Thinking: ||a | | b||\n" {
+		t.Fatalf("unexpected discord header %q", got)
+	}
+}
+
+func TestTelegramSendsThinkingAsHTML(t *testing.T) {
+	var mu sync.Mutex
+	var forms []map[string]string
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		forms = append(forms, map[string]string{"text": r.PostForm.Get("text"), "parse_mode": r.PostForm.Get("parse_mode")})
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer h.Close()
+
+	s := &telegramSender{base: h.URL, client: &http.Client{Timeout: 2 * time.Second}, streams: newStreamEditor(time.Hour)}
+	if err := s.Send(chat.Outbound{ChatID: "42", Content: "1 < 2", Thinking: "compare <numbers>"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(chat.Outbound{ChatID: "42", Content: "plain <b>"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []map[string]string{
+		{"text": "<blockquote expandable>💭 compare &lt;numbers&gt;</blockquote>\n1 &lt; 2", "parse_mode": "HTML"},
+		{"text": "plain <b>", "parse_mode": ""},
+	}
+	if len(forms) != len(want) {
+		t.Fatalf("got %d messages, want %d: %v", len(forms), len(want), forms)
+	}
+	for i := range want {
+		if forms[i]["text"] != want[i]["text"] || forms[i]["parse_mode"] != want[i]["parse_mode"] {
+			t.Errorf("message[%d] = %v, want %v", i, forms[i], want[i])
+		}
+	}
+}
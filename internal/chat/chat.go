@@ -21,6 +21,24 @@ type Outbound struct {
 	ReplyTo  string
 	Media    []string
 	Metadata map[string]interface{}
+	// StreamID groups a progressively rendered reply: partial updates and the final message share it.
+	StreamID string
+	// Partial marks an in-progress update carrying the full text so far. Channels that cannot
+	// edit messages never see partial updates; they only receive the final message.
+	Partial bool
+	// Thinking is the model's reasoning behind Content. Channels that support it show a
+	// collapsed summary above the reply; others ignore it.
+	Thinking string
+	// Buttons are offered under the message. Pressing one sends its Data back as the Content
+	// of an inbound message from the same chat; channels without buttons ignore them, so the
+	// text should say what to type instead.
+	Buttons []Button
+}
+
+// Button is a reply choice attached to an outbound message.
+type Button struct {
+	Text string
+	Data string
 }
 
 // Hub provides simple buffered channels for inbound/outbound messages.
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Channel is an outbound sender for a single chat channel (e.g. "telegram", "discord").
+// Channels register with a Router, which delivers every Outbound whose Channel matches Name().
+type Channel interface {
+	Name() string
+	Send(out Outbound) error
+}
+
+// StreamingChannel is a Channel that can render a reply progressively by editing a message it sent.
+// SendPartial receives in-progress updates; Send receives the final message with the same StreamID
+// and should replace the partial text rather than post a new message.
+type StreamingChannel interface {
+	Channel
+	SendPartial(out Outbound) error
+}
+
+// Router owns the hub's Out channel and fans each message out to the registered Channel.
+// Exactly one Router should consume hub.Out; channels must not read from it directly.
+type Router struct {
+	hub      *Hub
+	mu       sync.RWMutex
+	channels map[string]Channel
+
+	qmu    sync.Mutex
+	queues map[string][]Outbound // messages waiting per chat; a key is present while its chat is being drained
+	wg     sync.WaitGroup
+}
+
+// NewRouter creates a Router reading outbound messages from hub.
+func NewRouter(hub *Hub) *Router {
+	return &Router{hub: hub, channels: make(map[string]Channel), queues: make(map[string][]Outbound)}
+}
+
+// Register adds a channel sender. A later registration with the same name replaces the earlier one.
+func (r *Router) Register(ch Channel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.channels[ch.Name()] = ch
+}
+
+// Dispatch delivers a single outbound message to its channel.
+// It returns an error if no sender is registered for out.Channel or if the send fails.
+// Partial updates are silently dropped unless the channel implements StreamingChannel.
+func (r *Router) Dispatch(out Outbound) error {
+	r.mu.RLock()
+	ch, ok := r.channels[out.Channel]
+	r.mu.RUnlock()
+	if out.Partial {
+		if sc, ok := ch.(StreamingChannel); ok {
+			if err := sc.SendPartial(out); err != nil {
+				return fmt.Errorf("chat: %s partial send: %w", out.Channel, err)
+			}
+		}
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("chat: no sender registered for channel %q", out.Channel)
+	}
+	if err := ch.Send(out); err != nil {
+		return fmt.Errorf("chat: %s send: %w", out.Channel, err)
+	}
+	return nil
+}
+
+// Run consumes hub.Out until ctx is canceled or the channel is closed, dispatching each
+// message to its registered sender. Each chat has its own queue: its messages are sent in
+// order, while a slow send to one chat does not hold up the others. This is a blocking call;
+// it returns once the sends in progress have finished.
+func (r *Router) Run(ctx context.Context) {
+	defer r.wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("router: stopping outbound dispatch")
+			return
+		case out, ok := <-r.hub.Out:
+			if !ok {
+				log.Println("router: outbound channel closed")
+				return
+			}
+			r.submit(ctx, out)
+		}
+	}
+}
+
+// submit queues out behind any earlier messages of the same chat. It never blocks.
+func (r *Router) submit(ctx context.Context, out Outbound) {
+	key := out.Channel + ":" + out.ChatID
+	r.qmu.Lock()
+	defer r.qmu.Unlock()
+	if q, busy := r.queues[key]; busy {
+		r.queues[key] = append(q, out)
+		return
+	}
+	r.queues[key] = nil
+	r.wg.Add(1)
+	go r.drain(ctx, key, out)
+}
+
+// drain dispatches out and then the chat's queued messages until its queue is empty.
+func (r *Router) drain(ctx context.Context, key string, out Outbound) {
+	defer r.wg.Done()
+	for {
+		if err := r.Dispatch(out); err != nil {
+			log.Printf("router: dropping message for %s:%s: %v", out.Channel, out.ChatID, err)
+		}
+		r.qmu.Lock()
+		q := r.queues[key]
+		if len(q) == 0 || ctx.Err() != nil {
+			// shutting down: drop what is still queued
+			delete(r.queues, key)
+			r.qmu.Unlock()
+			return
+		}
+		out, r.queues[key] = q[0], q[1:]
+		r.qmu.Unlock()
+	}
+}
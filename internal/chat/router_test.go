@@ -0,0 +1,135 @@
+package chat
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingChannel struct {
+	name string
+	mu   sync.Mutex
+	sent []Outbound
+}
+
+func (c *recordingChannel) Name() string { return c.name }
+
+func (c *recordingChannel) Send(out Outbound) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, out)
+	return nil
+}
+
+func (c *recordingChannel) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sent)
+}
+
+func TestRouterDeliversToMatchingChannel(t *testing.T) {
+	hub := NewHub(10)
+	r := NewRouter(hub)
+	tg := &recordingChannel{name: "telegram"}
+	dc := &recordingChannel{name: "discord"}
+	r.Register(tg)
+	r.Register(dc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	hub.Out <- Outbound{Channel: "discord", ChatID: "1", Content: "a"}
+	hub.Out <- Outbound{Channel: "telegram", ChatID: "2", Content: "b"}
+	hub.Out <- Outbound{Channel: "discord", ChatID: "3", Content: "c"}
+
+	deadline := time.After(time.Second)
+	for tg.count() != 1 || dc.count() != 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected 1 telegram and 2 discord sends, got %d and %d", tg.count(), dc.count())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if tg.sent[0].Content != "b" {
+		t.Errorf("telegram got %q, want %q", tg.sent[0].Content, "b")
+	}
+}
+
+func TestRouterDispatchUnknownChannel(t *testing.T) {
+	r := NewRouter(NewHub(1))
+	r.Register(&recordingChannel{name: "telegram"})
+	if err := r.Dispatch(Outbound{Channel: "discord", ChatID: "1", Content: "x"}); err == nil {
+		t.Fatal("expected error for channel without a registered sender")
+	}
+}
+
+func TestRouterDropsPartialsForNonStreamingChannels(t *testing.T) {
+	r := NewRouter(NewHub(1))
+	ch := &recordingChannel{name: "telegram"}
+	r.Register(ch)
+	if err := r.Dispatch(Outbound{Channel: "telegram", ChatID: "1", Content: "par", StreamID: "s", Partial: true}); err != nil {
+		t.Fatalf("partial dispatch: %v", err)
+	}
+	if err := r.Dispatch(Outbound{Channel: "heartbeat", ChatID: "1", Content: "par", StreamID: "s", Partial: true}); err != nil {
+		t.Fatalf("partial for unregistered channel should be dropped silently, got %v", err)
+	}
+	if err := r.Dispatch(Outbound{Channel: "telegram", ChatID: "1", Content: "partial done", StreamID: "s"}); err != nil {
+		t.Fatalf("final dispatch: %v", err)
+	}
+	if ch.count() != 1 || ch.sent[0].Content != "partial done" {
+		t.Fatalf("expected only the final message to be sent, got %+v", ch.sent)
+	}
+}
+
+// blockingChannel blocks sends to chat "slow" until release is closed.
+type blockingChannel struct {
+	recordingChannel
+	release chan struct{}
+}
+
+func (c *blockingChannel) Send(out Outbound) error {
+	if out.ChatID == "slow" {
+		<-c.release
+	}
+	return c.recordingChannel.Send(out)
+}
+
+func TestRouterSlowChatDoesNotBlockOthers(t *testing.T) {
+	hub := NewHub(10)
+	r := NewRouter(hub)
+	ch := &blockingChannel{recordingChannel: recordingChannel{name: "telegram"}, release: make(chan struct{})}
+	r.Register(ch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { r.Run(ctx); close(done) }()
+	defer func() { cancel(); <-done }()
+
+	hub.Out <- Outbound{Channel: "telegram", ChatID: "slow", Content: "1"}
+	hub.Out <- Outbound{Channel: "telegram", ChatID: "slow", Content: "2"}
+	hub.Out <- Outbound{Channel: "telegram", ChatID: "fast", Content: "a"}
+
+	deadline := time.After(time.Second)
+	for ch.count() != 1 {
+		select {
+		case <-deadline:
+			t.Fatal("a slow chat held up another chat's message")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	close(ch.release)
+	for ch.count() != 3 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected 3 sends, got %d", ch.count())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.sent[0].ChatID != "fast" || ch.sent[1].Content != "1" || ch.sent[2].Content != "2" {
+		t.Fatalf("expected the fast chat first and the slow chat in order, got %+v", ch.sent)
+	}
+}
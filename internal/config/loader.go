@@ -24,5 +24,17 @@ func LoadConfig() (Config, error) {
 	if err := dec.Decode(&cfg); err != nil {
 		return Config{}, err
 	}
+	migrateProviders(&cfg)
 	return cfg, nil
 }
+
+// migrateProviders fills in the type of providers written before providers were named
+// ({"openai": {...}, "anthropic": {...}}), so the next SaveConfig stores the explicit form.
+func migrateProviders(cfg *Config) {
+	for name, c := range cfg.Providers {
+		if c.Type == "" {
+			c.Type = ProviderType(name, c)
+			cfg.Providers[name] = c
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigMigratesLegacyProviders(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	legacy := `{"providers": {"openai": {"apiKey": "k", "apiBase": "https://openrouter.ai/api/v1"}, "anthropic": {"apiKey": "a"}}}`
+	if err := os.MkdirAll(filepath.Join(home, ".picobot"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".picobot", "config.json"), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Providers["openai"]; got.Type != ProviderOpenAI || got.APIKey != "k" || got.APIBase != "https://openrouter.ai/api/v1" {
+		t.Errorf("unexpected openai provider %+v", got)
+	}
+	if got := cfg.Providers["anthropic"]; got.Type != ProviderAnthropic || got.APIKey != "a" {
+		t.Errorf("unexpected anthropic provider %+v", got)
+	}
+}
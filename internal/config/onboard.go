@@ -12,12 +12,13 @@ import (
 
 // DefaultConfig returns a minimal default Config with sensible defaults.
 func DefaultConfig() Config {
+	temperature := 0.7
 	return Config{
 		Agents: AgentsConfig{Defaults: AgentDefaults{
 			Workspace:          "~/.picobot/workspace",
 			Model:              "stub-model",
 			MaxTokens:          8192,
-			Temperature:        0.7,
+			Temperature:        &temperature,
 			MaxToolIterations:  100,
 			HeartbeatIntervalS: 3600,
 		}},
@@ -26,7 +27,7 @@ func DefaultConfig() Config {
 			Discord:  DiscordConfig{Enabled: false, Token: "", AllowFrom: []string{}},
 		},
 		Providers: ProvidersConfig{
-			OpenAI: &ProviderConfig{APIKey: "sk-or-v1-REPLACE_ME", APIBase: "https://openrouter.ai/api/v1"},
+			"openai": {Type: ProviderOpenAI, APIKey: "sk-or-v1-REPLACE_ME", APIBase: "https://openrouter.ai/api/v1"},
 		},
 	}
 }
@@ -61,10 +61,11 @@ func TestSaveAndLoadConfig(t *testing.T) {
 		t.Fatalf("workspace mismatch: got %s want %s", parsed.Agents.Defaults.Workspace, d)
 	}
 	// verify provider defaults: OpenAI present with placeholder
-	if parsed.Providers.OpenAI == nil || parsed.Providers.OpenAI.APIKey != "sk-or-v1-REPLACE_ME" {
-		t.Fatalf("expected default OpenAI API key placeholder, got %v", parsed.Providers.OpenAI)
+	openai, ok := parsed.Providers["openai"]
+	if !ok || openai.APIKey != "sk-or-v1-REPLACE_ME" || openai.Type != ProviderOpenAI {
+		t.Fatalf("expected default OpenAI API key placeholder, got %+v", parsed.Providers)
 	}
-	if parsed.Providers.OpenAI.APIBase != "https://openrouter.ai/api/v1" {
-		t.Fatalf("expected default OpenAI API base, got %q", parsed.Providers.OpenAI.APIBase)
+	if openai.APIBase != "https://openrouter.ai/api/v1" {
+		t.Fatalf("expected default OpenAI API base, got %q", openai.APIBase)
 	}
 }
@@ -5,19 +5,126 @@ type Config struct {
 	Agents    AgentsConfig    `json:"agents"`
 	Channels  ChannelsConfig  `json:"channels"`
 	Providers ProvidersConfig `json:"providers"`
+	// Pricing maps a model name to its price, used by "picobot usage" to estimate cost.
+	Pricing map[string]ModelPrice `json:"pricing,omitempty"`
+	// Models overrides the built-in model capabilities, keyed by model name or name prefix.
+	Models map[string]ModelConfig `json:"models,omitempty"`
+	// Hooks enables built-in agent hooks; they run in the order listed.
+	Hooks []HookConfig `json:"hooks,omitempty"`
+	// Approvals names the tool calls that need a person's go-ahead.
+	Approvals ApprovalsConfig `json:"approvals,omitzero"`
+	// Commands adds slash commands that send a canned prompt to the model.
+	Commands []CommandConfig `json:"commands,omitempty"`
+}
+
+// CommandConfig defines a slash command. "{{args}}" in Prompt is replaced by the text typed
+// after the command; without the placeholder that text is appended.
+type CommandConfig struct {
+	Name        string `json:"name"` // without the slash; lower case letters, digits and underscores
+	Description string `json:"description,omitempty"`
+	Prompt      string `json:"prompt"`
+}
+
+// ApprovalsConfig sets the approval policy for tool calls.
+type ApprovalsConfig struct {
+	// Tools maps a tool name, or "tool:action" such as "filesystem:write", to "always", "never" or "ask".
+	Tools    map[string]string `json:"tools,omitempty"`
+	TimeoutS int               `json:"timeoutS,omitempty"` // how long "ask" waits for an answer; 0 = 300
+}
+
+// Built-in hook types.
+const (
+	HookAudit  = "audit"  // appends model calls, tool calls and replies to a JSONL file
+	HookRedact = "redact" // masks secrets in tool arguments, tool results and replies
+)
+
+// HookConfig enables one built-in hook. Put "redact" before "audit" to keep secrets out of the log.
+type HookConfig struct {
+	Type     string   `json:"type"`               // one of the Hook* constants
+	Path     string   `json:"path,omitempty"`     // audit: log file; relative to the workspace, default "audit.jsonl"
+	Keys     []string `json:"keys,omitempty"`     // redact: argument names whose values are masked; default password, token, apiKey, secret, ...
+	Patterns []string `json:"patterns,omitempty"` // redact: regular expressions masked in any argument, result or reply
+}
+
+// ModelConfig overrides what picobot assumes about a model. Zero/nil fields keep the built-in value.
+type ModelConfig struct {
+	ContextWindow   int   `json:"contextWindow,omitempty"`
+	MaxOutputTokens int   `json:"maxOutputTokens,omitempty"`
+	Vision          *bool `json:"vision,omitempty"`
+	Tools           *bool `json:"tools,omitempty"`
+	Reasoning       *bool `json:"reasoning,omitempty"` // OpenAI reasoning model: max_completion_tokens, default temperature only
+}
+
+// ModelPrice is a model's price in USD per million tokens.
+// CachedInput applies to prompt tokens served from cache; zero means Input.
+type ModelPrice struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cachedInput,omitempty"`
 }
 
 type AgentsConfig struct {
 	Defaults AgentDefaults `json:"defaults"`
+	// Profiles are named agents with their own bootstrap files, model, tools, skills and memory.
+	Profiles map[string]ProfileConfig `json:"profiles,omitempty"`
+	// Routes pick a profile for each message; the first match wins, and unmatched messages
+	// use the defaults.
+	Routes []RouteConfig `json:"routes,omitempty"`
+}
+
+// ProfileConfig is one agent profile. Empty fields keep the defaults.
+type ProfileConfig struct {
+	Bootstrap string   `json:"bootstrap,omitempty"` // directory with SOUL.md, AGENTS.md, USER.md and TOOLS.md; relative to the workspace
+	Model     string   `json:"model,omitempty"`
+	Tools     []string `json:"tools,omitempty"`  // tools the profile may use; empty means all
+	Skills    []string `json:"skills,omitempty"` // skills in its prompt and commands, and the only ones its skill tools can use; empty means all
+	Memory    string   `json:"memory,omitempty"` // memory namespace, stored in memory/<name>/; empty means the shared memory
+}
+
+// RouteConfig sends messages to a profile. Empty fields match any value.
+type RouteConfig struct {
+	Profile  string `json:"profile"`
+	Channel  string `json:"channel,omitempty"`
+	ChatID   string `json:"chatId,omitempty"`
+	SenderID string `json:"senderId,omitempty"`
 }
 
 type AgentDefaults struct {
-	Workspace          string  `json:"workspace"`
-	Model              string  `json:"model"`
-	MaxTokens          int     `json:"maxTokens"`
-	Temperature        float64 `json:"temperature"`
-	MaxToolIterations  int     `json:"maxToolIterations"`
-	HeartbeatIntervalS int     `json:"heartbeatIntervalS"`
+	Workspace          string   `json:"workspace"`
+	Model              string   `json:"model"`
+	Provider           string   `json:"provider,omitempty"` // provider for models without a "name/" prefix; empty = by type
+	MaxTokens          int      `json:"maxTokens"`
+	Temperature        *float64 `json:"temperature,omitempty"` // nil = provider default
+	MaxToolIterations  int      `json:"maxToolIterations"`
+	HeartbeatIntervalS int      `json:"heartbeatIntervalS"`
+	// MaxConcurrentChats bounds how many chats the gateway processes at once; 0 means the default.
+	MaxConcurrentChats int `json:"maxConcurrentChats,omitempty"`
+	// SessionStore is where chat histories are kept: one of the SessionStore* constants; empty means JSON files.
+	SessionStore string `json:"sessionStore,omitempty"`
+	// AllowedModels are the models /model may switch a chat to, besides the configured ones;
+	// empty means any known model.
+	AllowedModels []string `json:"allowedModels,omitempty"`
+	// Optional per-purpose models; empty means use Model.
+	CompactionModel string `json:"compactionModel,omitempty"`
+	RankingModel    string `json:"rankingModel,omitempty"`
+	SubagentModel   string `json:"subagentModel,omitempty"`
+	// EmbeddingModel is used for embeddings; may be prefixed with a provider name like other models.
+	EmbeddingModel string `json:"embeddingModel,omitempty"`
+	// Fallbacks are tried in order when the provider returns a retryable error (429, 5xx, network).
+	Fallbacks []FallbackConfig `json:"fallbacks,omitempty"`
+}
+
+// Session stores.
+const (
+	SessionStoreJSON   = "json"   // one JSON file per chat in sessions/
+	SessionStoreSQLite = "sqlite" // sessions.db in the workspace; safe for the gateway and "picobot agent" to share
+)
+
+// FallbackConfig names a provider/model pair to fail over to.
+// Provider is a key under "providers" (e.g. "openrouter", "ollama"); empty means the primary provider.
+type FallbackConfig struct {
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model"`
 }
 
 type ChannelsConfig struct {
@@ -37,11 +144,36 @@ type DiscordConfig struct {
 	AllowFrom []string `json:"allowFrom"`
 }
 
-type ProvidersConfig struct {
-	OpenAI *ProviderConfig `json:"openai,omitempty"`
-}
+// ProvidersConfig maps a provider name to its settings. Models are routed to a provider by
+// prefixing them with its name, e.g. "ollama/llama3.2"; unprefixed models use the default provider.
+type ProvidersConfig map[string]ProviderConfig
+
+// Provider types.
+const (
+	ProviderOpenAI    = "openai"    // any OpenAI-compatible API (OpenAI, OpenRouter, Ollama, vLLM, ...)
+	ProviderAnthropic = "anthropic" // the native Anthropic Messages API
+	ProviderScript    = "script"    // canned replies from a script file, for offline demos and tests
+)
 
 type ProviderConfig struct {
-	APIKey  string `json:"apiKey"`
-	APIBase string `json:"apiBase"`
+	// Type is one of the Provider* constants. Empty means the type named by the key
+	// ("anthropic", "script"), otherwise "openai".
+	Type     string            `json:"type,omitempty"`
+	APIKey   string            `json:"apiKey,omitempty"`
+	APIBase  string            `json:"apiBase,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`  // extra HTTP headers sent with every request
+	TimeoutS int               `json:"timeoutS,omitempty"` // per-request timeout; 0 = provider default
+	Path     string            `json:"path,omitempty"`     // script file, for type "script"
+}
+
+// ProviderType returns the type of the provider configured under name.
+func ProviderType(name string, c ProviderConfig) string {
+	if c.Type != "" {
+		return c.Type
+	}
+	switch name {
+	case ProviderAnthropic, ProviderScript:
+		return name
+	}
+	return ProviderOpenAI
 }
@@ -0,0 +1,355 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// anthropicVersion is the Messages API version header value.
+const anthropicVersion = "2023-06-01"
+
+// anthropicDefaultMaxTokens is sent when the caller does not specify a limit (max_tokens is required by the API).
+const anthropicDefaultMaxTokens = 4096
+
+// AnthropicProvider calls the native Anthropic Messages API.
+type AnthropicProvider struct {
+	APIKey  string
+	APIBase string // e.g. https://api.anthropic.com/v1
+	Client  *http.Client
+	Headers map[string]string // extra headers sent with every request
+}
+
+func NewAnthropicProvider(apiKey, apiBase string) *AnthropicProvider {
+	if apiBase == "" {
+		apiBase = "https://api.anthropic.com/v1"
+	}
+	return &AnthropicProvider{
+		APIKey:  apiKey,
+		APIBase: strings.TrimRight(apiBase, "/"),
+		Client:  &http.Client{},
+	}
+}
+
+func (p *AnthropicProvider) GetDefaultModel() string { return "claude-3-5-haiku-latest" }
+
+// Request/response shapes for the Messages API.
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+	// Generation options; omitted when unset.
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicToolChoice struct {
+	Type                   string `json:"type"` // "auto" | "any" | "tool" | "none"
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"` // "user" | "assistant"
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block; only the fields relevant to Type are set.
+type anthropicBlock struct {
+	Type      string                `json:"type"` // "text" | "image" | "tool_use" | "tool_result" | "thinking" | "redacted_thinking"
+	Text      string                `json:"text,omitempty"`
+	Thinking  string                `json:"thinking,omitempty"`
+	Signature string                `json:"signature,omitempty"`
+	Data      string                `json:"data,omitempty"` // redacted_thinking payload
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     interface{}           `json:"input,omitempty"` // tool_use arguments; must be present (even if {}) on requests
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // "base64" | "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicResponse struct {
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+// Chat calls the Messages endpoint and returns a normalized response.
+func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	if p.APIKey == "" {
+		return LLMResponse{}, errors.New("Anthropic provider: API key is not configured")
+	}
+	if model == "" {
+		model = p.GetDefaultModel()
+	}
+
+	system, msgs := toAnthropicMessages(messages)
+	if rf := opts.ResponseFormat; rf != nil {
+		// the Messages API has no response_format; ask for the JSON in the system prompt instead
+		system = strings.TrimSpace(system + "\n\n" + schemaInstruction(*rf))
+	}
+	reqBody := anthropicRequest{
+		Model:         model,
+		MaxTokens:     anthropicDefaultMaxTokens,
+		System:        system,
+		Messages:      msgs,
+		Temperature:   opts.Temperature,
+		TopP:          opts.TopP,
+		StopSequences: opts.Stop,
+	}
+	if opts.MaxTokens > 0 {
+		reqBody.MaxTokens = opts.MaxTokens
+	}
+	for _, t := range tools {
+		schema := t.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		reqBody.Tools = append(reqBody.Tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: schema})
+	}
+	if len(tools) > 0 {
+		reqBody.ToolChoice = anthropicToolChoiceFor(opts)
+	}
+
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+
+	url := fmt.Sprintf("%s/messages", p.APIBase)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(b)))
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.APIKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		body := strings.TrimSpace(string(bodyBytes))
+		log.Printf("Anthropic API non-2xx: %s body=%q", resp.Status, body)
+		return LLMResponse{}, &APIError{Provider: "Anthropic", StatusCode: resp.StatusCode, Status: resp.Status, Body: body, RetryAfter: parseRetryAfter(resp.Header)}
+	}
+
+	var out anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return LLMResponse{}, err
+	}
+
+	var text, thinking []string
+	var details []map[string]interface{}
+	var tcs []ToolCall
+	for _, blk := range out.Content {
+		switch blk.Type {
+		case "text":
+			text = append(text, blk.Text)
+		case "thinking":
+			thinking = append(thinking, blk.Thinking)
+			details = append(details, map[string]interface{}{"type": "thinking", "thinking": blk.Thinking, "signature": blk.Signature})
+		case "redacted_thinking":
+			details = append(details, map[string]interface{}{"type": "redacted_thinking", "data": blk.Data})
+		case "tool_use":
+			args, _ := blk.Input.(map[string]interface{})
+			if args == nil {
+				args = map[string]interface{}{}
+			}
+			tcs = append(tcs, ToolCall{ID: blk.ID, Name: blk.Name, Arguments: args})
+		}
+	}
+	content := strings.TrimSpace(strings.Join(text, ""))
+	// input_tokens excludes cache reads and writes; report the full prompt like OpenAI does.
+	u := out.Usage
+	usage := Usage{
+		PromptTokens:     u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		CompletionTokens: u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+	}
+	r := LLMResponse{Content: content, Usage: usage, Reasoning: strings.TrimSpace(strings.Join(thinking, "\n\n")), ReasoningDetails: details, Model: model}
+	if len(tcs) > 0 {
+		r.HasToolCalls, r.ToolCalls = true, tcs
+	}
+	return r, nil
+}
+
+// anthropicToolChoiceFor maps ToolChoice and ParallelToolCalls to the Messages API tool_choice,
+// or nil when neither is set. The API has no seed parameter, so Seed is ignored.
+func anthropicToolChoiceFor(opts GenerationOptions) *anthropicToolChoice {
+	tc := &anthropicToolChoice{Type: "auto"}
+	switch opts.ToolChoice {
+	case "", "auto":
+	case "none":
+		tc.Type = "none"
+	case "required":
+		tc.Type = "any"
+	default:
+		tc.Type, tc.Name = "tool", opts.ToolChoice
+	}
+	if opts.ParallelToolCalls != nil && !*opts.ParallelToolCalls && tc.Type != "none" {
+		tc.DisableParallelToolUse = true
+	}
+	if opts.ToolChoice == "" && !tc.DisableParallelToolUse {
+		return nil
+	}
+	return tc
+}
+
+// toAnthropicMessages converts provider messages to the Messages API shape.
+// System messages are joined into the separate system field, tool results become
+// tool_result blocks on a user turn, and consecutive turns with the same role are
+// merged because the API requires user/assistant alternation.
+func toAnthropicMessages(messages []Message) (string, []anthropicMessage) {
+	var system []string
+	var out []anthropicMessage
+	add := func(role string, blocks []anthropicBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Content = append(out[n-1].Content, blocks...)
+			return
+		}
+		out = append(out, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			if s := strings.TrimSpace(ContentToString(m.Content)); s != "" {
+				system = append(system, s)
+			}
+		case "tool":
+			add("user", []anthropicBlock{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: ContentToString(m.Content)}})
+		case "assistant":
+			// thinking blocks must come first and unchanged for the API to accept them
+			blocks := anthropicThinkingBlocks(m.ReasoningDetails)
+			if s := ContentToString(m.Content); strings.TrimSpace(s) != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: s})
+			}
+			for _, tc := range m.ToolCalls {
+				args := tc.Arguments
+				if args == nil {
+					args = map[string]interface{}{}
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Name, Input: args})
+			}
+			add("assistant", blocks)
+		default:
+			add("user", anthropicContentBlocks(m.Content))
+		}
+	}
+	return strings.Join(system, "\n\n"), out
+}
+
+// anthropicThinkingBlocks rebuilds the thinking blocks of a previous response from its
+// reasoning details, skipping details another provider produced.
+func anthropicThinkingBlocks(details []map[string]interface{}) []anthropicBlock {
+	var blocks []anthropicBlock
+	for _, d := range details {
+		switch d["type"] {
+		case "thinking":
+			thinking, _ := d["thinking"].(string)
+			sig, _ := d["signature"].(string)
+			blocks = append(blocks, anthropicBlock{Type: "thinking", Thinking: thinking, Signature: sig})
+		case "redacted_thinking":
+			data, _ := d["data"].(string)
+			blocks = append(blocks, anthropicBlock{Type: "redacted_thinking", Data: data})
+		}
+	}
+	return blocks
+}
+
+// anthropicContentBlocks converts a string or multimodal parts slice into content blocks.
+func anthropicContentBlocks(c interface{}) []anthropicBlock {
+	switch v := c.(type) {
+	case nil:
+		return nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil
+		}
+		return []anthropicBlock{{Type: "text", Text: v}}
+	case []interface{}:
+		var blocks []anthropicBlock
+		for _, p := range v {
+			part, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch part["type"] {
+			case "text":
+				if t, ok := part["text"].(string); ok && strings.TrimSpace(t) != "" {
+					blocks = append(blocks, anthropicBlock{Type: "text", Text: t})
+				}
+			case "image_url":
+				var url string
+				switch iu := part["image_url"].(type) {
+				case map[string]interface{}:
+					url, _ = iu["url"].(string)
+				case string:
+					url = iu
+				}
+				if src := anthropicImageFromURL(url); src != nil {
+					blocks = append(blocks, anthropicBlock{Type: "image", Source: src})
+				}
+			}
+		}
+		return blocks
+	default:
+		return anthropicContentBlocks(ContentToString(c))
+	}
+}
+
+// anthropicImageFromURL builds an image source from a data: URL (base64) or a plain http(s) URL.
+func anthropicImageFromURL(url string) *anthropicImageSource {
+	if url == "" {
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		// data:<media_type>;base64,<data>
+		meta, data, found := strings.Cut(rest, ",")
+		mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+		if !found || !isBase64 {
+			return nil
+		}
+		return &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+	}
+	return &anthropicImageSource{Type: "url", URL: url}
+}
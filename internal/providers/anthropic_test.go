@@ -0,0 +1,224 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnthropicToolUseParsing(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			w.WriteHeader(404)
+			return
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{
+		  "id": "msg_1",
+		  "role": "assistant",
+		  "stop_reason": "tool_use",
+		  "content": [
+		    {"type": "text", "text": "Sending now."},
+		    {"type": "tool_use", "id": "toolu_1", "name": "message", "input": {"content": "Hello from tool"}}
+		  ],
+		  "usage": {"input_tokens": 10, "cache_read_input_tokens": 30, "output_tokens": 5}
+		}`))
+	}))
+	defer h.Close()
+
+	p := NewAnthropicProvider("test-key", h.URL)
+	p.Client = &http.Client{Timeout: 5 * time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := p.Chat(ctx, []Message{{Role: "user", Content: "trigger"}}, nil, "claude-test", GenerationOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.Content != "Sending now." {
+		t.Fatalf("unexpected content %q", resp.Content)
+	}
+	if !resp.HasToolCalls || len(resp.ToolCalls) != 1 {
+		t.Fatalf("expected one tool call, got: has=%v len=%d", resp.HasToolCalls, len(resp.ToolCalls))
+	}
+	tc := resp.ToolCalls[0]
+	if tc.ID != "toolu_1" || tc.Name != "message" || tc.Arguments["content"] != "Hello from tool" {
+		t.Fatalf("unexpected tool call: %+v", tc)
+	}
+	if resp.Usage != (Usage{PromptTokens: 40, CompletionTokens: 5, CachedTokens: 30}) {
+		t.Fatalf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicThinkingBlocks(t *testing.T) {
+	var second anthropicRequest
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		if len(req.Messages) == 1 {
+			w.Write([]byte(`{
+			  "content": [
+			    {"type": "thinking", "thinking": "Need the time.", "signature": "sig-1"},
+			    {"type": "redacted_thinking", "data": "enc"},
+			    {"type": "tool_use", "id": "toolu_1", "name": "exec", "input": {"cmd": "date"}}
+			  ]
+			}`))
+			return
+		}
+		second = req
+		w.Write([]byte(`{"content": [{"type": "text", "text": "Noon."}]}`))
+	}))
+	defer h.Close()
+
+	p := NewAnthropicProvider("test-key", h.URL)
+	p.Client = &http.Client{Timeout: 5 * time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := p.Chat(ctx, []Message{{Role: "user", Content: "time?"}}, nil, "claude-test", GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Reasoning != "Need the time." || len(resp.ReasoningDetails) != 2 {
+		t.Fatalf("unexpected reasoning %q, details %v", resp.Reasoning, resp.ReasoningDetails)
+	}
+
+	messages := []Message{
+		{Role: "user", Content: "time?"},
+		{Role: "assistant", ToolCalls: resp.ToolCalls, Reasoning: resp.Reasoning, ReasoningDetails: resp.ReasoningDetails},
+		{Role: "tool", Content: "12:00", ToolCallID: "toolu_1"},
+	}
+	if _, err := p.Chat(ctx, messages, nil, "claude-test", GenerationOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	blocks := second.Messages[1].Content
+	if len(blocks) != 3 || blocks[0].Type != "thinking" || blocks[0].Signature != "sig-1" || blocks[1].Type != "redacted_thinking" || blocks[1].Data != "enc" || blocks[2].Type != "tool_use" {
+		t.Fatalf("expected thinking blocks before tool_use, got %+v", blocks)
+	}
+}
+
+func TestAnthropicRequestMapping(t *testing.T) {
+	var got map[string]interface{}
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err := json.Unmarshal(body, &got); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"content":[{"type":"text","text":"Done."}],"stop_reason":"end_turn"}`))
+	}))
+	defer h.Close()
+
+	p := NewAnthropicProvider("test-key", h.URL)
+	p.Client = &http.Client{Timeout: 5 * time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	messages := []Message{
+		{Role: "system", Content: "You are Picobot."},
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": "what is this?"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64,QUJD"}},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/cat.jpg"}},
+		}},
+		{Role: "assistant", Content: "", ToolCalls: []ToolCall{
+			{ID: "toolu_1", Name: "web", Arguments: map[string]interface{}{"url": "https://example.com"}},
+			{ID: "toolu_2", Name: "list_skills", Arguments: map[string]interface{}{}},
+		}},
+		{Role: "tool", Content: "page body", ToolCallID: "toolu_1"},
+		{Role: "tool", Content: "No skills found", ToolCallID: "toolu_2"},
+	}
+	tools := []ToolDefinition{{Name: "web", Description: "Fetch", Parameters: map[string]interface{}{"type": "object"}}}
+	resp, err := p.Chat(ctx, messages, tools, "claude-test", GenerationOptions{})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Content != "Done." || resp.HasToolCalls {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	if got["system"] != "You are Picobot.\n\nBe brief." {
+		t.Errorf("system = %q", got["system"])
+	}
+	if got["max_tokens"] == nil {
+		t.Error("expected max_tokens to be set")
+	}
+	if tl, _ := got["tools"].([]interface{}); len(tl) != 1 || tl[0].(map[string]interface{})["input_schema"] == nil {
+		t.Errorf("unexpected tools: %v", got["tools"])
+	}
+
+	msgs, _ := got["messages"].([]interface{})
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 alternating messages, got %d: %v", len(msgs), msgs)
+	}
+	roles := []string{"user", "assistant", "user"}
+	for i, m := range msgs {
+		if r := m.(map[string]interface{})["role"]; r != roles[i] {
+			t.Errorf("message %d role = %v, want %s", i, r, roles[i])
+		}
+	}
+
+	user := msgs[0].(map[string]interface{})["content"].([]interface{})
+	if len(user) != 3 {
+		t.Fatalf("expected text + 2 image blocks, got %v", user)
+	}
+	b64 := user[1].(map[string]interface{})["source"].(map[string]interface{})
+	if b64["type"] != "base64" || b64["media_type"] != "image/png" || b64["data"] != "QUJD" {
+		t.Errorf("unexpected base64 image source: %v", b64)
+	}
+	urlSrc := user[2].(map[string]interface{})["source"].(map[string]interface{})
+	if urlSrc["type"] != "url" || urlSrc["url"] != "https://example.com/cat.jpg" {
+		t.Errorf("unexpected url image source: %v", urlSrc)
+	}
+
+	asst := msgs[1].(map[string]interface{})["content"].([]interface{})
+	if len(asst) != 2 {
+		t.Fatalf("expected 2 tool_use blocks (empty text dropped), got %v", asst)
+	}
+	second := asst[1].(map[string]interface{})
+	if second["type"] != "tool_use" || second["input"] == nil {
+		t.Errorf("tool_use without arguments must still send input: %v", second)
+	}
+
+	results := msgs[2].(map[string]interface{})["content"].([]interface{})
+	if len(results) != 2 {
+		t.Fatalf("expected both tool results merged into one user turn, got %v", results)
+	}
+	first := results[0].(map[string]interface{})
+	if first["type"] != "tool_result" || first["tool_use_id"] != "toolu_1" || first["content"] != "page body" {
+		t.Errorf("unexpected tool_result: %v", first)
+	}
+}
+
+func TestAnthropicToolChoiceFor(t *testing.T) {
+	no := false
+	tests := []struct {
+		opts GenerationOptions
+		want *anthropicToolChoice
+	}{
+		{GenerationOptions{}, nil},
+		{GenerationOptions{ToolChoice: "required"}, &anthropicToolChoice{Type: "any"}},
+		{GenerationOptions{ToolChoice: "none"}, &anthropicToolChoice{Type: "none"}},
+		{GenerationOptions{ToolChoice: "web", ParallelToolCalls: &no}, &anthropicToolChoice{Type: "tool", Name: "web", DisableParallelToolUse: true}},
+		{GenerationOptions{ParallelToolCalls: &no}, &anthropicToolChoice{Type: "auto", DisableParallelToolUse: true}},
+	}
+	for _, tt := range tests {
+		got := anthropicToolChoiceFor(tt.opts)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("anthropicToolChoiceFor(%+v) = %+v, want %+v", tt.opts, got, tt.want)
+		}
+	}
+}
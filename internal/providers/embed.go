@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Embedder turns texts into embedding vectors, one per text and in the same order.
+// An empty model means the embedder's default.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string, model string) ([][]float32, error)
+}
+
+// ErrEmbeddingsUnsupported is returned when the selected provider cannot embed.
+var ErrEmbeddingsUnsupported = errors.New("provider does not support embeddings")
+
+// DefaultEmbeddingModel is used by OpenAIProvider when no model is given.
+const DefaultEmbeddingModel = "text-embedding-3-small"
+
+// DefaultEmbedBatchSize is how many texts OpenAIProvider sends per /embeddings request.
+const DefaultEmbedBatchSize = 64
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed calls the /embeddings endpoint (OpenAI, OpenRouter, Ollama's /v1 API, ...) in batches
+// of EmbedBatchSize, retrying each batch like Chat.
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+	size := p.EmbedBatchSize
+	if size <= 0 {
+		size = DefaultEmbedBatchSize
+	}
+	out := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += size {
+		batch := texts[start:min(start+size, len(texts))]
+		var vecs [][]float32
+		_, err := p.Retry.do(ctx, "OpenAI embeddings", func(ctx context.Context) (LLMResponse, error) {
+			var err error
+			vecs, err = p.embedOnce(ctx, batch, model)
+			return LLMResponse{}, err
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
+
+func (p *OpenAIProvider) embedOnce(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	resp, err := p.postJSON(ctx, "/embeddings", embeddingRequest{Model: model, Input: texts}, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var er embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
+		return nil, fmt.Errorf("OpenAI embeddings: decoding response: %w", err)
+	}
+	if len(er.Data) != len(texts) {
+		return nil, fmt.Errorf("OpenAI embeddings: got %d vectors for %d inputs", len(er.Data), len(texts))
+	}
+	vecs := make([][]float32, len(texts))
+	for _, d := range er.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("OpenAI embeddings: vector index %d out of range", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
+
+// HashEmbedder is a deterministic, offline embedder for tests: each word is hashed into one
+// of Dims buckets and the counts are L2-normalised, so texts sharing words are similar.
+type HashEmbedder struct {
+	Dims int
+}
+
+// NewHashEmbedder returns a HashEmbedder with dims dimensions (default 64).
+func NewHashEmbedder(dims int) *HashEmbedder {
+	if dims <= 0 {
+		dims = 64
+	}
+	return &HashEmbedder{Dims: dims}
+}
+
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		v := make([]float32, e.Dims)
+		for _, w := range strings.FieldsFunc(strings.ToLower(t), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) {
+			h := fnv.New32a()
+			h.Write([]byte(w))
+			v[h.Sum32()%uint32(e.Dims)]++
+		}
+		normalize(v)
+		out[i] = v
+	}
+	return out, nil
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= n
+	}
+}
+
+// Cosine returns the cosine similarity of a and b, or 0 if their lengths differ or either is zero.
+func Cosine(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(na*nb))
+}
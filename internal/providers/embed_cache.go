@@ -0,0 +1,95 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CachedEmbedder stores vectors on disk, keyed by the SHA-256 of model and text, so unchanged
+// texts are never embedded twice. Each vector is a file of little-endian float32s under
+// <dir>/<model>/<hash[:2]>/<hash>.
+type CachedEmbedder struct {
+	inner Embedder
+	dir   string
+}
+
+// NewCachedEmbedder wraps inner with a cache in dir (created on first write).
+func NewCachedEmbedder(inner Embedder, dir string) *CachedEmbedder {
+	return &CachedEmbedder{inner: inner, dir: dir}
+}
+
+func (c *CachedEmbedder) Embed(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	var missing []string
+	var missingAt []int
+	for i, t := range texts {
+		if v, ok := c.load(model, t); ok {
+			out[i] = v
+			continue
+		}
+		missing = append(missing, t)
+		missingAt = append(missingAt, i)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+	vecs, err := c.inner.Embed(ctx, missing, model)
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != len(missing) {
+		return nil, fmt.Errorf("embeddings cache: got %d vectors for %d inputs", len(vecs), len(missing))
+	}
+	for j, v := range vecs {
+		out[missingAt[j]] = v
+		// a failed write only costs a future re-embed
+		_ = c.store(model, missing[j], v)
+	}
+	return out, nil
+}
+
+func (c *CachedEmbedder) path(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	h := hex.EncodeToString(sum[:])
+	m := strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(model)
+	if m == "" {
+		m = "_default"
+	}
+	return filepath.Join(c.dir, m, h[:2], h)
+}
+
+func (c *CachedEmbedder) load(model, text string) ([]float32, bool) {
+	b, err := os.ReadFile(c.path(model, text))
+	if err != nil || len(b) == 0 || len(b)%4 != 0 {
+		return nil, false
+	}
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return v, true
+}
+
+func (c *CachedEmbedder) store(model, text string, v []float32) error {
+	p := c.path(model, text)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[i*4:], math.Float32bits(x))
+	}
+	// write then rename so a concurrent reader never sees a partial vector
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
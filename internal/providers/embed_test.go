@@ -0,0 +1,134 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/local/picobot/internal/config"
+)
+
+func TestOpenAIEmbedBatchesRequests(t *testing.T) {
+	var batches [][]string
+	var auth string
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		var req embeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "nomic-embed-text" {
+			t.Errorf("unexpected model %q", req.Model)
+		}
+		batches = append(batches, req.Input)
+		// answer out of order to check vectors are placed by index
+		var resp embeddingResponse
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{i, []float32{float32(len(req.Input[i])), 1}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer h.Close()
+
+	// like a local Ollama server: no API key
+	p := NewOpenAIProvider("", h.URL)
+	p.EmbedBatchSize = 2
+	vecs, err := p.Embed(context.Background(), []string{"a", "bb", "ccc"}, "nomic-embed-text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("expected batches of 2 and 1, got %v", batches)
+	}
+	if auth != "" {
+		t.Errorf("expected no Authorization header without a key, got %q", auth)
+	}
+	for i, want := range []float32{1, 2, 3} {
+		if vecs[i][0] != want {
+			t.Errorf("vector %d = %v, want first component %v", i, vecs[i], want)
+		}
+	}
+}
+
+// countingEmbedder records the texts it is asked to embed.
+type countingEmbedder struct {
+	HashEmbedder
+	seen []string
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	e.seen = append(e.seen, texts...)
+	return e.HashEmbedder.Embed(ctx, texts, model)
+}
+
+func TestCachedEmbedderReusesVectors(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingEmbedder{HashEmbedder: HashEmbedder{Dims: 16}}
+	c := NewCachedEmbedder(inner, dir)
+	ctx := context.Background()
+
+	first, err := c.Embed(ctx, []string{"buy milk", "call mom"}, "ollama/nomic-embed-text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a new instance over the same directory only embeds the unseen text
+	c = NewCachedEmbedder(inner, dir)
+	second, err := c.Embed(ctx, []string{"call mom", "water plants", "buy milk"}, "ollama/nomic-embed-text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.seen) != 3 || inner.seen[2] != "water plants" {
+		t.Fatalf("expected only the new text to be embedded, got %v", inner.seen)
+	}
+	if Cosine(first[0], second[2]) < 0.9999 || Cosine(first[1], second[0]) < 0.9999 {
+		t.Error("cached vectors differ from the originals")
+	}
+	// another model is a different cache entry
+	if _, err := c.Embed(ctx, []string{"buy milk"}, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.seen) != 4 {
+		t.Errorf("expected a cache miss for another model, got %v", inner.seen)
+	}
+}
+
+func TestHashEmbedderIsDeterministicAndSimilar(t *testing.T) {
+	e := NewHashEmbedder(64)
+	vecs, _ := e.Embed(context.Background(), []string{"The cat sat", "the cat sat!", "stock prices fell"}, "")
+	if Cosine(vecs[0], vecs[1]) < 0.9999 {
+		t.Errorf("expected identical words to give the same vector")
+	}
+	if Cosine(vecs[0], vecs[2]) >= Cosine(vecs[0], vecs[1]) {
+		t.Errorf("expected unrelated text to be less similar")
+	}
+}
+
+func TestNewEmbedderFromConfig(t *testing.T) {
+	cfg := config.Config{}
+	if e := NewEmbedderFromConfig(cfg, ""); e != nil {
+		t.Fatalf("expected no embedder without providers, got %T", e)
+	}
+	cfg.Providers = config.ProvidersConfig{"anthropic": {APIKey: "a"}}
+	if e := NewEmbedderFromConfig(cfg, ""); e != nil {
+		t.Fatalf("expected no embedder for Anthropic, got %T", e)
+	}
+	// a single provider still resolves its prefix
+	cfg.Providers = config.ProvidersConfig{"ollama": {APIBase: "http://localhost:11434/v1"}}
+	if _, model := NewEmbedderFromConfig(cfg, "").(*ProviderRegistry).Resolve("ollama/nomic-embed-text"); model != "nomic-embed-text" {
+		t.Errorf("ollama/nomic-embed-text resolved to %q", model)
+	}
+	cfg.Providers["anthropic"] = config.ProviderConfig{APIKey: "a"}
+	if _, ok := NewEmbedderFromConfig(cfg, t.TempDir()).(*CachedEmbedder); !ok {
+		t.Fatal("expected a cached embedder")
+	}
+	reg := NewEmbedderFromConfig(cfg, "").(*ProviderRegistry)
+	if _, err := reg.Embed(context.Background(), []string{"x"}, "anthropic/claude"); err != ErrEmbeddingsUnsupported {
+		t.Errorf("expected ErrEmbeddingsUnsupported, got %v", err)
+	}
+}
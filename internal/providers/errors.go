@@ -0,0 +1,103 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Error classes callers can test for with errors.Is to react to a failed call,
+// e.g. compact the history on ErrContextLength.
+var (
+	ErrRateLimited   = errors.New("rate limited")
+	ErrContextLength = errors.New("context length exceeded")
+	ErrAuth          = errors.New("authentication failed")
+)
+
+// APIError is returned when an LLM API responds with a non-2xx status.
+type APIError struct {
+	Provider   string // e.g. "OpenAI", "Anthropic"
+	StatusCode int
+	Status     string // e.g. "429 Too Many Requests"
+	Body       string
+	RetryAfter time.Duration // from the Retry-After header; 0 if absent
+}
+
+func (e *APIError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s API error: %s", e.Provider, e.Status)
+	}
+	return fmt.Sprintf("%s API error: %s - %s", e.Provider, e.Status, e.Body)
+}
+
+// Unwrap classifies the error so errors.Is(err, ErrRateLimited) and friends work.
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == 429:
+		return ErrRateLimited
+	case e.StatusCode == 401 || e.StatusCode == 403:
+		return ErrAuth
+	case (e.StatusCode == 400 || e.StatusCode == 413) && isContextLengthMessage(e.Body):
+		return ErrContextLength
+	}
+	return nil
+}
+
+// isContextLengthMessage matches the error bodies OpenAI, OpenRouter, Anthropic, Gemini
+// and Ollama-style servers return when the prompt does not fit the model's context window.
+func isContextLengthMessage(body string) bool {
+	b := strings.ToLower(body)
+	for _, s := range []string{"context_length_exceeded", "maximum context length", "context length", "context window", "prompt is too long", "too many tokens", "input token count"} {
+		if strings.Contains(b, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given either as delay-seconds or as an HTTP date.
+func parseRetryAfter(h http.Header) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// IsRetryable reports whether err is transient, i.e. the same request may succeed
+// if repeated later or sent to another provider: rate limits (429), timeouts (408),
+// server errors (5xx), and dropped or refused connections.
+// Cancellation by the caller is never retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == 429 || apiErr.StatusCode == 408 || apiErr.StatusCode >= 500
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return false
+}
@@ -1,14 +1,169 @@
 package providers
 
-import "github.com/local/picobot/internal/config"
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+)
 
 // NewProviderFromConfig creates a provider based on the configuration.
-// Simple rules (v0):
-//   - if OpenAI API key present -> OpenAI
-//   - else fallback to stub
-func NewProviderFromConfig(cfg config.Config) LLMProvider {
-	if cfg.Providers.OpenAI != nil && cfg.Providers.OpenAI.APIKey != "" {
-		return NewOpenAIProvider(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase)
-	}
-	return NewStubProvider()
+// Simple rules:
+//   - every usable entry under "providers" is built (see newProvider)
+//   - they are put in a ProviderRegistry, even if there is only one, so models written as
+//     "name/model" always go to the provider called name
+//   - unprefixed models go to the default provider: agents.defaults.provider if set, otherwise
+//     the first script, then openai, then anthropic provider (by name within a type)
+//   - with none, fall back to stub
+//
+// If agents.defaults.fallbacks is set, the provider is wrapped in a FallbackProvider.
+// A script provider that cannot be loaded is an error rather than skipped, so an offline
+// setup never silently falls through to a networked provider.
+func NewProviderFromConfig(cfg config.Config) (LLMProvider, error) {
+	built, err := buildProviders(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(built) == 0 {
+		return NewStubProvider(), nil
+	}
+	defaultName, err := defaultProviderName(cfg, built)
+	if err != nil {
+		return nil, err
+	}
+	var primary LLMProvider = NewProviderRegistry(built, defaultName)
+
+	fbs := cfg.Agents.Defaults.Fallbacks
+	if len(fbs) == 0 {
+		return primary, nil
+	}
+	targets := make([]FallbackTarget, 0, len(fbs))
+	for _, fb := range fbs {
+		p := primary
+		if fb.Provider != "" {
+			if p = built[fb.Provider]; p == nil {
+				log.Printf("fallback provider %q is not configured; skipping model %q", fb.Provider, fb.Model)
+				continue
+			}
+		}
+		targets = append(targets, FallbackTarget{Provider: p, Model: fb.Model})
+	}
+	return NewFallbackProvider(primary, targets...), nil
+}
+
+// NewEmbedderFromConfig returns an Embedder over the configured providers, routed by model
+// like NewProviderFromConfig, with vectors cached under cacheDir (no cache if empty). It returns
+// nil if no configured provider can embed. Pass agents.defaults.embeddingModel as the model.
+func NewEmbedderFromConfig(cfg config.Config, cacheDir string) Embedder {
+	built, err := buildProviders(cfg)
+	if err != nil {
+		return nil
+	}
+	canEmbed := false
+	for _, p := range built {
+		if _, ok := p.(Embedder); ok {
+			canEmbed = true
+		}
+	}
+	if !canEmbed {
+		return nil
+	}
+	defaultName, err := defaultProviderName(cfg, built)
+	if err != nil {
+		return nil
+	}
+	var e Embedder = NewProviderRegistry(built, defaultName)
+	if cacheDir != "" {
+		e = NewCachedEmbedder(e, cacheDir)
+	}
+	return e
+}
+
+// buildProviders builds every usable provider under "providers", keyed by name.
+func buildProviders(cfg config.Config) (map[string]LLMProvider, error) {
+	built := map[string]LLMProvider{}
+	models := NewModelRegistry(cfg.Models)
+	for name, c := range cfg.Providers {
+		p, err := newProvider(name, c, models)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			built[name] = p
+		}
+	}
+	return built, nil
+}
+
+// newProvider builds the provider configured under name, or nil if it is incomplete (no
+// API key) or of an unknown type. A script provider without a path, or whose script fails
+// to load, is an error.
+func newProvider(name string, c config.ProviderConfig, models *ModelRegistry) (LLMProvider, error) {
+	timeout := time.Duration(c.TimeoutS) * time.Second
+	switch t := config.ProviderType(name, c); t {
+	case config.ProviderOpenAI:
+		// local servers such as Ollama need no key, only a base URL
+		if c.APIKey == "" && c.APIBase == "" {
+			return nil, nil
+		}
+		p := NewOpenAIProvider(c.APIKey, c.APIBase)
+		p.Headers = c.Headers
+		p.Models = models
+		if timeout > 0 {
+			p.Retry.AttemptTimeout = timeout
+			p.Retry.Deadline = max(p.Retry.Deadline, timeout)
+		}
+		return p, nil
+	case config.ProviderAnthropic:
+		if c.APIKey == "" {
+			return nil, nil
+		}
+		p := NewAnthropicProvider(c.APIKey, c.APIBase)
+		p.Headers = c.Headers
+		p.Client.Timeout = timeout
+		return p, nil
+	case config.ProviderScript:
+		if c.Path == "" {
+			return nil, fmt.Errorf("provider %q: a script provider needs a path", name)
+		}
+		p, err := LoadScriptedProvider(c.Path)
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %w", name, err)
+		}
+		return p, nil
+	default:
+		log.Printf("ignoring provider %q: unknown type %q", name, t)
+	}
+	return nil, nil
+}
+
+// defaultProviderName picks the provider for unprefixed models: agents.defaults.provider if
+// set, otherwise script providers first (an explicit offline setup), then openai, then
+// anthropic, alphabetically within a type.
+func defaultProviderName(cfg config.Config, built map[string]LLMProvider) (string, error) {
+	if name := cfg.Agents.Defaults.Provider; name != "" {
+		if _, ok := built[name]; !ok {
+			return "", fmt.Errorf("agents.defaults.provider %q is not a configured provider", name)
+		}
+		return name, nil
+	}
+	rank := map[string]int{config.ProviderScript: 0, config.ProviderOpenAI: 1, config.ProviderAnthropic: 2}
+	typeOf := func(name string) string { return config.ProviderType(name, cfg.Providers[name]) }
+	names := make([]string, 0, len(built))
+	for n := range built {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := rank[typeOf(names[i])], rank[typeOf(names[j])]
+		if ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > 1 && typeOf(names[0]) == typeOf(names[1]) {
+		log.Printf("several %s providers are configured; unprefixed models go to %q (set agents.defaults.provider to choose)", typeOf(names[0]), names[0])
+	}
+	return names[0], nil
 }
@@ -1,26 +1,201 @@
 package providers
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/local/picobot/internal/config"
 )
 
 func TestNewProviderFromConfig_PicksOpenAI(t *testing.T) {
 	cfg := config.Config{}
-	cfg.Providers.OpenAI = &config.ProviderConfig{APIKey: "test"}
-	p := NewProviderFromConfig(cfg)
-	_, ok := p.(*OpenAIProvider)
+	cfg.Providers = config.ProvidersConfig{"openai": {APIKey: "test"}}
+	p, err := NewProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, ok := p.(*ProviderRegistry)
+	if !ok {
+		t.Fatalf("expected ProviderRegistry, got %T", p)
+	}
+	if d, _ := reg.Resolve("some-model"); d == nil {
+		t.Fatal("no default provider")
+	} else if _, ok := d.(*OpenAIProvider); !ok {
+		t.Fatalf("expected OpenAIProvider, got %T", d)
+	}
+}
+
+func TestNewProviderFromConfig_PicksAnthropic(t *testing.T) {
+	cfg := config.Config{}
+	cfg.Providers = config.ProvidersConfig{"anthropic": {APIKey: "test"}}
+	p, err := NewProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, ok := p.(*ProviderRegistry)
 	if !ok {
-		t.Fatalf("expected OpenAIProvider, got %T", p)
+		t.Fatalf("expected ProviderRegistry, got %T", p)
+	}
+	if d, _ := reg.Resolve("some-model"); d == nil {
+		t.Fatal("no default provider")
+	} else if _, ok := d.(*AnthropicProvider); !ok {
+		t.Fatalf("expected AnthropicProvider, got %T", d)
 	}
 }
 
 func TestNewProviderFromConfig_FallbacksToStub(t *testing.T) {
 	cfg := config.Config{}
-	p := NewProviderFromConfig(cfg)
+	p, err := NewProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
 	_, ok := p.(*StubProvider)
 	if !ok {
 		t.Fatalf("expected StubProvider, got %T", p)
 	}
 }
+
+func TestNewProviderFromConfig_WrapsFallbacks(t *testing.T) {
+	cfg := config.Config{}
+	cfg.Providers = config.ProvidersConfig{"openai": {APIKey: "test"}}
+	cfg.Agents.Defaults.Fallbacks = []config.FallbackConfig{{Model: "backup-model"}}
+	p, err := NewProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*FallbackProvider); !ok {
+		t.Fatalf("expected FallbackProvider, got %T", p)
+	}
+}
+
+func TestNewProviderFromConfig_PrefersScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.json")
+	if err := os.WriteFile(path, []byte(`{"turns": [{"text": "hi"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{}
+	cfg.Providers = config.ProvidersConfig{"openai": {APIKey: "test"}, "script": {Path: path}}
+	p, err := NewProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, ok := p.(*ProviderRegistry)
+	if !ok {
+		t.Fatalf("expected ProviderRegistry, got %T", reg)
+	}
+	if p, _ := reg.Resolve("some-model"); p == nil {
+		t.Fatal("no default provider")
+	} else if _, ok := p.(*ScriptedProvider); !ok {
+		t.Fatalf("expected ScriptedProvider as default, got %T", p)
+	}
+}
+
+func TestNewProviderFromConfig_NamedProviders(t *testing.T) {
+	cfg := config.Config{}
+	cfg.Providers = config.ProvidersConfig{
+		"openrouter": {Type: config.ProviderOpenAI, APIKey: "k", APIBase: "https://openrouter.ai/api/v1", Headers: map[string]string{"X-Title": "picobot"}},
+		"ollama":     {APIBase: "http://localhost:11434/v1", TimeoutS: 600},
+		"claude":     {Type: config.ProviderAnthropic, APIKey: "a"},
+		"broken":     {Type: config.ProviderAnthropic},
+	}
+	p, err := NewProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, ok := p.(*ProviderRegistry)
+	if !ok {
+		t.Fatalf("expected ProviderRegistry, got %T", reg)
+	}
+	if got := reg.Names(); len(got) != 3 || got[0] != "claude" || got[1] != "ollama" || got[2] != "openrouter" {
+		t.Fatalf("unexpected providers %v", got)
+	}
+
+	p, model := reg.Resolve("ollama/llama3.2")
+	if o, ok := p.(*OpenAIProvider); !ok || o.APIBase != "http://localhost:11434/v1" || model != "llama3.2" {
+		t.Errorf("ollama/llama3.2 resolved to %T %q", p, model)
+	} else if o.Retry.AttemptTimeout != 600*time.Second || o.Retry.Deadline < o.Retry.AttemptTimeout {
+		t.Errorf("timeout not applied: %+v", o.Retry)
+	}
+	// unknown prefixes are part of the model name and go to the default (openai type, first by name)
+	p, model = reg.Resolve("google/gemini-2.5-flash")
+	if o, ok := p.(*OpenAIProvider); !ok || o.APIBase != "http://localhost:11434/v1" || model != "google/gemini-2.5-flash" {
+		t.Errorf("google/gemini-2.5-flash resolved to %T %q", p, model)
+	}
+	p, model = reg.Resolve("openrouter/google/gemini-2.5-flash")
+	if o, ok := p.(*OpenAIProvider); !ok || o.Headers["X-Title"] != "picobot" || model != "google/gemini-2.5-flash" {
+		t.Errorf("openrouter/google/gemini-2.5-flash resolved to %T %q", p, model)
+	}
+	if p, _ := reg.Resolve("claude/claude-sonnet-4-5"); p == nil {
+		t.Error("claude provider missing")
+	} else if _, ok := p.(*AnthropicProvider); !ok {
+		t.Errorf("expected AnthropicProvider, got %T", p)
+	}
+}
+
+func TestNewProviderFromConfig_BrokenScriptIsAnError(t *testing.T) {
+	cfg := config.Config{}
+	cfg.Providers = config.ProvidersConfig{"openai": {APIKey: "test"}, "script": {Path: filepath.Join(t.TempDir(), "missing.json")}}
+	if p, err := NewProviderFromConfig(cfg); err == nil {
+		t.Fatalf("expected an error instead of falling back to %T", p)
+	}
+	cfg.Providers["script"] = config.ProviderConfig{Type: config.ProviderScript}
+	if _, err := NewProviderFromConfig(cfg); err == nil {
+		t.Fatal("expected an error for a script provider without a path")
+	}
+}
+
+// TestSingleProviderResolvesPrefix checks that "name/model" is routed even when only one
+// provider is configured, so the prefix never reaches the server.
+func TestSingleProviderResolvesPrefix(t *testing.T) {
+	var model string
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		model = body.Model
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer h.Close()
+
+	cfg := config.Config{}
+	cfg.Providers = config.ProvidersConfig{"ollama": {APIBase: h.URL}}
+	p, err := NewProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "ollama/llama3.2", GenerationOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if model != "llama3.2" {
+		t.Fatalf("server got model %q, want llama3.2", model)
+	}
+}
+
+func TestNewProviderFromConfig_ExplicitDefault(t *testing.T) {
+	cfg := config.Config{}
+	cfg.Providers = config.ProvidersConfig{
+		"ollama":     {APIBase: "http://localhost:11434/v1"},
+		"openrouter": {APIKey: "k", APIBase: "https://openrouter.ai/api/v1"},
+	}
+	cfg.Agents.Defaults.Provider = "openrouter"
+	p, err := NewProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, model := p.(*ProviderRegistry).Resolve("google/gemini-2.5-flash"); d.(*OpenAIProvider).APIBase != "https://openrouter.ai/api/v1" || model != "google/gemini-2.5-flash" {
+		t.Fatalf("unprefixed model went to %+v as %q", d, model)
+	}
+
+	cfg.Agents.Defaults.Provider = "missing"
+	if _, err := NewProviderFromConfig(cfg); err == nil {
+		t.Fatal("expected an error for an unknown default provider")
+	}
+}
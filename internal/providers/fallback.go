@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"context"
+	"log"
+)
+
+// FallbackTarget is a provider/model pair tried when earlier candidates fail.
+// An empty Model means "the model the caller asked for".
+type FallbackTarget struct {
+	Provider LLMProvider
+	Model    string
+}
+
+// FallbackProvider sends each request to the primary provider with the requested model and,
+// on a retryable error (see IsRetryable), moves down an ordered list of fallback targets.
+// Non-retryable errors (bad request, auth, cancellation) are returned immediately.
+type FallbackProvider struct {
+	primary   LLMProvider
+	fallbacks []FallbackTarget
+}
+
+// NewFallbackProvider wraps primary with an ordered list of fallback targets.
+func NewFallbackProvider(primary LLMProvider, fallbacks ...FallbackTarget) *FallbackProvider {
+	return &FallbackProvider{primary: primary, fallbacks: fallbacks}
+}
+
+func (f *FallbackProvider) GetDefaultModel() string { return f.primary.GetDefaultModel() }
+
+// candidates returns the provider/model pairs to try for a request, in order, without duplicates.
+func (f *FallbackProvider) candidates(model string) []FallbackTarget {
+	out := []FallbackTarget{{Provider: f.primary, Model: model}}
+	for _, t := range f.fallbacks {
+		if t.Model == "" {
+			t.Model = model
+		}
+		dup := false
+		for _, c := range out {
+			if c.Provider == t.Provider && c.Model == t.Model {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Chat tries each candidate in turn until one succeeds or a non-retryable error occurs.
+func (f *FallbackProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	var lastErr error
+	for i, c := range f.candidates(model) {
+		if i > 0 {
+			log.Printf("fallback: %v; trying model %q", lastErr, c.Model)
+		}
+		resp, err := c.Provider.Chat(ctx, messages, tools, c.Model, opts)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if !IsRetryable(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return LLMResponse{}, lastErr
+}
+
+// ChatStream streams from the first candidate that succeeds. Once any delta has been
+// delivered the request is not retried elsewhere, since the caller has already shown it.
+func (f *FallbackProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions, onDelta func(delta string)) (LLMResponse, error) {
+	var lastErr error
+	for i, c := range f.candidates(model) {
+		if i > 0 {
+			log.Printf("fallback: %v; trying model %q", lastErr, c.Model)
+		}
+		emitted := false
+		var resp LLMResponse
+		var err error
+		if sp, ok := c.Provider.(StreamingProvider); ok {
+			resp, err = sp.ChatStream(ctx, messages, tools, c.Model, opts, func(d string) {
+				emitted = true
+				onDelta(d)
+			})
+		} else {
+			resp, err = c.Provider.Chat(ctx, messages, tools, c.Model, opts)
+		}
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if emitted || !IsRetryable(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return LLMResponse{}, lastErr
+}
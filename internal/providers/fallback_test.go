@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// scriptedErrProvider returns err for every call and records the models it was asked for.
+type scriptedErrProvider struct {
+	err    error
+	reply  string
+	models []string
+}
+
+func (p *scriptedErrProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	p.models = append(p.models, model)
+	if p.err != nil {
+		return LLMResponse{}, p.err
+	}
+	return LLMResponse{Content: p.reply}, nil
+}
+func (p *scriptedErrProvider) GetDefaultModel() string { return "primary-default" }
+
+func TestFallbackProviderMovesOnRetryableError(t *testing.T) {
+	primary := &scriptedErrProvider{err: &APIError{Provider: "OpenAI", StatusCode: 429, Status: "429 Too Many Requests"}}
+	second := &scriptedErrProvider{err: &APIError{Provider: "OpenAI", StatusCode: 503, Status: "503 Service Unavailable"}}
+	third := &scriptedErrProvider{reply: "ok"}
+	f := NewFallbackProvider(primary,
+		FallbackTarget{Provider: second, Model: "backup-a"},
+		FallbackTarget{Provider: third, Model: "backup-b"},
+	)
+
+	resp, err := f.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "main", GenerationOptions{})
+	if err != nil {
+		t.Fatalf("expected fallback to succeed, got %v", err)
+	}
+	if resp.Content != "ok" {
+		t.Fatalf("unexpected content %q", resp.Content)
+	}
+	if len(primary.models) != 1 || primary.models[0] != "main" {
+		t.Errorf("primary should be called once with the requested model, got %v", primary.models)
+	}
+	if len(third.models) != 1 || third.models[0] != "backup-b" {
+		t.Errorf("third target should get its own model, got %v", third.models)
+	}
+}
+
+func TestFallbackProviderStopsOnNonRetryableError(t *testing.T) {
+	primary := &scriptedErrProvider{err: &APIError{Provider: "OpenAI", StatusCode: 400, Status: "400 Bad Request"}}
+	backup := &scriptedErrProvider{reply: "ok"}
+	f := NewFallbackProvider(primary, FallbackTarget{Provider: backup, Model: "backup"})
+
+	if _, err := f.Chat(context.Background(), nil, nil, "main", GenerationOptions{}); err == nil {
+		t.Fatal("expected error to be returned")
+	}
+	if len(backup.models) != 0 {
+		t.Errorf("backup should not be called for a 400, got %v", backup.models)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: 429}, true},
+		{&APIError{StatusCode: 500}, true},
+		{&APIError{StatusCode: 502}, true},
+		{&APIError{StatusCode: 400}, false},
+		{&APIError{StatusCode: 401}, false},
+		{fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), true},
+		{context.Canceled, false},
+		{errors.New("boom"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"strings"
+
+	"github.com/local/picobot/internal/config"
+)
+
+// ModelInfo describes what a model can do.
+type ModelInfo struct {
+	ContextWindow   int  // total tokens (prompt + output) the model accepts
+	MaxOutputTokens int  // most tokens the model generates per reply; 0 if unknown
+	Vision          bool // accepts image_url content parts
+	Tools           bool // supports tool (function) calling
+	// Reasoning marks OpenAI reasoning models (o-series, gpt-5): they take max_completion_tokens
+	// instead of max_tokens, and reject any temperature or top_p but the default.
+	Reasoning bool
+}
+
+// DefaultModelInfo is assumed for models the registry does not know. Unknown models are
+// assumed to accept images and tools so they behave as they did before the registry existed.
+var DefaultModelInfo = ModelInfo{ContextWindow: 128_000, Vision: true, Tools: true}
+
+// builtinModels is keyed by model-name prefix; the longest matching prefix wins.
+// Names are matched without a routing prefix such as "openai/" or "google/".
+var builtinModels = map[string]ModelInfo{
+	// OpenAI
+	"gpt-3.5-turbo": {ContextWindow: 16_385, MaxOutputTokens: 4_096, Tools: true},
+	"gpt-4o":        {ContextWindow: 128_000, MaxOutputTokens: 16_384, Vision: true, Tools: true},
+	"gpt-4.1":       {ContextWindow: 1_047_576, MaxOutputTokens: 32_768, Vision: true, Tools: true},
+	"gpt-5":         {ContextWindow: 400_000, MaxOutputTokens: 128_000, Vision: true, Tools: true, Reasoning: true},
+	"o3":            {ContextWindow: 200_000, MaxOutputTokens: 100_000, Vision: true, Tools: true, Reasoning: true},
+	"o3-mini":       {ContextWindow: 200_000, MaxOutputTokens: 100_000, Tools: true, Reasoning: true}, // text only, unlike o3
+	"o4-mini":       {ContextWindow: 200_000, MaxOutputTokens: 100_000, Vision: true, Tools: true, Reasoning: true},
+	// Anthropic
+	"claude-3-5-haiku": {ContextWindow: 200_000, MaxOutputTokens: 8_192, Vision: true, Tools: true},
+	"claude-3":         {ContextWindow: 200_000, MaxOutputTokens: 8_192, Vision: true, Tools: true},
+	"claude-sonnet-4":  {ContextWindow: 200_000, MaxOutputTokens: 64_000, Vision: true, Tools: true},
+	"claude-opus-4":    {ContextWindow: 200_000, MaxOutputTokens: 32_000, Vision: true, Tools: true},
+	"claude-haiku-4":   {ContextWindow: 200_000, MaxOutputTokens: 64_000, Vision: true, Tools: true},
+	// Google
+	"gemini-1.5-pro": {ContextWindow: 2_097_152, MaxOutputTokens: 8_192, Vision: true, Tools: true},
+	"gemini-1.5":     {ContextWindow: 1_048_576, MaxOutputTokens: 8_192, Vision: true, Tools: true},
+	"gemini-2.0":     {ContextWindow: 1_048_576, MaxOutputTokens: 8_192, Vision: true, Tools: true},
+	"gemini-2.5":     {ContextWindow: 1_048_576, MaxOutputTokens: 65_536, Vision: true, Tools: true},
+	// Open models (OpenRouter and Ollama names)
+	"llama-3.1":       {ContextWindow: 131_072, Tools: true},
+	"llama-3.3":       {ContextWindow: 131_072, Tools: true},
+	"llama3":          {ContextWindow: 8_192},
+	"llama3.1":        {ContextWindow: 131_072, Tools: true},
+	"llama3.2":        {ContextWindow: 131_072, Tools: true},
+	"llama3.2-vision": {ContextWindow: 131_072, Vision: true},
+	"llama3.3":        {ContextWindow: 131_072, Tools: true},
+	"mistral":         {ContextWindow: 32_768, Tools: true},
+	"qwen2.5":         {ContextWindow: 32_768, Tools: true},
+	"qwen3":           {ContextWindow: 40_960, Tools: true},
+	"deepseek-chat":   {ContextWindow: 64_000, MaxOutputTokens: 8_192, Tools: true},
+	"deepseek-r1":     {ContextWindow: 64_000},
+	"gemma3":          {ContextWindow: 131_072, Vision: true},
+}
+
+// ModelRegistry answers capability questions about models, combining built-in
+// knowledge with the "models" overrides from config.
+type ModelRegistry struct {
+	overrides map[string]config.ModelConfig
+}
+
+// NewModelRegistry returns a registry with the given overrides (may be nil).
+func NewModelRegistry(overrides map[string]config.ModelConfig) *ModelRegistry {
+	norm := make(map[string]config.ModelConfig, len(overrides))
+	for k, v := range overrides {
+		norm[strings.ToLower(k)] = v
+	}
+	return &ModelRegistry{overrides: norm}
+}
+
+// Lookup returns the capabilities of model. Config overrides are matched like built-ins
+// (longest prefix, with or without a routing prefix) and only replace the fields they set.
+func (r *ModelRegistry) Lookup(model string) ModelInfo {
+	name := strings.ToLower(strings.TrimSpace(model))
+	info := DefaultModelInfo
+	if b, ok := matchModel(builtinModels, name); ok {
+		info = b
+	}
+	if r == nil {
+		return info
+	}
+	if o, ok := matchModel(r.overrides, name); ok {
+		if o.ContextWindow > 0 {
+			info.ContextWindow = o.ContextWindow
+		}
+		if o.MaxOutputTokens > 0 {
+			info.MaxOutputTokens = o.MaxOutputTokens
+		}
+		if o.Vision != nil {
+			info.Vision = *o.Vision
+		}
+		if o.Tools != nil {
+			info.Tools = *o.Tools
+		}
+		if o.Reasoning != nil {
+			info.Reasoning = *o.Reasoning
+		}
+	}
+	return info
+}
+
+// Known reports whether the built-in table or the overrides have an entry for model.
+func (r *ModelRegistry) Known(model string) bool {
+	name := strings.ToLower(strings.TrimSpace(model))
+	if _, ok := matchModel(builtinModels, name); ok {
+		return true
+	}
+	if r == nil {
+		return false
+	}
+	_, ok := matchModel(r.overrides, name)
+	return ok
+}
+
+// matchModel finds the entry whose key is the longest prefix of name, trying the full
+// name first and then the name without its routing prefix ("meta-llama/llama-3.3-70b" -> "llama-3.3-70b").
+func matchModel[T any](table map[string]T, name string) (T, bool) {
+	candidates := []string{name}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		candidates = append(candidates, name[i+1:])
+	}
+	for _, n := range candidates {
+		best := ""
+		for k := range table {
+			if strings.HasPrefix(n, k) && len(k) > len(best) {
+				best = k
+			}
+		}
+		if best != "" {
+			return table[best], true
+		}
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/local/picobot/internal/config"
+)
+
+func TestModelRegistryLookup(t *testing.T) {
+	r := NewModelRegistry(nil)
+	tests := []struct {
+		model  string
+		window int
+		vision bool
+	}{
+		{"gpt-4o-mini", 128_000, true},
+		{"google/gemini-2.5-flash", 1_048_576, true},
+		{"meta-llama/llama-3.3-70b-instruct:free", 131_072, false},
+		{"llama3:8b", 8_192, false},
+		{"llama3.2-vision:11b", 131_072, true},
+		{"o3", 200_000, true},
+		{"o3-mini", 200_000, false},
+		{"claude-3-5-haiku-latest", 200_000, true},
+		{"some-new-model", DefaultModelInfo.ContextWindow, true},
+	}
+	for _, tt := range tests {
+		got := r.Lookup(tt.model)
+		if got.ContextWindow != tt.window || got.Vision != tt.vision {
+			t.Errorf("Lookup(%q) = %+v, want window %d vision %v", tt.model, got, tt.window, tt.vision)
+		}
+	}
+}
+
+func TestModelRegistryOverrides(t *testing.T) {
+	no := false
+	r := NewModelRegistry(map[string]config.ModelConfig{
+		"qwen2.5":       {ContextWindow: 8_192},
+		"my-local-tune": {ContextWindow: 4_096, Tools: &no},
+	})
+	if got := r.Lookup("qwen2.5:14b"); got.ContextWindow != 8_192 || !got.Tools {
+		t.Errorf("override should only replace the context window, got %+v", got)
+	}
+	if got := r.Lookup("My-Local-Tune"); got.ContextWindow != 4_096 || got.Tools || !got.Vision {
+		t.Errorf("unexpected info for overridden unknown model: %+v", got)
+	}
+	if !r.Known("ollama/my-local-tune") || !r.Known("gpt-4o-mini") || r.Known("mystery-model") {
+		t.Error("Known should match built-in and overridden models only")
+	}
+}
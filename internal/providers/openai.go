@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -16,19 +15,29 @@ type OpenAIProvider struct {
 	APIKey  string
 	APIBase string // e.g. https://api.openai.com/v1 or https://openrouter.ai/api/v1
 	Client  *http.Client
+	Retry   RetryPolicy
+	Headers map[string]string // extra headers sent with every request (e.g. OpenRouter's HTTP-Referer)
+	// EmbedBatchSize caps the texts sent per /embeddings request; 0 means DefaultEmbedBatchSize.
+	EmbedBatchSize int
+	// Models tells which models need reasoning-model request fields; nil uses the built-in table.
+	Models *ModelRegistry
 }
 
+// openAIDefaultBase is used when no API base is configured.
+const openAIDefaultBase = "https://api.openai.com/v1"
+
 func NewOpenAIProvider(apiKey, apiBase string) *OpenAIProvider {
 	if apiBase == "" {
-		apiBase = "https://api.openai.com/v1" // sensible default; can be overridden
+		apiBase = openAIDefaultBase // sensible default; can be overridden
 	}
 	return &OpenAIProvider{
 		APIKey:  apiKey,
 		APIBase: strings.TrimRight(apiBase, "/"),
 		Client: &http.Client{
 			// Timeout: 0 means no client-side timeout; we wait for the endpoint to respond or time out.
-			// Some providers (e.g. OpenRouter free tier) can be very slow; prefer server-side limits.
+			// Some providers (e.g. OpenRouter free tier) can be very slow; Retry.AttemptTimeout bounds each attempt instead.
 		},
+		Retry: DefaultRetryPolicy,
 	}
 }
 
@@ -39,6 +48,34 @@ type chatRequest struct {
 	Model    string        `json:"model"`
 	Messages []messageJSON `json:"messages"`
 	Tools    []toolWrapper `json:"tools,omitempty"`
+	Stream   bool          `json:"stream,omitempty"`
+	// Generation options; omitted when unset so servers apply their defaults.
+	MaxTokens           int                 `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                 `json:"max_completion_tokens,omitempty"` // instead of max_tokens for reasoning models
+	Temperature         *float64            `json:"temperature,omitempty"`
+	TopP                *float64            `json:"top_p,omitempty"`
+	Stop                []string            `json:"stop,omitempty"`
+	Seed                *int                `json:"seed,omitempty"`
+	ToolChoice          interface{}         `json:"tool_choice,omitempty"` // "auto" | "none" | "required" | {"type":"function","function":{"name":...}}
+	ParallelToolCalls   *bool               `json:"parallel_tool_calls,omitempty"`
+	ResponseFormat      *responseFormatJSON `json:"response_format,omitempty"`
+	// StreamOptions asks for a final usage chunk when streaming.
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type responseFormatJSON struct {
+	Type       string          `json:"type"` // "json_schema"
+	JSONSchema *jsonSchemaJSON `json:"json_schema,omitempty"`
+}
+
+type jsonSchemaJSON struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	Strict bool                   `json:"strict,omitempty"`
 }
 
 // toolWrapper is the OpenAI tools array element: {"type": "function", "function": {...}}
@@ -58,6 +95,10 @@ type messageJSON struct {
 	Content    interface{}    `json:"content"` // string or []ContentPart for vision
 	ToolCallID string         `json:"tool_call_id,omitempty"`
 	ToolCalls  []toolCallJSON `json:"tool_calls,omitempty"`
+	// ReasoningDetails is sent back on assistant messages so OpenRouter can continue
+	// reasoning across tool calls. Plain reasoning text is not: DeepSeek rejects
+	// reasoning_content on input.
+	ReasoningDetails []map[string]interface{} `json:"reasoning_details,omitempty"`
 }
 
 type toolCallJSON struct {
@@ -76,26 +117,133 @@ type messageResponseJSON struct {
 	Role      string         `json:"role"`
 	Content   interface{}    `json:"content"` // API returns string or array
 	ToolCalls []toolCallJSON `json:"tool_calls,omitempty"`
+	reasoningJSON
+}
+
+// reasoningJSON holds the reasoning fields of a message or stream delta. Servers differ:
+// OpenRouter sends reasoning (and reasoning_details), DeepSeek and vLLM send reasoning_content.
+type reasoningJSON struct {
+	Reasoning        string                   `json:"reasoning,omitempty"`
+	ReasoningContent string                   `json:"reasoning_content,omitempty"`
+	ReasoningDetails []map[string]interface{} `json:"reasoning_details,omitempty"`
+}
+
+// text returns the reasoning text, falling back to the text of the reasoning details.
+func (r reasoningJSON) text() string {
+	if r.ReasoningContent != "" {
+		return r.ReasoningContent
+	}
+	if r.Reasoning != "" {
+		return r.Reasoning
+	}
+	return reasoningDetailsText(r.ReasoningDetails)
+}
+
+// reasoningDetailsText joins the readable parts of OpenRouter reasoning_details
+// ("reasoning.text" and "reasoning.summary"); encrypted details have none.
+func reasoningDetailsText(details []map[string]interface{}) string {
+	var b strings.Builder
+	for _, d := range details {
+		for _, k := range []string{"text", "summary"} {
+			if s, ok := d[k].(string); ok {
+				b.WriteString(s)
+			}
+		}
+	}
+	return b.String()
 }
 
 type chatResponse struct {
 	Choices []struct {
 		Message messageResponseJSON `json:"message"`
 	} `json:"choices"`
+	Usage *usageJSON `json:"usage,omitempty"`
+}
+
+type usageJSON struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+func (u *usageJSON) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, CachedTokens: u.PromptTokensDetails.CachedTokens}
 }
 
 // Chat calls an OpenAI-compatible chat completion endpoint and returns a simplified response.
-func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string) (LLMResponse, error) {
-	if p.APIKey == "" {
-		return LLMResponse{}, errors.New("OpenAI provider: API key is not configured")
+// Transient failures are retried according to p.Retry.
+func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	reqBody, err := p.buildRequest(messages, tools, model, opts)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	return p.Retry.do(ctx, "OpenAI", func(ctx context.Context) (LLMResponse, error) {
+		return p.chatOnce(ctx, reqBody)
+	}, nil)
+}
+
+// chatOnce performs a single non-streaming request.
+func (p *OpenAIProvider) chatOnce(ctx context.Context, reqBody chatRequest) (LLMResponse, error) {
+	resp, err := p.post(ctx, reqBody)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var out chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return LLMResponse{}, err
+	}
+
+	if len(out.Choices) == 0 {
+		return LLMResponse{}, errors.New("OpenAI API returned no choices")
+	}
+
+	msg := out.Choices[0].Message
+	r := toLLMResponse(ContentToString(msg.Content), msg.ToolCalls)
+	r.Usage = out.Usage.toUsage()
+	r.Reasoning = strings.TrimSpace(msg.text())
+	r.ReasoningDetails = msg.ReasoningDetails
+	r.Model = reqBody.Model
+	return r, nil
+}
+
+// buildRequest converts provider messages, tools and options into the OpenAI request body.
+func (p *OpenAIProvider) buildRequest(messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (chatRequest, error) {
+	// local servers such as Ollama need no key; api.openai.com always does
+	if p.APIKey == "" && p.APIBase == openAIDefaultBase {
+		return chatRequest{}, errors.New("OpenAI provider: API key is not configured")
 	}
 	if model == "" {
 		model = p.GetDefaultModel()
 	}
 
-	reqBody := chatRequest{Model: model, Messages: make([]messageJSON, 0, len(messages))}
+	reqBody := chatRequest{
+		Model:       model,
+		Messages:    make([]messageJSON, 0, len(messages)),
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+		Stop:        opts.Stop,
+		Seed:        opts.Seed,
+	}
+	if p.Models.Lookup(model).Reasoning {
+		reqBody.MaxTokens, reqBody.MaxCompletionTokens = 0, opts.MaxTokens
+		reqBody.Temperature, reqBody.TopP = nil, nil
+	}
+	if rf := opts.ResponseFormat; rf != nil {
+		reqBody.ResponseFormat = &responseFormatJSON{Type: "json_schema", JSONSchema: &jsonSchemaJSON{Name: rf.Name, Schema: rf.Schema, Strict: rf.Strict}}
+	}
 	for _, m := range messages {
 		mj := messageJSON{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		if m.Role == "assistant" {
+			mj.ReasoningDetails = openAIReasoningDetails(m.ReasoningDetails)
+		}
 		// Convert provider ToolCall to JSON-serializable toolCallJSON
 		for _, tc := range m.ToolCalls {
 			argsBytes, _ := json.Marshal(tc.Arguments)
@@ -132,68 +280,99 @@ func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message, tools []T
 				},
 			})
 		}
+		// tool_choice and parallel_tool_calls are rejected by some servers when no tools are sent
+		switch opts.ToolChoice {
+		case "":
+		case "auto", "none", "required":
+			reqBody.ToolChoice = opts.ToolChoice
+		default:
+			reqBody.ToolChoice = map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": opts.ToolChoice}}
+		}
+		reqBody.ParallelToolCalls = opts.ParallelToolCalls
 	}
+	return reqBody, nil
+}
 
-	b, err := json.Marshal(reqBody)
+// post sends the request body to the chat completions endpoint and returns the response
+// for a 2xx status. The caller must close the response body.
+func (p *OpenAIProvider) post(ctx context.Context, reqBody chatRequest) (*http.Response, error) {
+	return p.postJSON(ctx, "/chat/completions", reqBody, reqBody.Stream)
+}
+
+// postJSON posts body to path under APIBase and returns the response, or an *APIError for non-2xx statuses.
+func (p *OpenAIProvider) postJSON(ctx context.Context, path string, body interface{}, stream bool) (*http.Response, error) {
+	b, err := json.Marshal(body)
 	if err != nil {
-		return LLMResponse{}, err
+		return nil, err
 	}
 
-	url := fmt.Sprintf("%s/chat/completions", p.APIBase)
+	url := p.APIBase + path
 	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(b)))
 	if err != nil {
-		return LLMResponse{}, err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
 
 	resp, err := p.Client.Do(req)
 	if err != nil {
-		return LLMResponse{}, err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
 		// attempt to read response body for more details (do not expose API key)
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		body := strings.TrimSpace(string(bodyBytes))
 		log.Printf("OpenAI API non-2xx: %s body=%q", resp.Status, body)
-		if body == "" {
-			return LLMResponse{}, fmt.Errorf("OpenAI API error: %s", resp.Status)
-		}
-		return LLMResponse{}, fmt.Errorf("OpenAI API error: %s - %s", resp.Status, body)
-	}
-
-	var out chatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return LLMResponse{}, err
+		return nil, &APIError{Provider: "OpenAI", StatusCode: resp.StatusCode, Status: resp.Status, Body: body, RetryAfter: parseRetryAfter(resp.Header)}
 	}
+	return resp, nil
+}
 
-	if len(out.Choices) == 0 {
-		return LLMResponse{}, errors.New("OpenAI API returned no choices")
+// openAIReasoningDetails keeps the OpenRouter-style ("reasoning.*") details, dropping blocks
+// another provider produced (e.g. Anthropic thinking blocks after a fallback).
+func openAIReasoningDetails(details []map[string]interface{}) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, d := range details {
+		if t, _ := d["type"].(string); strings.HasPrefix(t, "reasoning.") {
+			out = append(out, d)
+		}
 	}
+	return out
+}
 
-	msg := out.Choices[0].Message
-	// If the model requested tool calls, parse them
-	if len(msg.ToolCalls) > 0 {
-		var tcs []ToolCall
-		for _, tc := range msg.ToolCalls {
-			var parsed map[string]interface{}
-			if err := json.Unmarshal([]byte(tc.Function.Arguments), &parsed); err != nil {
-				// skip unparseable tool calls
-				continue
-			}
-			t := ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: parsed}
-			if len(tc.ExtraContent) > 0 {
-				t.ExtraContent = tc.ExtraContent
-			}
-			tcs = append(tcs, t)
+// toLLMResponse normalizes assistant content and raw tool calls into an LLMResponse.
+// Tool calls with unparseable arguments are skipped.
+func toLLMResponse(content string, toolCalls []toolCallJSON) LLMResponse {
+	content = strings.TrimSpace(content)
+	var tcs []ToolCall
+	for _, tc := range toolCalls {
+		var parsed map[string]interface{}
+		args := tc.Function.Arguments
+		if strings.TrimSpace(args) == "" {
+			args = "{}"
+		}
+		if err := json.Unmarshal([]byte(args), &parsed); err != nil {
+			// skip unparseable tool calls
+			continue
 		}
-		if len(tcs) > 0 {
-			return LLMResponse{Content: strings.TrimSpace(ContentToString(msg.Content)), HasToolCalls: true, ToolCalls: tcs}, nil
+		t := ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: parsed}
+		if len(tc.ExtraContent) > 0 {
+			t.ExtraContent = tc.ExtraContent
 		}
+		tcs = append(tcs, t)
 	}
-
-	// No tool calls
-	return LLMResponse{Content: strings.TrimSpace(ContentToString(msg.Content)), HasToolCalls: false}, nil
+	if len(tcs) > 0 {
+		return LLMResponse{Content: content, HasToolCalls: true, ToolCalls: tcs}
+	}
+	return LLMResponse{Content: content, HasToolCalls: false}
 }
@@ -0,0 +1,168 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// streamChunk is one server-sent event payload from a streaming chat completion.
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string              `json:"content"`
+			ToolCalls []toolCallDeltaJSON `json:"tool_calls,omitempty"`
+			reasoningJSON
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *usageJSON `json:"usage,omitempty"` // only on the final chunk, with stream_options.include_usage
+	// Error is set when the server fails after the response has started, as OpenRouter does
+	// when the upstream provider drops out mid-stream.
+	Error *struct {
+		Code    json.RawMessage `json:"code"` // a number or a string, depending on the server
+		Message string          `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// streamError turns an error event into an *APIError, so it is retried or falls back like a
+// failed request. A numeric code is used as the status; others count as 502 Bad Gateway.
+func streamError(data string, code json.RawMessage) error {
+	status := http.StatusBadGateway
+	if n, err := strconv.Atoi(strings.Trim(string(code), `"`)); err == nil && n >= 400 {
+		status = n
+	}
+	return &APIError{Provider: "OpenAI", StatusCode: status, Status: fmt.Sprintf("%d %s (in stream)", status, http.StatusText(status)), Body: data}
+}
+
+// toolCallDeltaJSON is a fragment of a tool call; fragments sharing an Index belong to the same call.
+type toolCallDeltaJSON struct {
+	Index        int                    `json:"index"`
+	ID           string                 `json:"id,omitempty"`
+	Type         string                 `json:"type,omitempty"`
+	Function     toolCallFunctionJSON   `json:"function"`
+	ExtraContent map[string]interface{} `json:"extra_content,omitempty"`
+}
+
+// ChatStream calls the chat completion endpoint with stream=true and reads server-sent events.
+// onDelta receives each content fragment as it arrives; the returned response holds the full
+// content and the assembled tool calls, exactly as Chat would return them.
+// Failures are retried like Chat's, but only until the first delta has been delivered.
+func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions, onDelta func(delta string)) (LLMResponse, error) {
+	reqBody, err := p.buildRequest(messages, tools, model, opts)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	reqBody.Stream = true
+	reqBody.StreamOptions = &streamOptions{IncludeUsage: true}
+	emitted := false
+	return p.Retry.do(ctx, "OpenAI", func(ctx context.Context) (LLMResponse, error) {
+		return p.streamOnce(ctx, reqBody, func(d string) {
+			emitted = true
+			if onDelta != nil {
+				onDelta(d)
+			}
+		})
+	}, func() bool { return !emitted })
+}
+
+// streamOnce performs a single streaming request.
+func (p *OpenAIProvider) streamOnce(ctx context.Context, reqBody chatRequest, onDelta func(delta string)) (LLMResponse, error) {
+	resp, err := p.post(ctx, reqBody)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var content, reasoning strings.Builder
+	var details []map[string]interface{}
+	var calls []toolCallJSON // indexed by the delta's Index
+	var usage Usage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue // blank keep-alive lines, comments (": OPENROUTER PROCESSING"), event names
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != nil {
+			return LLMResponse{}, streamError(data, chunk.Error.Code)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.toUsage()
+		}
+		for _, ch := range chunk.Choices {
+			if ch.Delta.Content != "" {
+				content.WriteString(ch.Delta.Content)
+				onDelta(ch.Delta.Content)
+			}
+			// reasoning_details also carry the text, so only count the plain fields
+			reasoning.WriteString(ch.Delta.ReasoningContent + ch.Delta.Reasoning)
+			for _, d := range ch.Delta.ReasoningDetails {
+				details = appendReasoningDetail(details, d)
+			}
+			for _, d := range ch.Delta.ToolCalls {
+				for len(calls) <= d.Index {
+					calls = append(calls, toolCallJSON{Type: "function"})
+				}
+				tc := &calls[d.Index]
+				if d.ID != "" {
+					tc.ID = d.ID
+				}
+				if d.Function.Name != "" {
+					tc.Function.Name += d.Function.Name
+				}
+				tc.Function.Arguments += d.Function.Arguments
+				if len(d.ExtraContent) > 0 {
+					tc.ExtraContent = d.ExtraContent
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return LLMResponse{}, err
+	}
+	r := toLLMResponse(content.String(), calls)
+	r.Usage = usage
+	r.Reasoning = reasoning.String()
+	if r.Reasoning == "" {
+		r.Reasoning = reasoningDetailsText(details)
+	}
+	r.Reasoning = strings.TrimSpace(r.Reasoning)
+	r.ReasoningDetails = details
+	r.Model = reqBody.Model
+	return r, nil
+}
+
+// appendReasoningDetail adds a streamed reasoning_details fragment to details. Fragments of
+// the same block (same type and index) are merged, concatenating their text and summary.
+func appendReasoningDetail(details []map[string]interface{}, d map[string]interface{}) []map[string]interface{} {
+	if n := len(details); n > 0 {
+		last := details[n-1]
+		if last["type"] == d["type"] && fmt.Sprint(last["index"]) == fmt.Sprint(d["index"]) {
+			for k, v := range d {
+				s, isStr := v.(string)
+				prev, hadStr := last[k].(string)
+				if isStr && hadStr && (k == "text" || k == "summary") {
+					last[k] = prev + s
+				} else if v != nil && v != "" {
+					last[k] = v
+				}
+			}
+			return details
+		}
+	}
+	return append(details, d)
+}
@@ -2,12 +2,16 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/local/picobot/internal/config"
 )
 
 func TestOpenAIFunctionCallParsing(t *testing.T) {
@@ -45,7 +49,7 @@ func TestOpenAIFunctionCallParsing(t *testing.T) {
 	defer cancel()
 
 	msgs := []Message{{Role: "user", Content: "trigger"}}
-	resp, err := p.Chat(ctx, msgs, nil, "model-x")
+	resp, err := p.Chat(ctx, msgs, nil, "model-x", GenerationOptions{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -58,6 +62,9 @@ func TestOpenAIFunctionCallParsing(t *testing.T) {
 	if resp.ToolCalls[0].Arguments["content"] != "Hello from function" {
 		t.Fatalf("unexpected argument content: %v", resp.ToolCalls[0].Arguments)
 	}
+	if resp.Model != "model-x" {
+		t.Fatalf("expected the serving model in the response, got %q", resp.Model)
+	}
 }
 
 func TestOpenAIThoughtSignaturePreservation(t *testing.T) {
@@ -109,7 +116,7 @@ func TestOpenAIThoughtSignaturePreservation(t *testing.T) {
 
 	// First call: get tool call with thought_signature
 	msgs := []Message{{Role: "user", Content: "search for x"}}
-	resp, err := p.Chat(ctx, msgs, []ToolDefinition{{Name: "web", Description: "Search"}}, "gemini")
+	resp, err := p.Chat(ctx, msgs, []ToolDefinition{{Name: "web", Description: "Search"}}, "gemini", GenerationOptions{})
 	if err != nil {
 		t.Fatalf("first call: %v", err)
 	}
@@ -130,7 +137,7 @@ func TestOpenAIThoughtSignaturePreservation(t *testing.T) {
 		{Role: "assistant", Content: "", ToolCalls: resp.ToolCalls},
 		{Role: "tool", Content: "result", ToolCallID: resp.ToolCalls[0].ID},
 	}
-	resp2, err := p.Chat(ctx, messages, []ToolDefinition{{Name: "web", Description: "Search"}}, "gemini")
+	resp2, err := p.Chat(ctx, messages, []ToolDefinition{{Name: "web", Description: "Search"}}, "gemini", GenerationOptions{})
 	if err != nil {
 		t.Fatalf("second call (with history): %v", err)
 	}
@@ -138,3 +145,318 @@ func TestOpenAIThoughtSignaturePreservation(t *testing.T) {
 		t.Fatalf("expected final content, got %q", resp2.Content)
 	}
 }
+
+func TestOpenAIChatStreamAssemblesDeltas(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		if !strings.Contains(string(body), `"stream":true`) || !strings.Contains(string(body), `"include_usage":true`) {
+			w.WriteHeader(400)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		events := []string{
+			`: keep-alive`,
+			`data: {"choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`,
+			`data: {"choices":[{"delta":{"content":"lo"}}]}`,
+			`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"web","arguments":"{\"url\":"}}]}}]}`,
+			`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"https://x\"}"}}]}}]}`,
+			`data: {"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"list_skills","arguments":""}}]}}]}`,
+			`data: {"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":7,"prompt_tokens_details":{"cached_tokens":4}}}`,
+			`data: [DONE]`,
+		}
+		for _, e := range events {
+			w.Write([]byte(e + "\n\n"))
+		}
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL)
+	p.Client = &http.Client{Timeout: 5 * time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var deltas []string
+	resp, err := p.ChatStream(ctx, []Message{{Role: "user", Content: "hi"}}, nil, "model-x", GenerationOptions{}, func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if strings.Join(deltas, "") != "Hello" || len(deltas) != 2 {
+		t.Fatalf("unexpected deltas: %q", deltas)
+	}
+	if resp.Content != "Hello" {
+		t.Fatalf("expected assembled content 'Hello', got %q", resp.Content)
+	}
+	if !resp.HasToolCalls || len(resp.ToolCalls) != 2 {
+		t.Fatalf("expected two tool calls, got has=%v len=%d", resp.HasToolCalls, len(resp.ToolCalls))
+	}
+	if resp.ToolCalls[0].ID != "call_1" || resp.ToolCalls[0].Arguments["url"] != "https://x" {
+		t.Fatalf("unexpected first tool call: %+v", resp.ToolCalls[0])
+	}
+	if resp.ToolCalls[1].Name != "list_skills" {
+		t.Fatalf("unexpected second tool call: %+v", resp.ToolCalls[1])
+	}
+	if resp.Usage != (Usage{PromptTokens: 12, CompletionTokens: 7, CachedTokens: 4}) {
+		t.Fatalf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestOpenAIParsesReasoning(t *testing.T) {
+	var second string
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.Contains(string(body), "tool_calls") {
+			w.Write([]byte(`{"choices":[{"message":{
+			  "role": "assistant", "content": "",
+			  "reasoning": "The user wants the weather.",
+			  "reasoning_details": [{"type": "reasoning.encrypted", "data": "opaque", "index": 0}],
+			  "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "web", "arguments": "{}"}}]
+			}}]}`))
+			return
+		}
+		second = string(body)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Sunny.","reasoning_content":"Summarise the result."}}]}`))
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL)
+	p.Client = &http.Client{Timeout: 5 * time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tools := []ToolDefinition{{Name: "web", Description: "Fetch"}}
+	resp, err := p.Chat(ctx, []Message{{Role: "user", Content: "weather?"}}, tools, "m", GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Reasoning != "The user wants the weather." || len(resp.ReasoningDetails) != 1 {
+		t.Fatalf("unexpected reasoning %q, details %v", resp.Reasoning, resp.ReasoningDetails)
+	}
+	if resp.Content != "" {
+		t.Fatalf("reasoning must not leak into content, got %q", resp.Content)
+	}
+
+	messages := []Message{
+		{Role: "user", Content: "weather?"},
+		{Role: "assistant", ToolCalls: resp.ToolCalls, Reasoning: resp.Reasoning, ReasoningDetails: resp.ReasoningDetails},
+		{Role: "tool", Content: "sunny", ToolCallID: "call_1"},
+	}
+	resp, err = p.Chat(ctx, messages, tools, "m", GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Reasoning != "Summarise the result." {
+		t.Fatalf("expected reasoning_content to be parsed, got %q", resp.Reasoning)
+	}
+	if !strings.Contains(second, `"reasoning_details":[{"data":"opaque","index":0,"type":"reasoning.encrypted"}]`) {
+		t.Fatalf("expected reasoning_details to be sent back, got %s", second)
+	}
+	if strings.Contains(second, "The user wants the weather.") {
+		t.Fatalf("plain reasoning text must not be sent back, got %s", second)
+	}
+}
+
+func TestOpenAIChatStreamReportsErrorEvents(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		w.Write([]byte(`data: {"choices":[{"delta":{"content":"Hel"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"error":{"code":"server_error","message":"Provider disconnected"},"choices":[{"delta":{"content":""},"finish_reason":"error"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL)
+	p.Client = &http.Client{Timeout: 5 * time.Second}
+	_, err := p.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "model-x", GenerationOptions{}, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 502 || !strings.Contains(err.Error(), "Provider disconnected") {
+		t.Fatalf("expected a 502 APIError, got %v", err)
+	}
+	if !IsRetryable(err) {
+		t.Error("a mid-stream server error should be retryable, so fallbacks get a turn")
+	}
+}
+
+func TestOpenAIChatStreamCollectsReasoning(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`data: {"choices":[{"delta":{"reasoning":"Think","reasoning_details":[{"type":"reasoning.text","text":"Think","index":0}]}}]}`,
+			`data: {"choices":[{"delta":{"reasoning":"ing.","reasoning_details":[{"type":"reasoning.text","text":"ing.","index":0,"signature":"sig"}]}}]}`,
+			`data: {"choices":[{"delta":{"content":"Hi"}}]}`,
+			`data: [DONE]`,
+		}
+		for _, e := range events {
+			w.Write([]byte(e + "\n\n"))
+		}
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL)
+	p.Client = &http.Client{Timeout: 5 * time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var deltas []string
+	resp, err := p.ChatStream(ctx, []Message{{Role: "user", Content: "hi"}}, nil, "m", GenerationOptions{}, func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(deltas, "") != "Hi" {
+		t.Fatalf("reasoning must not be streamed as content, got %q", deltas)
+	}
+	if resp.Reasoning != "Thinking." {
+		t.Fatalf("unexpected reasoning %q", resp.Reasoning)
+	}
+	if len(resp.ReasoningDetails) != 1 || resp.ReasoningDetails[0]["text"] != "Thinking." || resp.ReasoningDetails[0]["signature"] != "sig" {
+		t.Fatalf("expected fragments merged into one detail, got %v", resp.ReasoningDetails)
+	}
+}
+
+// fastRetry keeps retry tests quick.
+var fastRetry = RetryPolicy{MaxRetries: 2, BackoffBase: time.Millisecond, BackoffMax: 50 * time.Millisecond}
+
+func TestOpenAIRetriesTransientErrors(t *testing.T) {
+	calls := 0
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"slow down"}`))
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+		}
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL)
+	p.Retry = fastRetry
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m", GenerationOptions{})
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if resp.Content != "ok" || calls != 3 {
+		t.Fatalf("got content %q after %d calls, want %q after 3", resp.Content, calls, "ok")
+	}
+}
+
+func TestOpenAIDoesNotRetryClientErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"context length", 400, `{"error":{"code":"context_length_exceeded","message":"This model's maximum context length is 8192 tokens"}}`, ErrContextLength},
+		{"auth", 401, `{"error":"invalid api key"}`, ErrAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer h.Close()
+
+			p := NewOpenAIProvider("test-key", h.URL)
+			p.Retry = fastRetry
+			_, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m", GenerationOptions{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("errors.Is(%v, %v) = false", err, tt.want)
+			}
+			if calls != 1 {
+				t.Fatalf("expected 1 call, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestOpenAIRetryAfterBeyondLimitGivesUp(t *testing.T) {
+	calls := 0
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL)
+	p.Retry = fastRetry
+	_, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m", GenerationOptions{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected rate-limit APIError, got %v", err)
+	}
+	if apiErr.RetryAfter != 120*time.Second {
+		t.Errorf("RetryAfter = %v, want 2m0s", apiErr.RetryAfter)
+	}
+	if calls != 1 {
+		t.Fatalf("expected no retry when Retry-After exceeds BackoffMax, got %d calls", calls)
+	}
+}
+
+func TestOpenAISendsGenerationOptions(t *testing.T) {
+	var got map[string]interface{}
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = nil
+		json.Unmarshal(body, &got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL)
+	msgs := []Message{{Role: "user", Content: "hi"}}
+
+	// unset options are omitted so the server defaults apply
+	if _, err := p.Chat(context.Background(), msgs, nil, "m", GenerationOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"max_tokens", "temperature", "top_p", "stop", "seed", "tool_choice", "parallel_tool_calls", "response_format"} {
+		if _, ok := got[k]; ok {
+			t.Errorf("expected %q to be omitted, got %v", k, got[k])
+		}
+	}
+
+	zero, seed, no := 0.0, 7, false
+	opts := GenerationOptions{MaxTokens: 256, Temperature: &zero, Stop: []string{"END"}, Seed: &seed, ToolChoice: "web", ParallelToolCalls: &no}
+	if _, err := p.Chat(context.Background(), msgs, []ToolDefinition{{Name: "web"}}, "m", opts); err != nil {
+		t.Fatal(err)
+	}
+	if got["max_tokens"] != 256.0 || got["temperature"] != 0.0 || got["seed"] != 7.0 || got["parallel_tool_calls"] != false {
+		t.Errorf("unexpected options in request: %v", got)
+	}
+	tc, _ := got["tool_choice"].(map[string]interface{})
+	if fn, _ := tc["function"].(map[string]interface{}); fn["name"] != "web" {
+		t.Errorf("unexpected tool_choice: %v", got["tool_choice"])
+	}
+
+	// reasoning models take max_completion_tokens and only their default temperature
+	yes := true
+	p.Models = NewModelRegistry(map[string]config.ModelConfig{"my-reasoner": {Reasoning: &yes}})
+	for _, model := range []string{"o3-mini", "openai/gpt-5-mini", "my-reasoner"} {
+		if _, err := p.Chat(context.Background(), msgs, nil, model, opts); err != nil {
+			t.Fatal(err)
+		}
+		_, hasMax := got["max_tokens"]
+		_, hasTemp := got["temperature"]
+		if hasMax || hasTemp || got["max_completion_tokens"] != 256.0 {
+			t.Errorf("%s: unexpected options in request: %v", model, got)
+		}
+	}
+}
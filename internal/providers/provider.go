@@ -9,6 +9,10 @@ type Message struct {
 	Content    interface{} `json:"content"` // string or []ContentPart for vision
 	ToolCallID string      `json:"tool_call_id,omitempty"` // set when Role == "tool"
 	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`  // set on assistant msgs with tool calls
+	// Reasoning fields are set on assistant msgs from LLMResponse so providers that need
+	// the model's reasoning sent back within a turn (signed thinking blocks) can do so.
+	Reasoning        string                   `json:"reasoning,omitempty"`
+	ReasoningDetails []map[string]interface{} `json:"reasoning_details,omitempty"`
 }
 
 // ToolDefinition is a lightweight description of a tool available to the model.
@@ -31,17 +35,71 @@ type LLMResponse struct {
 	Content      string     `json:"content"`
 	HasToolCalls bool       `json:"hasToolCalls"`
 	ToolCalls    []ToolCall `json:"toolCalls,omitempty"`
+	Usage        Usage      `json:"usage"`
+	// Reasoning is the model's thinking text, when the API returns it (reasoning models on
+	// OpenRouter, DeepSeek, Anthropic extended thinking); it is never part of Content.
+	Reasoning string `json:"reasoning,omitempty"`
+	// ReasoningDetails holds the provider's structured reasoning blocks (OpenRouter
+	// reasoning_details, Anthropic thinking blocks with signatures) to pass back as received.
+	ReasoningDetails []map[string]interface{} `json:"reasoningDetails,omitempty"`
+	// Model is the model that served the call, as sent to the API: after fallbacks and without
+	// a provider routing prefix. Empty for providers that call no API.
+	Model string `json:"model,omitempty"`
+	// Replayed marks a response played back from a cassette instead of a real call.
+	Replayed bool `json:"-"`
+}
+
+// Usage is the token count reported by the API for one call; zero when the API did not report it.
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`           // all input tokens, including cached ones
+	CompletionTokens int `json:"completionTokens"`       // generated tokens
+	CachedTokens     int `json:"cachedTokens,omitempty"` // input tokens served from the provider's prompt cache
+}
+
+// GenerationOptions tunes a single request. Zero values (and nil pointers) leave the
+// provider's default in place, so GenerationOptions{} sends nothing extra.
+type GenerationOptions struct {
+	MaxTokens   int      // upper bound on generated tokens
+	Temperature *float64 // nil = provider default; 0 is a valid value
+	TopP        *float64
+	Stop        []string
+	Seed        *int // ignored by providers without deterministic sampling
+	// ToolChoice is "auto", "none", "required", or the name of a tool the model must call.
+	// Only sent when tools are present.
+	ToolChoice string
+	// ParallelToolCalls, when set to false, asks for at most one tool call per reply.
+	ParallelToolCalls *bool
+	// ResponseFormat asks for a reply that is JSON matching a schema; nil means free text.
+	// See ChatJSON for a helper that also decodes and validates the reply.
+	ResponseFormat *ResponseFormat
+}
+
+// ResponseFormat describes the JSON a reply must match.
+type ResponseFormat struct {
+	Name   string                 // identifier for the schema, [a-zA-Z0-9_-]
+	Schema map[string]interface{} // JSON Schema of the reply
+	Strict bool                   // ask the server to enforce the schema exactly (OpenAI strict mode)
 }
 
 // LLMProvider is the interface used by the agent loop to call LLMs.
 type LLMProvider interface {
 	// Chat sends messages to the model and returns a normalized response.
-	Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string) (LLMResponse, error)
+	Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error)
 
 	// GetDefaultModel returns the provider's default model string.
 	GetDefaultModel() string
 }
 
+// StreamingProvider is implemented by providers that can stream partial output.
+// Callers should type-assert for it and fall back to Chat when it is not implemented.
+type StreamingProvider interface {
+	LLMProvider
+
+	// ChatStream behaves like Chat but calls onDelta with each content fragment as it arrives.
+	// The returned response holds the full content and the assembled tool calls.
+	ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions, onDelta func(delta string)) (LLMResponse, error)
+}
+
 // ContentToString extracts a string from Message.Content (string or array of parts).
 func ContentToString(c interface{}) string {
 	if c == nil {
@@ -12,7 +12,7 @@ func TestStubProviderEcho(t *testing.T) {
 	defer cancel()
 
 	msgs := []Message{{Role: "user", Content: "hello world"}}
-	resp, err := p.Chat(ctx, msgs, nil, "")
+	resp, err := p.Chat(ctx, msgs, nil, "", GenerationOptions{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -0,0 +1,75 @@
+package providers
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// ProviderRegistry routes each request to one of several named providers. A model written
+// as "name/model" goes to the provider called name with the prefix removed; any other model
+// (including OpenRouter-style "google/gemini-2.5-flash" when no provider is called "google")
+// goes to the default provider unchanged.
+type ProviderRegistry struct {
+	providers   map[string]LLMProvider
+	defaultName string
+}
+
+// NewProviderRegistry returns a registry over providers; defaultName must be one of its keys.
+func NewProviderRegistry(providers map[string]LLMProvider, defaultName string) *ProviderRegistry {
+	return &ProviderRegistry{providers: providers, defaultName: defaultName}
+}
+
+// Names returns the registered provider names, sorted.
+func (r *ProviderRegistry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for n := range r.providers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the provider registered under name.
+func (r *ProviderRegistry) Get(name string) (LLMProvider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Resolve returns the provider that serves model and the model name to send it.
+func (r *ProviderRegistry) Resolve(model string) (LLMProvider, string) {
+	if name, rest, ok := strings.Cut(model, "/"); ok {
+		if p, ok := r.providers[name]; ok {
+			return p, rest
+		}
+	}
+	return r.providers[r.defaultName], model
+}
+
+func (r *ProviderRegistry) GetDefaultModel() string {
+	return r.providers[r.defaultName].GetDefaultModel()
+}
+
+func (r *ProviderRegistry) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	p, m := r.Resolve(model)
+	return p.Chat(ctx, messages, tools, m, opts)
+}
+
+// ChatStream streams when the resolved provider can, and otherwise falls back to Chat.
+func (r *ProviderRegistry) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions, onDelta func(delta string)) (LLMResponse, error) {
+	p, m := r.Resolve(model)
+	if sp, ok := p.(StreamingProvider); ok {
+		return sp.ChatStream(ctx, messages, tools, m, opts, onDelta)
+	}
+	return p.Chat(ctx, messages, tools, m, opts)
+}
+
+// Embed embeds with the provider resolved from model, if it is an Embedder.
+func (r *ProviderRegistry) Embed(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	p, m := r.Resolve(model)
+	e, ok := p.(Embedder)
+	if !ok {
+		return nil, ErrEmbeddingsUnsupported
+	}
+	return e.Embed(ctx, texts, m)
+}
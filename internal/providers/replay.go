@@ -0,0 +1,210 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// ReplayMode selects whether a ReplayProvider records or replays.
+type ReplayMode int
+
+const (
+	// ReplayRecord forwards requests to the wrapped provider and appends each
+	// request/response pair to the cassette.
+	ReplayRecord ReplayMode = iota
+	// ReplayPlayback answers requests from the cassette without any network access.
+	ReplayPlayback
+)
+
+// Cassette is the on-disk form of a recording.
+type Cassette struct {
+	DefaultModel string        `json:"defaultModel"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded Chat call.
+type Interaction struct {
+	Hash     string        `json:"hash"`
+	Request  replayRequest `json:"request"`
+	Response LLMResponse   `json:"response"`
+}
+
+// replayRequest is the normalised request that is hashed to match calls on replay.
+// Tool descriptions/schemas and generation options are left out so that wording
+// changes don't invalidate recordings; timestamps and UUIDs are masked.
+type replayRequest struct {
+	Model    string          `json:"model"`
+	Messages []replayMessage `json:"messages"`
+	Tools    []string        `json:"tools,omitempty"`
+}
+
+type replayMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCallID string     `json:"toolCallId,omitempty"`
+	ToolCalls  []ToolCall `json:"toolCalls,omitempty"`
+}
+
+// ReplayProvider records Chat calls to a cassette file, or replays them from one,
+// so agent behaviour can be reproduced in tests without network access.
+type ReplayProvider struct {
+	mode  ReplayMode
+	inner LLMProvider // nil in playback mode
+	path  string
+
+	mu       sync.Mutex
+	cassette Cassette
+	played   map[string]int // hash -> number of times replayed
+}
+
+// NewReplayProvider opens a cassette. In ReplayRecord mode inner handles the requests and
+// the cassette is (re)written after every call; in ReplayPlayback mode inner is ignored and
+// the cassette must exist.
+func NewReplayProvider(path string, mode ReplayMode, inner LLMProvider) (*ReplayProvider, error) {
+	p := &ReplayProvider{mode: mode, inner: inner, path: path, played: map[string]int{}}
+	switch mode {
+	case ReplayRecord:
+		if inner == nil {
+			return nil, fmt.Errorf("replay: recording requires a provider")
+		}
+		p.cassette.DefaultModel = inner.GetDefaultModel()
+	case ReplayPlayback:
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("replay: reading cassette: %w", err)
+		}
+		if err := json.Unmarshal(b, &p.cassette); err != nil {
+			return nil, fmt.Errorf("replay: parsing cassette %s: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+func (p *ReplayProvider) GetDefaultModel() string {
+	if p.mode == ReplayRecord {
+		return p.inner.GetDefaultModel()
+	}
+	return p.cassette.DefaultModel
+}
+
+func (p *ReplayProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	req, hash := normaliseRequest(messages, tools, model)
+	if p.mode == ReplayPlayback {
+		return p.replay(hash)
+	}
+	resp, err := p.inner.Chat(ctx, messages, tools, model, opts)
+	if err != nil {
+		return resp, err
+	}
+	return resp, p.record(req, hash, resp)
+}
+
+// ChatStream streams from the wrapped provider when recording. On replay the whole
+// recorded content is delivered as a single delta.
+func (p *ReplayProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions, onDelta func(delta string)) (LLMResponse, error) {
+	req, hash := normaliseRequest(messages, tools, model)
+	if p.mode == ReplayPlayback {
+		resp, err := p.replay(hash)
+		if err == nil && resp.Content != "" && onDelta != nil {
+			onDelta(resp.Content)
+		}
+		return resp, err
+	}
+	sp, ok := p.inner.(StreamingProvider)
+	if !ok {
+		return p.Chat(ctx, messages, tools, model, opts)
+	}
+	resp, err := sp.ChatStream(ctx, messages, tools, model, opts, onDelta)
+	if err != nil {
+		return resp, err
+	}
+	return resp, p.record(req, hash, resp)
+}
+
+// replay returns the recorded responses for hash in recording order; once they are
+// used up the last one is repeated.
+func (p *ReplayProvider) replay(hash string) (LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var matches []LLMResponse
+	for _, in := range p.cassette.Interactions {
+		if in.Hash == hash {
+			matches = append(matches, in.Response)
+		}
+	}
+	if len(matches) == 0 {
+		return LLMResponse{}, fmt.Errorf("replay: no recorded response for request %s in %s", hash[:12], p.path)
+	}
+	n := p.played[hash]
+	p.played[hash] = n + 1
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	resp := matches[n]
+	resp.Replayed = true
+	return resp, nil
+}
+
+func (p *ReplayProvider) record(req replayRequest, hash string, resp LLMResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cassette.Interactions = append(p.cassette.Interactions, Interaction{Hash: hash, Request: req, Response: resp})
+	b, err := json.MarshalIndent(p.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(p.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(p.path, b, 0o644); err != nil {
+		return fmt.Errorf("replay: writing cassette: %w", err)
+	}
+	return nil
+}
+
+var (
+	replayTimestampRE = regexp.MustCompile(`\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:?\d{2})?)?`)
+	replayUUIDRE      = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+)
+
+// maskVolatile replaces values that differ between otherwise identical runs.
+func maskVolatile(s string) string {
+	s = replayUUIDRE.ReplaceAllString(s, "<uuid>")
+	return replayTimestampRE.ReplaceAllString(s, "<time>")
+}
+
+// normaliseRequest returns the normalised form of a request and its hex SHA-256.
+func normaliseRequest(messages []Message, tools []ToolDefinition, model string) (replayRequest, string) {
+	req := replayRequest{Model: model, Messages: make([]replayMessage, 0, len(messages))}
+	for _, m := range messages {
+		content := ContentToString(m.Content)
+		if _, isText := m.Content.(string); !isText && m.Content != nil {
+			// multimodal: hash the parts so a different image is a different request
+			b, _ := json.Marshal(m.Content)
+			content = string(b)
+		}
+		req.Messages = append(req.Messages, replayMessage{
+			Role:       m.Role,
+			Content:    maskVolatile(content),
+			ToolCallID: m.ToolCallID,
+			ToolCalls:  m.ToolCalls,
+		})
+	}
+	for _, t := range tools {
+		req.Tools = append(req.Tools, t.Name)
+	}
+	sort.Strings(req.Tools)
+	b, _ := json.Marshal(req)
+	sum := sha256.Sum256(b)
+	return req, hex.EncodeToString(sum[:])
+}
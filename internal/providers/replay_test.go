@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countingProvider numbers its replies so replayed responses can be told apart.
+type countingProvider struct{ n int }
+
+func (p *countingProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	p.n++
+	last := ContentToString(messages[len(messages)-1].Content)
+	return LLMResponse{Content: strings.Repeat("!", p.n) + last}, nil
+}
+
+func (p *countingProvider) GetDefaultModel() string { return "counting" }
+
+func TestReplayProviderRecordsAndReplays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "chat.json")
+	ctx := context.Background()
+	tools := []ToolDefinition{{Name: "web", Description: "Fetch a URL"}}
+
+	rec, err := NewReplayProvider(path, ReplayRecord, &countingProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded []string
+	for _, msg := range []string{"hi at 2026-02-07 10:15:00", "hi at 2026-02-07 10:15:00", "bye"} {
+		resp, err := rec.Chat(ctx, []Message{{Role: "user", Content: msg}}, tools, "m", GenerationOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, resp.Content)
+	}
+
+	play, err := NewReplayProvider(path, ReplayPlayback, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if play.GetDefaultModel() != "counting" {
+		t.Errorf("default model = %q, want the recorded provider's", play.GetDefaultModel())
+	}
+	// a different timestamp and tool description still match; repeated requests replay in order
+	tools[0].Description = "Fetch a web page"
+	for i, msg := range []string{"hi at 2026-03-01 08:00:00", "hi at 2026-03-01 08:00:00", "bye"} {
+		resp, err := play.Chat(ctx, []Message{{Role: "user", Content: msg}}, tools, "m", GenerationOptions{})
+		if err != nil {
+			t.Fatalf("replay %d: %v", i, err)
+		}
+		if resp.Content != recorded[i] || !resp.Replayed {
+			t.Errorf("replay %d = %q (replayed %v), want %q", i, resp.Content, resp.Replayed, recorded[i])
+		}
+	}
+
+	if _, err := play.Chat(ctx, []Message{{Role: "user", Content: "something new"}}, tools, "m", GenerationOptions{}); err == nil {
+		t.Fatal("expected an error for a request that was never recorded")
+	}
+}
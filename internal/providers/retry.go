@@ -0,0 +1,91 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how a provider repeats requests that fail with a retryable error.
+type RetryPolicy struct {
+	MaxRetries     int           // attempts after the first; 0 disables retries
+	AttemptTimeout time.Duration // limit for a single attempt, including reading the body; 0 = none
+	Deadline       time.Duration // overall limit across all attempts and backoff; 0 = none
+	BackoffBase    time.Duration // first backoff; doubled on each retry
+	BackoffMax     time.Duration // cap for a single backoff (and for honoured Retry-After values)
+}
+
+// DefaultRetryPolicy is used by NewOpenAIProvider.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	AttemptTimeout: 3 * time.Minute,
+	Deadline:       5 * time.Minute,
+	BackoffBase:    time.Second,
+	BackoffMax:     30 * time.Second,
+}
+
+// backoff returns the wait before retry number n (0-based) using "equal jitter":
+// half the exponential delay plus a random share of the other half.
+func (rp RetryPolicy) backoff(n int) time.Duration {
+	d := rp.BackoffBase << n
+	if d <= 0 || (rp.BackoffMax > 0 && d > rp.BackoffMax) {
+		d = rp.BackoffMax
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// do runs attempt until it succeeds, fails with a non-retryable error, or the policy is exhausted.
+// canRetry, if non-nil, is consulted after a failure (e.g. streaming must not retry once output was shown).
+// A Retry-After value on an APIError replaces the computed backoff.
+func (rp RetryPolicy) do(ctx context.Context, name string, attempt func(ctx context.Context) (LLMResponse, error), canRetry func() bool) (LLMResponse, error) {
+	if rp.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rp.Deadline)
+		defer cancel()
+	}
+	for n := 0; ; n++ {
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if rp.AttemptTimeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, rp.AttemptTimeout)
+		}
+		resp, err := attempt(actx)
+		attemptTimedOut := errors.Is(actx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+		cancel()
+		if err == nil {
+			return resp, nil
+		}
+		if attemptTimedOut {
+			err = fmt.Errorf("%s: attempt timed out after %v: %w", name, rp.AttemptTimeout, err)
+		}
+		if n >= rp.MaxRetries || !IsRetryable(err) || ctx.Err() != nil || (canRetry != nil && !canRetry()) {
+			return LLMResponse{}, err
+		}
+
+		wait := rp.backoff(n)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+			if rp.BackoffMax > 0 && wait > rp.BackoffMax {
+				return LLMResponse{}, err // server asked us to wait longer than we are willing to
+			}
+		}
+		if dl, ok := ctx.Deadline(); ok && time.Until(dl) < wait {
+			return LLMResponse{}, err
+		}
+		log.Printf("%s: %v; retrying in %v (attempt %d/%d)", name, err, wait.Round(time.Millisecond), n+2, rp.MaxRetries+1)
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return LLMResponse{}, err
+		case <-t.C:
+		}
+	}
+}
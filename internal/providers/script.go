@@ -0,0 +1,186 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Script is the on-disk form of a ScriptedProvider script (YAML or JSON).
+type Script struct {
+	Model string       `yaml:"model"` // reported by GetDefaultModel; defaults to "script-model"
+	Turns []ScriptTurn `yaml:"turns"`
+}
+
+// ScriptTurn is one canned reply: text, tool calls, or both.
+type ScriptTurn struct {
+	Match     *ScriptMatch     `yaml:"match"` // nil matches any incoming message
+	Text      string           `yaml:"text"`  // "{{message}}" is replaced by the incoming message
+	ToolCalls []ScriptToolCall `yaml:"toolCalls"`
+	Repeat    bool             `yaml:"repeat"` // keep the turn available after it has been used
+}
+
+// ScriptMatch restricts a turn to certain incoming messages. All fields that are set must match.
+type ScriptMatch struct {
+	Role     string `yaml:"role"`     // "user" or "tool"
+	Contains string `yaml:"contains"` // case-insensitive substring of the message
+	Regex    string `yaml:"regex"`
+	Tool     string `yaml:"tool"`   // the message is the result of a call to this tool
+	System   string `yaml:"system"` // case-insensitive substring of the system prompt
+
+	re *regexp.Regexp
+}
+
+// ScriptToolCall is a tool call the scripted model makes.
+type ScriptToolCall struct {
+	Name      string                 `yaml:"name"`
+	Arguments map[string]interface{} `yaml:"arguments"`
+}
+
+// ScriptedProvider answers from a script instead of an LLM, so tool calling, compaction and
+// the channels can be exercised offline. For each call it picks the first unused turn whose
+// match accepts the incoming message (the last message of the request).
+type ScriptedProvider struct {
+	script Script
+
+	mu    sync.Mutex
+	used  []bool
+	calls int
+}
+
+// LoadScriptedProvider reads a script from path.
+func LoadScriptedProvider(path string) (*ScriptedProvider, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("script: %w", err)
+	}
+	var s Script
+	// YAML is a superset of JSON, so one decoder handles both
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("script: parsing %s: %w", path, err)
+	}
+	return NewScriptedProvider(s)
+}
+
+// NewScriptedProvider validates s and compiles its regexes.
+func NewScriptedProvider(s Script) (*ScriptedProvider, error) {
+	if len(s.Turns) == 0 {
+		return nil, fmt.Errorf("script: no turns")
+	}
+	for i := range s.Turns {
+		t := &s.Turns[i]
+		if t.Text == "" && len(t.ToolCalls) == 0 {
+			return nil, fmt.Errorf("script: turn %d has neither text nor tool calls", i+1)
+		}
+		for _, tc := range t.ToolCalls {
+			if tc.Name == "" {
+				return nil, fmt.Errorf("script: turn %d has a tool call without a name", i+1)
+			}
+		}
+		if m := t.Match; m != nil && m.Regex != "" {
+			re, err := regexp.Compile(m.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("script: turn %d: %w", i+1, err)
+			}
+			m.re = re
+		}
+	}
+	if s.Model == "" {
+		s.Model = "script-model"
+	}
+	return &ScriptedProvider{script: s, used: make([]bool, len(s.Turns))}, nil
+}
+
+func (p *ScriptedProvider) GetDefaultModel() string { return p.script.Model }
+
+func (p *ScriptedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	in := incomingMessage(messages)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, t := range p.script.Turns {
+		if p.used[i] && !t.Repeat {
+			continue
+		}
+		if !t.Match.matches(in) {
+			continue
+		}
+		p.used[i] = true
+		return p.reply(t, in.content), nil
+	}
+	return LLMResponse{Content: fmt.Sprintf("(script) No scripted reply for: %s", in.content)}, nil
+}
+
+func (p *ScriptedProvider) reply(t ScriptTurn, message string) LLMResponse {
+	resp := LLMResponse{Content: strings.ReplaceAll(t.Text, "{{message}}", message)}
+	for _, tc := range t.ToolCalls {
+		p.calls++
+		args := tc.Arguments
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		resp.ToolCalls = append(resp.ToolCalls, ToolCall{ID: fmt.Sprintf("script_call_%d", p.calls), Name: tc.Name, Arguments: args})
+	}
+	resp.HasToolCalls = len(resp.ToolCalls) > 0
+	return resp
+}
+
+// scriptInput is the message a turn is matched against.
+type scriptInput struct {
+	role    string
+	content string
+	tool    string // name of the tool whose result this is, for role "tool"
+	system  string
+}
+
+func incomingMessage(messages []Message) scriptInput {
+	if len(messages) == 0 {
+		return scriptInput{}
+	}
+	last := messages[len(messages)-1]
+	in := scriptInput{role: last.Role, content: ContentToString(last.Content)}
+	if messages[0].Role == "system" {
+		in.system = ContentToString(messages[0].Content)
+	}
+	if last.Role == "tool" {
+		for i := len(messages) - 2; i >= 0 && in.tool == ""; i-- {
+			for _, tc := range messages[i].ToolCalls {
+				if tc.ID == last.ToolCallID {
+					in.tool = tc.Name
+					break
+				}
+			}
+		}
+	}
+	return in
+}
+
+func (m *ScriptMatch) matches(in scriptInput) bool {
+	if m == nil {
+		return true
+	}
+	if m.Role != "" && m.Role != in.role {
+		return false
+	}
+	if m.Tool != "" && m.Tool != in.tool {
+		return false
+	}
+	if m.Contains != "" && !containsFold(in.content, m.Contains) {
+		return false
+	}
+	if m.System != "" && !containsFold(in.system, m.System) {
+		return false
+	}
+	if m.re != nil && !m.re.MatchString(in.content) {
+		return false
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,87 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testScript = `
+model: demo
+turns:
+  - match: { system: summarizer }
+    text: A summary.
+    repeat: true
+  - match: { role: user, contains: weather }
+    text: Let me check.
+    toolCalls:
+      - name: web
+        arguments: { url: "https://wttr.in/Oslo" }
+  - match: { role: tool, tool: web }
+    text: It is sunny.
+  - match: { regex: "^/echo (.*)" }
+    text: "You said: {{message}}"
+    repeat: true
+  - text: Hello!
+`
+
+func TestScriptedProviderFollowsScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.yaml")
+	if err := os.WriteFile(path, []byte(testScript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadScriptedProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GetDefaultModel() != "demo" {
+		t.Errorf("default model = %q", p.GetDefaultModel())
+	}
+	ctx := context.Background()
+	chat := func(msgs ...Message) LLMResponse {
+		t.Helper()
+		resp, err := p.Chat(ctx, msgs, nil, "", GenerationOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	user := Message{Role: "user", Content: "What's the WEATHER in Oslo?"}
+	resp := chat(user)
+	if !resp.HasToolCalls || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "web" || resp.ToolCalls[0].Arguments["url"] != "https://wttr.in/Oslo" {
+		t.Fatalf("expected a web tool call, got %+v", resp)
+	}
+	assistant := Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls}
+	result := Message{Role: "tool", ToolCallID: resp.ToolCalls[0].ID, Content: "sunny, 20C"}
+	if resp := chat(user, assistant, result); resp.Content != "It is sunny." || resp.HasToolCalls {
+		t.Errorf("expected the reply to the tool result, got %+v", resp)
+	}
+
+	// matched turns are used once unless they repeat; the catch-all comes last
+	if resp := chat(Message{Role: "user", Content: "weather again?"}); resp.Content != "Hello!" {
+		t.Errorf("expected the catch-all turn, got %q", resp.Content)
+	}
+	for i := 0; i < 2; i++ {
+		if resp := chat(Message{Role: "user", Content: "/echo hi"}); resp.Content != "You said: /echo hi" {
+			t.Errorf("repeat %d: got %q", i, resp.Content)
+		}
+	}
+	summarize := []Message{{Role: "system", Content: "You are a summarizer."}, {Role: "user", Content: "user: weather?"}}
+	if resp := chat(summarize...); resp.Content != "A summary." {
+		t.Errorf("expected the summary turn, got %q", resp.Content)
+	}
+	if resp := chat(Message{Role: "user", Content: "anything"}); resp.Content != "(script) No scripted reply for: anything" {
+		t.Errorf("expected the no-match reply, got %q", resp.Content)
+	}
+}
+
+func TestScriptedProviderRejectsEmptyTurns(t *testing.T) {
+	if _, err := NewScriptedProvider(Script{Turns: []ScriptTurn{{Match: &ScriptMatch{Contains: "x"}}}}); err == nil {
+		t.Fatal("expected an error for a turn without text or tool calls")
+	}
+	if _, err := NewScriptedProvider(Script{Turns: []ScriptTurn{{Text: "x", Match: &ScriptMatch{Regex: "("}}}}); err == nil {
+		t.Fatal("expected an error for an invalid regex")
+	}
+}
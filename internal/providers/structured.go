@@ -0,0 +1,193 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// StructuredRetries is how many times ChatJSON asks again after a reply it cannot use.
+const StructuredRetries = 2
+
+// ErrInvalidStructuredOutput is returned by ChatJSON when no reply could be decoded and validated.
+var ErrInvalidStructuredOutput = errors.New("model did not return valid structured output")
+
+// Validator is implemented by ChatJSON targets that check more than the JSON shape.
+type Validator interface {
+	Validate() error
+}
+
+// ChatJSON asks the model for a reply matching out's JSON schema and decodes it into out,
+// which must be a non-nil pointer. opts.ResponseFormat is derived from out with SchemaFor
+// unless it is already set. A reply that is not valid JSON, does not decode, or fails
+// out's Validate method is shown to the model with the error and asked for again, up to
+// StructuredRetries times. A tool call reply is accepted too, using its arguments. If the
+// provider rejects response_format, the call is made once more with the schema in the
+// system prompt instead.
+//
+// The last response is returned as well, so callers can fall back to its free text when the
+// provider ignores the requested format.
+func ChatJSON(ctx context.Context, p LLMProvider, messages []Message, model string, opts GenerationOptions, out interface{}) (LLMResponse, error) {
+	if opts.ResponseFormat == nil {
+		rf := ResponseFormat{Name: schemaName(out), Schema: SchemaFor(out)}
+		opts.ResponseFormat = &rf
+	}
+	msgs := append([]Message(nil), messages...)
+	var resp LLMResponse
+	var lastErr error
+	for attempt := 0; attempt <= StructuredRetries; attempt++ {
+		var err error
+		resp, err = p.Chat(ctx, msgs, nil, model, opts)
+		if err != nil && opts.ResponseFormat != nil && isResponseFormatError(err) {
+			log.Printf("%s does not accept response_format; asking for JSON in the prompt: %v", model, err)
+			msgs = withSchemaPrompt(msgs, *opts.ResponseFormat)
+			opts.ResponseFormat = nil
+			resp, err = p.Chat(ctx, msgs, nil, model, opts)
+		}
+		if err != nil {
+			return resp, err
+		}
+		raw := resp.Content
+		if strings.TrimSpace(raw) == "" && len(resp.ToolCalls) > 0 {
+			b, _ := json.Marshal(resp.ToolCalls[0].Arguments)
+			raw = string(b)
+		}
+		if lastErr = decodeStructured(raw, out); lastErr == nil {
+			return resp, nil
+		}
+		msgs = append(msgs,
+			Message{Role: "assistant", Content: raw},
+			Message{Role: "user", Content: fmt.Sprintf("That reply could not be used: %v. Reply again with only a JSON value matching the requested schema.", lastErr)},
+		)
+	}
+	return resp, fmt.Errorf("%w: %v", ErrInvalidStructuredOutput, lastErr)
+}
+
+// isResponseFormatError reports whether err is an API rejecting the request's
+// response_format, as servers without structured output support do.
+func isResponseFormatError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == 400 && strings.Contains(strings.ToLower(apiErr.Body), "response_format")
+}
+
+// schemaInstruction asks for a reply matching rf in words, for APIs without response_format.
+func schemaInstruction(rf ResponseFormat) string {
+	schema, _ := json.Marshal(rf.Schema)
+	return "Reply with only a JSON value matching this JSON Schema, without code fences or other text:\n" + string(schema)
+}
+
+// withSchemaPrompt returns a copy of messages with schemaInstruction(rf) added to the
+// leading system message, or in a new one.
+func withSchemaPrompt(messages []Message, rf ResponseFormat) []Message {
+	if len(messages) > 0 && messages[0].Role == "system" {
+		out := append([]Message(nil), messages...)
+		out[0].Content = strings.TrimSpace(ContentToString(out[0].Content) + "\n\n" + schemaInstruction(rf))
+		return out
+	}
+	return append([]Message{{Role: "system", Content: schemaInstruction(rf)}}, messages...)
+}
+
+// decodeStructured decodes the JSON value in s into out and validates it. Code fences and
+// text around a single JSON object or array are tolerated.
+func decodeStructured(s string, out interface{}) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return errors.New("empty reply")
+	}
+	err := json.Unmarshal([]byte(s), out)
+	if err != nil {
+		// retry on the outermost {...} or [...], whichever starts first
+		start := strings.IndexAny(s, "{[")
+		if start < 0 {
+			return fmt.Errorf("no JSON found: %w", err)
+		}
+		closer := "}"
+		if s[start] == '[' {
+			closer = "]"
+		}
+		end := strings.LastIndex(s, closer)
+		if end <= start {
+			return fmt.Errorf("no JSON found: %w", err)
+		}
+		if err := json.Unmarshal([]byte(s[start:end+1]), out); err != nil {
+			return err
+		}
+	}
+	if v, ok := out.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// schemaName is the name sent with the schema: the target's type name, or "result".
+func schemaName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Name() == "" {
+		return "result"
+	}
+	return t.Name()
+}
+
+// SchemaFor returns a JSON Schema describing v's type, following encoding/json field names.
+// Fields tagged omitempty are optional; a `desc:"..."` tag becomes the field's description.
+func SchemaFor(v interface{}) map[string]interface{} {
+	return schemaForType(reflect.TypeOf(v))
+}
+
+func schemaForType(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaForType(t.Elem())}
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			fs := schemaForType(f.Type)
+			if d := f.Tag.Get("desc"); d != "" {
+				fs["description"] = d
+			}
+			props[name] = fs
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": props, "required": required, "additionalProperties": false}
+	}
+	// interface{} and anything else: no constraint
+	return map[string]interface{}{}
+}
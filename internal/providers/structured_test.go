@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type weather struct {
+	City  string   `json:"city"`
+	TempC float64  `json:"tempC"`
+	Notes []string `json:"notes,omitempty" desc:"anything else worth knowing"`
+}
+
+func (w *weather) Validate() error {
+	if w.City == "" {
+		return errors.New("city is required")
+	}
+	return nil
+}
+
+// queueProvider replies with the queued contents in order and records the requests.
+type queueProvider struct {
+	replies []string
+	reqs    [][]Message
+	opts    []GenerationOptions
+}
+
+func (p *queueProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	p.reqs = append(p.reqs, messages)
+	p.opts = append(p.opts, opts)
+	r := p.replies[0]
+	if len(p.replies) > 1 {
+		p.replies = p.replies[1:]
+	}
+	return LLMResponse{Content: r}, nil
+}
+
+func (p *queueProvider) GetDefaultModel() string { return "queue" }
+
+func TestChatJSONRetriesInvalidReplies(t *testing.T) {
+	p := &queueProvider{replies: []string{"Sure! Here it is: {\"tempC\": 21}", "```json\n{\"city\": \"Oslo\", \"tempC\": 21.5}\n```"}}
+	var w weather
+	if _, err := ChatJSON(context.Background(), p, []Message{{Role: "user", Content: "weather?"}}, "m", GenerationOptions{}, &w); err != nil {
+		t.Fatal(err)
+	}
+	if w.City != "Oslo" || w.TempC != 21.5 {
+		t.Errorf("unexpected result %+v", w)
+	}
+	if len(p.reqs) != 2 {
+		t.Fatalf("expected one retry, got %d calls", len(p.reqs))
+	}
+	// the retry shows the model its reply and what was wrong with it
+	retry := p.reqs[1]
+	if len(retry) != 3 || retry[1].Role != "assistant" || retry[2].Role != "user" {
+		t.Fatalf("unexpected retry messages %+v", retry)
+	}
+	if rf := p.opts[0].ResponseFormat; rf == nil || rf.Name != "weather" || rf.Schema["type"] != "object" {
+		t.Errorf("expected a response format derived from the target, got %+v", rf)
+	}
+
+	p = &queueProvider{replies: []string{"no idea"}}
+	if _, err := ChatJSON(context.Background(), p, nil, "m", GenerationOptions{}, &w); !errors.Is(err, ErrInvalidStructuredOutput) {
+		t.Fatalf("expected ErrInvalidStructuredOutput, got %v", err)
+	}
+	if len(p.reqs) != StructuredRetries+1 {
+		t.Errorf("expected %d calls, got %d", StructuredRetries+1, len(p.reqs))
+	}
+}
+
+// formatRejectingProvider fails calls that carry a response format, like a server without
+// structured output support, and otherwise replies like queueProvider.
+type formatRejectingProvider struct {
+	queueProvider
+}
+
+func (p *formatRejectingProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts GenerationOptions) (LLMResponse, error) {
+	if opts.ResponseFormat != nil {
+		p.opts = append(p.opts, opts)
+		return LLMResponse{}, &APIError{Provider: "OpenAI", StatusCode: 400, Status: "400 Bad Request", Body: `{"error":{"message":"Unknown parameter: response_format"}}`}
+	}
+	return p.queueProvider.Chat(ctx, messages, tools, model, opts)
+}
+
+func TestChatJSONFallsBackWithoutResponseFormat(t *testing.T) {
+	p := &formatRejectingProvider{queueProvider{replies: []string{`{"city": "Oslo", "tempC": 3}`}}}
+	var w weather
+	msgs := []Message{{Role: "system", Content: "You report weather."}, {Role: "user", Content: "weather?"}}
+	if _, err := ChatJSON(context.Background(), p, msgs, "m", GenerationOptions{}, &w); err != nil {
+		t.Fatal(err)
+	}
+	if w.City != "Oslo" || len(p.reqs) != 1 || len(p.opts) != 2 {
+		t.Fatalf("expected one rejected and one plain call, got %+v after %d calls", w, len(p.opts))
+	}
+	// the schema moves into the system prompt, without touching the caller's messages
+	sys := ContentToString(p.reqs[0][0].Content)
+	if len(p.reqs[0]) != 2 || !strings.HasPrefix(sys, "You report weather.") || !strings.Contains(sys, `"city"`) {
+		t.Errorf("unexpected system prompt %q", sys)
+	}
+	if msgs[0].Content != "You report weather." {
+		t.Errorf("caller's messages changed: %+v", msgs[0])
+	}
+
+	// other errors are returned as they are
+	bad := &APIError{Provider: "OpenAI", StatusCode: 400, Status: "400 Bad Request", Body: "invalid model"}
+	if _, err := ChatJSON(context.Background(), failProvider{bad}, msgs, "m", GenerationOptions{}, &w); !errors.Is(err, bad) {
+		t.Fatalf("expected the API error, got %v", err)
+	}
+}
+
+type failProvider struct{ err error }
+
+func (p failProvider) Chat(context.Context, []Message, []ToolDefinition, string, GenerationOptions) (LLMResponse, error) {
+	return LLMResponse{}, p.err
+}
+func (p failProvider) GetDefaultModel() string { return "err" }
+
+func TestSchemaFor(t *testing.T) {
+	got := SchemaFor(&weather{})
+	want := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"city":  map[string]interface{}{"type": "string"},
+			"tempC": map[string]interface{}{"type": "number"},
+			"notes": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "anything else worth knowing"},
+		},
+		"required":             []string{"city", "tempC"},
+		"additionalProperties": false,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaFor = %v, want %v", got, want)
+	}
+}
@@ -1,99 +1,168 @@
 package session
 
 import (
-	"encoding/json"
-	"os"
+	"log"
 	"path/filepath"
-	"sync"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/providers"
 )
 
 // MaxHistorySize is the maximum number of messages kept in a session.
 // Older messages are trimmed on save to keep the session file small
-// and avoid blowing up the LLM context window.
+// and avoid blowing up the LLM context window. Tool calls and tool results
+// count as messages, so a turn that uses tools takes several.
 // Important information should be persisted via write_memory, not session history.
-const MaxHistorySize = 50
+const MaxHistorySize = 100
+
+// MaxToolResultLen caps a tool result kept in the history. The model saw the whole
+// result during its turn; later turns only need to know what came back.
+const MaxToolResultLen = 2000
+
+// Message is one message of a session transcript.
+type Message struct {
+	providers.Message
+	Time time.Time `json:"time"`
+}
 
 // Session holds a short chat history.
 type Session struct {
-	Key     string
-	History []string
+	Key      string
+	Messages []Message
+	// ShowThinking makes replies in this chat include a collapsed summary of the
+	// model's reasoning (toggled with /thinking).
+	ShowThinking bool `json:",omitempty"`
+	// Model overrides the agent's model for this chat (set with /model); empty means the default.
+	Model string `json:",omitempty"`
+
+	// saved is what the store held when s was loaded or last saved, so that a store shared
+	// with another process can write only what s changed.
+	saved savedState
+}
+
+// savedState is the stored state of a session as far as one copy of it knows.
+type savedState struct {
+	messages     int // leading messages of the copy that are stored
+	showThinking bool
+	model        string
+	reset        bool // the copy was reset: drop the stored messages
 }
 
-// SessionManager stores sessions in memory and persists to disk under workspace.
+// markSaved records that the store now holds s.
+func (s *Session) markSaved() {
+	s.saved = savedState{messages: len(s.Messages), showThinking: s.ShowThinking, model: s.Model}
+}
+
+// SessionManager loads and saves sessions through a SessionStore. It keeps no copy of its
+// own, so another process using the same store (the gateway and "picobot agent") sees every
+// saved change.
 type SessionManager struct {
-	mu        sync.RWMutex
-	sessions  map[string]*Session
-	workspace string
+	store SessionStore
 }
 
+// NewSessionManager returns a manager that keeps sessions as JSON files under workspace.
 func NewSessionManager(workspace string) *SessionManager {
-	return &SessionManager{sessions: make(map[string]*Session), workspace: workspace}
+	return NewSessionManagerWithStore(NewJSONStore(filepath.Join(workspace, "sessions")))
+}
+
+// NewSessionManagerWithStore returns a manager that keeps sessions in store.
+func NewSessionManagerWithStore(store SessionStore) *SessionManager {
+	return &SessionManager{store: store}
 }
 
+// GetOrCreate returns the stored session for key, or a new empty one.
 func (sm *SessionManager) GetOrCreate(key string) *Session {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	if s, ok := sm.sessions[key]; ok {
-		return s
+	s, err := sm.store.Load(key)
+	if err != nil {
+		log.Printf("error loading session %s: %v", key, err)
+	}
+	if s == nil {
+		s = &Session{Key: key, Messages: make([]Message, 0)}
 	}
-	s := &Session{Key: key, History: make([]string, 0)}
-	sm.sessions[key] = s
 	return s
 }
 
+// Save trims s to the most recent messages and stores it.
 func (sm *SessionManager) Save(s *Session) error {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	// Trim history to the most recent messages
 	s.trim()
-	path := filepath.Join(sm.workspace, "sessions")
-	os.MkdirAll(path, 0755)
-	fpath := filepath.Join(path, s.Key+".json")
-	b, err := json.MarshalIndent(s, "", "  ")
-	if err != nil {
-		return err
+	return sm.store.Save(s)
+}
+
+// AddMessage appends a text message.
+func (s *Session) AddMessage(role, content string) {
+	s.Append(providers.Message{Role: role, Content: content})
+}
+
+// Append adds messages of a turn, stamped with the current time. Tool results are cut to
+// MaxToolResultLen, and reasoning, which providers only need within a turn, is dropped.
+func (s *Session) Append(msgs ...providers.Message) {
+	now := time.Now()
+	for _, m := range msgs {
+		m.Reasoning, m.ReasoningDetails = "", nil
+		if text, ok := m.Content.(string); ok && m.Role == "tool" {
+			if r := []rune(text); len(r) > MaxToolResultLen {
+				m.Content = string(r[:MaxToolResultLen]) + "\n…[truncated]"
+			}
+		}
+		m.Content = withoutInlineImages(m.Content)
+		s.Messages = append(s.Messages, Message{Message: m, Time: now})
 	}
-	return os.WriteFile(fpath, b, 0644)
 }
 
-func (sm *SessionManager) LoadAll() error {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	path := filepath.Join(sm.workspace, "sessions")
-	_ = os.MkdirAll(path, 0755)
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return err
+// withoutInlineImages replaces images embedded as data URLs with a note, so session files
+// stay small. Linked images are kept.
+func withoutInlineImages(content interface{}) interface{} {
+	parts, ok := content.([]interface{})
+	if !ok {
+		return content
 	}
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
+	out := make([]interface{}, 0, len(parts))
+	for _, p := range parts {
+		if m, ok := p.(map[string]interface{}); ok && m["type"] == "image_url" {
+			if img, ok := m["image_url"].(map[string]interface{}); ok {
+				if url, _ := img["url"].(string); strings.HasPrefix(url, "data:") {
+					p = map[string]interface{}{"type": "text", "text": "[image not kept]"}
+				}
+			}
 		}
-		b, err := os.ReadFile(filepath.Join(path, e.Name()))
-		if err != nil {
-			continue
-		}
-		var s Session
-		if err := json.Unmarshal(b, &s); err != nil {
-			continue
-		}
-		sm.sessions[s.Key] = &s
+		out = append(out, p)
 	}
-	return nil
+	return out
 }
 
-func (s *Session) AddMessage(role, content string) {
-	s.History = append(s.History, role+": "+content)
+// GetHistory returns the session history as messages for the model.
+func (s *Session) GetHistory() []providers.Message {
+	out := make([]providers.Message, len(s.Messages))
+	for i, m := range s.Messages {
+		out[i] = m.Message
+	}
+	return out
 }
 
-// GetHistory returns the session history.
-func (s *Session) GetHistory() []string {
-	return s.History
+// Reset clears the history.
+func (s *Session) Reset() {
+	s.Messages = make([]Message, 0)
+	s.saved.messages, s.saved.reset = 0, true
 }
 
-// trim keeps only the last MaxHistorySize messages, discarding the oldest.
+// trim keeps only the last MaxHistorySize messages, discarding the oldest. The kept
+// history starts at a user message, so no tool result is left without its call.
 func (s *Session) trim() {
-	if len(s.History) > MaxHistorySize {
-		s.History = s.History[len(s.History)-MaxHistorySize:]
+	cut := keepFrom(len(s.Messages), func(i int) string { return s.Messages[i].Role })
+	s.Messages = s.Messages[cut:]
+	s.saved.messages = max(s.saved.messages-cut, 0)
+}
+
+// keepFrom returns the index of the first of n messages that trimming keeps: the first user
+// message among the last MaxHistorySize, or n if there is none.
+func keepFrom(n int, role func(i int) string) int {
+	if n <= MaxHistorySize {
+		return 0
+	}
+	i := n - MaxHistorySize
+	for i < n && role(i) != "user" {
+		i++
 	}
+	return i
 }
@@ -0,0 +1,133 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestParseLegacyItem(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantRole string
+		wantCnt  string
+	}{
+		{"user: hello", "user", "hello"},
+		{"assistant: hi there", "assistant", "hi there"},
+		{"user: ", "user", ""},
+		{"assistant: multi\nline\ncontent", "assistant", "multi\nline\ncontent"},
+		{"tool: result", "user", "result"},
+		{"no-colon", "user", "no-colon"},
+		{"", "user", ""},
+	}
+	for _, tt := range tests {
+		role, content := parseLegacyItem(tt.in)
+		if role != tt.wantRole || content != tt.wantCnt {
+			t.Errorf("parseLegacyItem(%q) = (%q, %q), want (%q, %q)", tt.in, role, content, tt.wantRole, tt.wantCnt)
+		}
+	}
+}
+
+func TestLegacySessionIsMigrated(t *testing.T) {
+	workspace := t.TempDir()
+	path := filepath.Join(workspace, "sessions", "telegram:1.json")
+	legacy := `{"Key": "telegram:1", "History": ["user: hi", "assistant: hello!", "user: bye"], "ShowThinking": true}`
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := NewSessionManager(workspace)
+	s := sm.GetOrCreate("telegram:1")
+	h := s.GetHistory()
+	if len(h) != 3 || h[0].Role != "user" || h[1].Role != "assistant" || h[1].Content != "hello!" || !s.ShowThinking {
+		t.Fatalf("unexpected migrated session %+v", s)
+	}
+	if s.Messages[0].Time.IsZero() {
+		t.Error("migrated messages should be stamped with the file's time")
+	}
+	if err := sm.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	if strings.Contains(string(b), "History") || !strings.Contains(string(b), `"role": "assistant"`) {
+		t.Fatalf("expected the file in the new format, got %s", b)
+	}
+}
+
+func TestSessionKeepsToolCalls(t *testing.T) {
+	workspace := t.TempDir()
+	s := NewSessionManager(workspace).GetOrCreate("discord:1")
+	long := strings.Repeat("x", MaxToolResultLen+100)
+	s.Append(
+		providers.Message{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": "what's this?"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64,AAAA"}},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/cat.png"}},
+		}},
+		providers.Message{Role: "assistant", Reasoning: "look it up", ToolCalls: []providers.ToolCall{{ID: "c1", Name: "web", Arguments: map[string]interface{}{"url": "https://example.com"}}}},
+		providers.Message{Role: "tool", Content: long, ToolCallID: "c1"},
+	)
+	s.AddMessage("assistant", "A cat.")
+	if err := NewSessionManager(workspace).Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewSessionManager(workspace).GetOrCreate("discord:1").GetHistory()
+	if len(h) != 4 {
+		t.Fatalf("expected 4 messages after reloading, got %+v", h)
+	}
+	parts, _ := h[0].Content.([]interface{})
+	if len(parts) != 3 || parts[1].(map[string]interface{})["text"] != "[image not kept]" || parts[2].(map[string]interface{})["type"] != "image_url" {
+		t.Errorf("expected the inline image dropped and the linked one kept, got %#v", h[0].Content)
+	}
+	if len(h[1].ToolCalls) != 1 || h[1].ToolCalls[0].Name != "web" || h[1].Reasoning != "" {
+		t.Errorf("expected the tool call without reasoning, got %+v", h[1])
+	}
+	if c, _ := h[2].Content.(string); h[2].ToolCallID != "c1" || len(c) > MaxToolResultLen+20 {
+		t.Errorf("expected a truncated tool result for c1, got %d chars", len(c))
+	}
+}
+
+func TestTrimStartsAtAUserMessage(t *testing.T) {
+	s := &Session{Key: "k"}
+	for len(s.Messages) < MaxHistorySize+2 {
+		s.Append(
+			providers.Message{Role: "user", Content: "go"},
+			providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c", Name: "exec"}}},
+			providers.Message{Role: "tool", Content: "ok", ToolCallID: "c"},
+		)
+	}
+	s.trim()
+	if len(s.Messages) > MaxHistorySize || s.Messages[0].Role != "user" {
+		t.Fatalf("expected at most %d messages starting with a user message, got %d starting with %q", MaxHistorySize, len(s.Messages), s.Messages[0].Role)
+	}
+}
+
+func TestManagersShareJSONSessions(t *testing.T) {
+	workspace := t.TempDir()
+	gateway, cli := NewSessionManager(workspace), NewSessionManager(workspace)
+
+	s := gateway.GetOrCreate("cli:direct")
+	s.AddMessage("user", "hi")
+	if err := gateway.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	s = cli.GetOrCreate("cli:direct")
+	s.AddMessage("assistant", "hello")
+	if err := cli.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	if got := gateway.GetOrCreate("cli:direct").GetHistory(); len(got) != 2 || got[1].Content != "hello" {
+		t.Fatalf("expected the other manager's save, got %+v", got)
+	}
+	entries, _ := os.ReadDir(filepath.Join(workspace, "sessions"))
+	if len(entries) != 1 {
+		t.Fatalf("expected only the session file, got %v", entries)
+	}
+}
@@ -0,0 +1,236 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// sqliteSchema indexes sessions by channel and chat and by when they were last saved, and
+// messages by time, so sessions can be looked up without reading the others.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id            INTEGER PRIMARY KEY,
+	channel       TEXT    NOT NULL,
+	chat_id       TEXT    NOT NULL,
+	show_thinking INTEGER NOT NULL DEFAULT 0,
+	model         TEXT    NOT NULL DEFAULT '',
+	updated_at    INTEGER NOT NULL,
+	UNIQUE (channel, chat_id)
+);
+CREATE INDEX IF NOT EXISTS sessions_updated_at ON sessions (updated_at);
+CREATE TABLE IF NOT EXISTS messages (
+	session_id INTEGER NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+	seq        INTEGER NOT NULL,
+	time       INTEGER NOT NULL,
+	role       TEXT    NOT NULL,
+	message    TEXT    NOT NULL,
+	PRIMARY KEY (session_id, seq)
+);
+CREATE INDEX IF NOT EXISTS messages_time ON messages (time);
+`
+
+// SQLiteStore keeps sessions in a SQLite database (pure Go, no cgo). Every save is one
+// transaction, and the database is opened in WAL mode with a busy timeout, so the gateway
+// and "picobot agent" can use the same file at the same time.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens, or creates, the session database at path.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("session database %s: %w", path, err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// splitKey splits a session key such as "telegram:123" into its channel and chat.
+func splitKey(key string) (channel, chatID string) {
+	if i := strings.Index(key, ":"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+func (st *SQLiteStore) Load(key string) (*Session, error) {
+	channel, chatID := splitKey(key)
+	s := &Session{Key: key, Messages: make([]Message, 0)}
+	var id int64
+	err := st.db.QueryRow(`SELECT id, show_thinking, model FROM sessions WHERE channel = ? AND chat_id = ?`, channel, chatID).
+		Scan(&id, &s.ShowThinking, &s.Model)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := st.db.Query(`SELECT time, message FROM messages WHERE session_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ms int64
+		var raw string
+		if err := rows.Scan(&ms, &raw); err != nil {
+			return nil, err
+		}
+		var m Message
+		if err := json.Unmarshal([]byte(raw), &m.Message); err != nil {
+			return nil, fmt.Errorf("session %s: %w", key, err)
+		}
+		if ms != 0 {
+			m.Time = time.UnixMilli(ms)
+		}
+		s.Messages = append(s.Messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.markSaved()
+	return s, nil
+}
+
+// Save stores s in one transaction. Another process may have saved the session since s
+// was loaded, so it writes only what s changed: the messages s added, appended to the stored
+// ones, and the settings s changed. A reset s replaces the stored messages.
+func (st *SQLiteStore) Save(s *Session) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := saveSession(tx, s); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.markSaved()
+	return nil
+}
+
+// saveSession writes the changes of s in tx and trims the stored history to MaxHistorySize
+// messages. s takes the stored settings, which another process may have changed.
+func saveSession(tx *sql.Tx, s *Session) error {
+	channel, chatID := splitKey(s.Key)
+	var id int64
+	err := tx.QueryRow(`INSERT INTO sessions (channel, chat_id, show_thinking, model, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (channel, chat_id) DO UPDATE SET
+			show_thinking = CASE WHEN ? THEN excluded.show_thinking ELSE sessions.show_thinking END,
+			model = CASE WHEN ? THEN excluded.model ELSE sessions.model END,
+			updated_at = excluded.updated_at
+		RETURNING id, show_thinking, model`, channel, chatID, s.ShowThinking, s.Model, time.Now().UnixMilli(),
+		s.ShowThinking != s.saved.showThinking, s.Model != s.saved.model).Scan(&id, &s.ShowThinking, &s.Model)
+	if err != nil {
+		return err
+	}
+	if s.saved.reset {
+		if _, err := tx.Exec(`DELETE FROM messages WHERE session_id = ?`, id); err != nil {
+			return err
+		}
+	}
+	var next int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(seq) + 1, 0) FROM messages WHERE session_id = ?`, id).Scan(&next); err != nil {
+		return err
+	}
+	for _, m := range s.Messages[min(s.saved.messages, len(s.Messages)):] {
+		raw, err := json.Marshal(m.Message)
+		if err != nil {
+			return err
+		}
+		var ms int64
+		if !m.Time.IsZero() {
+			ms = m.Time.UnixMilli()
+		}
+		if _, err := tx.Exec(`INSERT INTO messages (session_id, seq, time, role, message) VALUES (?, ?, ?, ?, ?)`, id, next, ms, m.Role, string(raw)); err != nil {
+			return err
+		}
+		next++
+	}
+	return trimMessages(tx, id)
+}
+
+// trimMessages drops the stored messages of session id that Session.trim would drop.
+func trimMessages(tx *sql.Tx, id int64) error {
+	rows, err := tx.Query(`SELECT seq, role FROM messages WHERE session_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return err
+	}
+	var seqs []int64
+	var roles []string
+	for rows.Next() {
+		var seq int64
+		var role string
+		if err := rows.Scan(&seq, &role); err != nil {
+			rows.Close()
+			return err
+		}
+		seqs, roles = append(seqs, seq), append(roles, role)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	cut := keepFrom(len(roles), func(i int) string { return roles[i] })
+	switch {
+	case cut == 0:
+		return nil
+	case cut == len(seqs):
+		_, err = tx.Exec(`DELETE FROM messages WHERE session_id = ?`, id)
+	default:
+		_, err = tx.Exec(`DELETE FROM messages WHERE session_id = ? AND seq < ?`, id, seqs[cut])
+	}
+	return err
+}
+
+// ImportJSON copies the sessions kept as JSON files in dir, as JSONStore writes them, into
+// the database if it holds no sessions yet, and returns how many it copied. This way a
+// workspace that switches to SQLite keeps its chats. Unreadable files are skipped.
+func (st *SQLiteStore) ImportJSON(dir string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(paths) == 0 {
+		return 0, err
+	}
+	tx, err := st.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var existing int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&existing); err != nil || existing > 0 {
+		return 0, err
+	}
+	n := 0
+	for _, path := range paths {
+		s, err := readSession(path)
+		if err != nil {
+			log.Printf("session import: skipping %s: %v", path, err)
+			continue
+		}
+		if s.Key == "" {
+			s.Key = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if err := saveSession(tx, s); err != nil {
+			return 0, fmt.Errorf("session import: %s: %w", path, err)
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
+
+func (st *SQLiteStore) Close() error { return st.db.Close() }
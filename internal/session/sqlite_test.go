@@ -0,0 +1,169 @@
+package session
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestSQLiteStoreRoundTrip(t *testing.T) {
+	st, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	sm := NewSessionManagerWithStore(st)
+
+	if s, err := st.Load("telegram:1"); s != nil || err != nil {
+		t.Fatalf("Load of a missing session = %+v, %v", s, err)
+	}
+	s := sm.GetOrCreate("telegram:1")
+	s.ShowThinking, s.Model = true, "small"
+	s.AddMessage("user", "list files")
+	s.Append(
+		providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c1", Name: "filesystem", Arguments: map[string]interface{}{"action": "list"}}}},
+		providers.Message{Role: "tool", Content: "a.txt", ToolCallID: "c1"},
+	)
+	s.AddMessage("assistant", "There is a.txt.")
+	if err := sm.Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	got := sm.GetOrCreate("telegram:1")
+	if !got.ShowThinking || got.Model != "small" || len(got.Messages) != 4 {
+		t.Fatalf("unexpected session %+v", got)
+	}
+	if tc := got.Messages[1].ToolCalls; len(tc) != 1 || tc[0].Name != "filesystem" || got.Messages[2].ToolCallID != "c1" {
+		t.Fatalf("tool call not kept: %+v", got.Messages[1:3])
+	}
+	if got.Messages[0].Time.IsZero() {
+		t.Error("message time not kept")
+	}
+	if other := sm.GetOrCreate("telegram:2"); len(other.Messages) != 0 {
+		t.Fatalf("another chat should start empty, got %+v", other)
+	}
+
+	got.Reset()
+	if err := sm.Save(got); err != nil {
+		t.Fatal(err)
+	}
+	if s := sm.GetOrCreate("telegram:1"); len(s.Messages) != 0 || !s.ShowThinking {
+		t.Fatalf("expected an empty history after a reset, got %+v", s)
+	}
+}
+
+// TestSQLiteStoreShared checks that two stores on one file, like the gateway and the agent
+// CLI, see each other's saves and can write at the same time.
+func TestSQLiteStoreShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	var sms []*SessionManager
+	for i := 0; i < 2; i++ {
+		st, err := OpenSQLiteStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer st.Close()
+		sms = append(sms, NewSessionManagerWithStore(st))
+	}
+
+	var wg sync.WaitGroup
+	for i, sm := range sms {
+		wg.Add(1)
+		go func(i int, sm *SessionManager) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s := sm.GetOrCreate([]string{"telegram:1", "cli:direct"}[i])
+				s.AddMessage("user", "hi")
+				if err := sm.Save(s); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i, sm)
+	}
+	wg.Wait()
+
+	for _, key := range []string{"telegram:1", "cli:direct"} {
+		if n := len(sms[0].GetOrCreate(key).Messages); n != 20 {
+			t.Errorf("%s has %d messages, want 20", key, n)
+		}
+	}
+}
+
+// TestSQLiteStoreKeepsConcurrentTurns checks that two processes adding to the same chat,
+// each with a copy loaded before the other saved, keep each other's messages and settings.
+func TestSQLiteStoreKeepsConcurrentTurns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	var sms []*SessionManager
+	for i := 0; i < 2; i++ {
+		st, err := OpenSQLiteStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer st.Close()
+		sms = append(sms, NewSessionManagerWithStore(st))
+	}
+
+	gateway, cli := sms[0].GetOrCreate("telegram:1"), sms[1].GetOrCreate("telegram:1")
+	gateway.Model = "small"
+	gateway.AddMessage("user", "from the gateway")
+	cli.AddMessage("user", "from the cli")
+	for _, s := range []*Session{gateway, cli} {
+		if err := sms[0].Save(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := sms[1].GetOrCreate("telegram:1")
+	if len(got.Messages) != 2 || got.Messages[0].Content != "from the gateway" || got.Messages[1].Content != "from the cli" {
+		t.Fatalf("expected both turns, got %+v", got.Messages)
+	}
+	if got.Model != "small" || cli.Model != "small" {
+		t.Fatalf("expected the gateway's model to survive the cli's save, got %q and %q", got.Model, cli.Model)
+	}
+
+	// both copies grow past MaxHistorySize together; the stored history is trimmed
+	for i := 0; i < MaxHistorySize/2; i++ {
+		for _, s := range []*Session{gateway, cli} {
+			s.AddMessage("user", "hi")
+			s.AddMessage("assistant", "hello")
+			if err := sms[0].Save(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	got = sms[1].GetOrCreate("telegram:1")
+	if len(got.Messages) > MaxHistorySize || got.Messages[0].Role != "user" {
+		t.Fatalf("expected at most %d messages starting with a user message, got %d starting with %q", MaxHistorySize, len(got.Messages), got.Messages[0].Role)
+	}
+}
+
+func TestSQLiteStoreImportsJSONSessions(t *testing.T) {
+	ws := t.TempDir()
+	js := NewSessionManager(ws)
+	s := js.GetOrCreate("telegram:1")
+	s.Model = "small"
+	s.AddMessage("user", "hi")
+	s.AddMessage("assistant", "hello")
+	if err := js.Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := OpenSQLiteStore(filepath.Join(ws, "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if n, err := st.ImportJSON(filepath.Join(ws, "sessions")); n != 1 || err != nil {
+		t.Fatalf("ImportJSON = %d, %v", n, err)
+	}
+	got := NewSessionManagerWithStore(st).GetOrCreate("telegram:1")
+	if got.Model != "small" || len(got.Messages) != 2 || got.Messages[1].Content != "hello" {
+		t.Fatalf("unexpected imported session %+v", got)
+	}
+	// the database is no longer empty, so a second run leaves it alone
+	if n, err := st.ImportJSON(filepath.Join(ws, "sessions")); n != 0 || err != nil {
+		t.Fatalf("second ImportJSON = %d, %v", n, err)
+	}
+}
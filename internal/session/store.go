@@ -0,0 +1,138 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+// SessionStore persists sessions. Implementations must be safe for concurrent use, and
+// should be safe to share with another process using the same workspace.
+type SessionStore interface {
+	// Load returns the session stored under key, or nil if there is none.
+	Load(key string) (*Session, error)
+	// Save stores s under s.Key. JSONStore replaces the stored session; SQLiteStore keeps
+	// the messages another process added since s was loaded.
+	Save(s *Session) error
+	Close() error
+}
+
+// JSONStore keeps each session in a JSON file named after its key. It is the default store.
+type JSONStore struct {
+	dir string
+}
+
+// NewJSONStore returns a store that keeps session files in dir.
+func NewJSONStore(dir string) *JSONStore {
+	return &JSONStore{dir: dir}
+}
+
+func (st *JSONStore) path(key string) string {
+	return filepath.Join(st.dir, key+".json")
+}
+
+func (st *JSONStore) Load(key string) (*Session, error) {
+	s, err := readSession(st.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Key != key {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// Save writes the session to a temporary file and renames it into place, so a reader in
+// this or another process never sees a partly written file.
+func (st *JSONStore) Save(s *Session) error {
+	if err := os.MkdirAll(st.dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(st.dir, ".session-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), st.path(s.Key))
+}
+
+func (st *JSONStore) Close() error { return nil }
+
+// readSession reads a session file. Files written before sessions kept typed messages
+// hold a "History" of "role: content" strings; they are converted, and rewritten in the
+// new format on the next save.
+func readSession(path string) (*Session, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s struct {
+		Session
+		History []string // legacy
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	if len(s.Messages) == 0 && len(s.History) > 0 {
+		var modTime time.Time
+		if fi, err := os.Stat(path); err == nil {
+			modTime = fi.ModTime()
+		}
+		for _, h := range s.History {
+			if h == "" {
+				continue
+			}
+			role, content := parseLegacyItem(h)
+			s.Messages = append(s.Messages, Message{Message: providers.Message{Role: role, Content: content}, Time: modTime})
+		}
+	}
+	if s.Messages == nil {
+		s.Messages = make([]Message, 0)
+	}
+	return &s.Session, nil
+}
+
+// parseLegacyItem extracts role and content from a legacy history item in "role: content" format.
+// Returns ("user", content) for "user: hello", ("assistant", content) for "assistant: hi", etc.
+// Defaults to "user" if the role is unrecognized.
+func parseLegacyItem(h string) (role, content string) {
+	const sep = ": "
+	idx := strings.Index(h, sep)
+	if idx < 0 {
+		return "user", h
+	}
+	role = strings.TrimSpace(strings.ToLower(h[:idx]))
+	content = strings.TrimSpace(h[idx+len(sep):])
+	switch role {
+	case "assistant":
+		return "assistant", content
+	case "system":
+		return "system", content
+	default:
+		// legacy "tool" items have no call to belong to
+		return "user", content
+	}
+}
@@ -0,0 +1,74 @@
+package usage
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+// RecordingProvider wraps a provider and records the usage of every successful call,
+// tagged with the Tags found on the call's context. Calls replayed from a cassette cost
+// nothing and are not recorded.
+type RecordingProvider struct {
+	inner    providers.LLMProvider
+	recorder *Recorder
+}
+
+// NewRecordingProvider wraps p so its calls are recorded to rec.
+func NewRecordingProvider(p providers.LLMProvider, rec *Recorder) *RecordingProvider {
+	return &RecordingProvider{inner: p, recorder: rec}
+}
+
+func (p *RecordingProvider) GetDefaultModel() string { return p.inner.GetDefaultModel() }
+
+func (p *RecordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	resp, err := p.inner.Chat(ctx, messages, tools, model, opts)
+	if err == nil {
+		p.record(ctx, model, resp)
+	}
+	return resp, err
+}
+
+// ChatStream streams when the wrapped provider can, and otherwise falls back to Chat.
+func (p *RecordingProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions, onDelta func(delta string)) (providers.LLMResponse, error) {
+	sp, ok := p.inner.(providers.StreamingProvider)
+	if !ok {
+		return p.Chat(ctx, messages, tools, model, opts)
+	}
+	resp, err := sp.ChatStream(ctx, messages, tools, model, opts, onDelta)
+	if err == nil {
+		p.record(ctx, model, resp)
+	}
+	return resp, err
+}
+
+// record adds a record for resp. The model is the one that served the call, which after a
+// fallback or through a provider prefix differs from the one asked for.
+func (p *RecordingProvider) record(ctx context.Context, model string, resp providers.LLMResponse) {
+	if resp.Replayed {
+		return
+	}
+	if resp.Model != "" {
+		model = resp.Model
+	}
+	if model == "" {
+		model = p.inner.GetDefaultModel()
+	}
+	u := resp.Usage
+	t := TagsFrom(ctx)
+	rec := Record{
+		Time:             time.Now(),
+		SessionKey:       t.SessionKey,
+		Channel:          t.Channel,
+		Model:            model,
+		Purpose:          t.Purpose,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		CachedTokens:     u.CachedTokens,
+	}
+	if err := p.recorder.Add(rec); err != nil {
+		log.Printf("usage: failed to record call: %v", err)
+	}
+}
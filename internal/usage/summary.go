@@ -0,0 +1,94 @@
+package usage
+
+import (
+	"sort"
+
+	"github.com/local/picobot/internal/config"
+)
+
+// Grouping keys accepted by Summarize.
+const (
+	ByDay   = "day"
+	ByModel = "model"
+	ByChat  = "chat"
+)
+
+// Row is the aggregate of all records sharing a key.
+type Row struct {
+	Key              string
+	Calls            int
+	PromptTokens     int
+	CompletionTokens int
+	CachedTokens     int
+	Cost             float64 // USD; only includes records whose model has a price
+	Unpriced         int     // calls whose model has no price
+}
+
+// Summarize groups records by day, model or chat (session key) and estimates cost from prices.
+// Rows are sorted by key for days and by cost, then tokens, otherwise.
+func Summarize(records []Record, by string, prices map[string]config.ModelPrice) []Row {
+	rows := map[string]*Row{}
+	for _, rec := range records {
+		key := groupKey(rec, by)
+		row := rows[key]
+		if row == nil {
+			row = &Row{Key: key}
+			rows[key] = row
+		}
+		row.Calls++
+		row.PromptTokens += rec.PromptTokens
+		row.CompletionTokens += rec.CompletionTokens
+		row.CachedTokens += rec.CachedTokens
+		if price, ok := prices[rec.Model]; ok {
+			row.Cost += Cost(rec, price)
+		} else {
+			row.Unpriced++
+		}
+	}
+
+	out := make([]Row, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if by == ByDay {
+			return out[i].Key < out[j].Key
+		}
+		if out[i].Cost != out[j].Cost {
+			return out[i].Cost > out[j].Cost
+		}
+		ti, tj := out[i].PromptTokens+out[i].CompletionTokens, out[j].PromptTokens+out[j].CompletionTokens
+		if ti != tj {
+			return ti > tj
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+// Cost returns the USD cost of one call at the given price.
+func Cost(rec Record, price config.ModelPrice) float64 {
+	cachedPrice := price.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = price.Input
+	}
+	uncached := rec.PromptTokens - rec.CachedTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+	return (float64(uncached)*price.Input + float64(rec.CachedTokens)*cachedPrice + float64(rec.CompletionTokens)*price.Output) / 1_000_000
+}
+
+func groupKey(rec Record, by string) string {
+	switch by {
+	case ByModel:
+		return rec.Model
+	case ByChat:
+		if rec.SessionKey == "" {
+			return "(none)"
+		}
+		return rec.SessionKey
+	default:
+		return rec.Time.Local().Format("2006-01-02")
+	}
+}
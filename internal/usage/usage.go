@@ -0,0 +1,151 @@
+// Package usage records the tokens spent on each LLM call and summarises them.
+package usage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Purposes tag why an LLM call was made.
+const (
+	PurposeChat       = "chat"
+	PurposeCompaction = "compaction"
+	PurposeRanking    = "ranking"
+	PurposeSubagent   = "subagent"
+)
+
+// Tags describe the context of an LLM call. They travel on the context.Context
+// passed to the provider so that deep callers (compaction, ranking) need no extra plumbing.
+type Tags struct {
+	SessionKey string // e.g. "telegram:12345"
+	Channel    string
+	Purpose    string
+}
+
+type tagsKey struct{}
+
+// WithTags returns a context carrying t.
+func WithTags(ctx context.Context, t Tags) context.Context {
+	return context.WithValue(ctx, tagsKey{}, t)
+}
+
+// WithPurpose returns a context whose tags have Purpose replaced, keeping the session and channel.
+func WithPurpose(ctx context.Context, purpose string) context.Context {
+	t := TagsFrom(ctx)
+	t.Purpose = purpose
+	return WithTags(ctx, t)
+}
+
+// TagsFrom returns the tags carried by ctx, or zero Tags.
+func TagsFrom(ctx context.Context) Tags {
+	t, _ := ctx.Value(tagsKey{}).(Tags)
+	return t
+}
+
+// Record is one LLM call as persisted in the workspace.
+type Record struct {
+	Time             time.Time `json:"time"`
+	SessionKey       string    `json:"session,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	Model            string    `json:"model"`
+	Purpose          string    `json:"purpose,omitempty"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	CachedTokens     int       `json:"cachedTokens,omitempty"`
+}
+
+// Recorder appends records to daily JSONL files under <workspace>/usage.
+type Recorder struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewRecorder returns a Recorder for the given workspace. The directory is created on first write.
+func NewRecorder(workspace string) *Recorder {
+	return &Recorder{dir: filepath.Join(workspace, "usage")}
+}
+
+// Add appends rec to the file for its day.
+func (r *Recorder) Add(rec Record) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(r.dir, rec.Time.Format("2006-01-02")+".jsonl")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Records returns all records at or after since (zero means all), oldest first.
+// Malformed lines are skipped.
+func (r *Recorder) Records(since time.Time) ([]Record, error) {
+	entries, err := os.ReadDir(r.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		// skip whole files that end before since
+		if day, err := time.ParseInLocation("2006-01-02", strings.TrimSuffix(name, ".jsonl"), time.Local); err == nil && !since.IsZero() && day.AddDate(0, 0, 1).Before(since) {
+			continue
+		}
+		recs, err := readRecords(filepath.Join(r.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("usage: reading %s: %w", name, err)
+		}
+		for _, rec := range recs {
+			if rec.Time.Before(since) {
+				continue
+			}
+			out = append(out, rec)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+func readRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []Record
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,135 @@
+package usage
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+)
+
+// fixedUsageProvider answers every call with the same usage.
+type fixedUsageProvider struct{ u providers.Usage }
+
+func (p *fixedUsageProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	return providers.LLMResponse{Content: "ok", Usage: p.u}, nil
+}
+
+func (p *fixedUsageProvider) GetDefaultModel() string { return "default-model" }
+
+func TestRecordingProviderTagsCalls(t *testing.T) {
+	rec := NewRecorder(t.TempDir())
+	p := NewRecordingProvider(&fixedUsageProvider{u: providers.Usage{PromptTokens: 100, CompletionTokens: 20, CachedTokens: 40}}, rec)
+
+	ctx := WithTags(context.Background(), Tags{SessionKey: "telegram:1", Channel: "telegram", Purpose: PurposeChat})
+	if _, err := p.Chat(ctx, nil, nil, "m1", providers.GenerationOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Chat(WithPurpose(ctx, PurposeCompaction), nil, nil, "", providers.GenerationOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := rec.Records(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(got))
+	}
+	if got[0].SessionKey != "telegram:1" || got[0].Channel != "telegram" || got[0].Purpose != PurposeChat || got[0].Model != "m1" {
+		t.Errorf("unexpected first record %+v", got[0])
+	}
+	if got[1].Purpose != PurposeCompaction || got[1].SessionKey != "telegram:1" || got[1].Model != "default-model" {
+		t.Errorf("unexpected second record %+v", got[1])
+	}
+	if got[0].PromptTokens != 100 || got[0].CompletionTokens != 20 || got[0].CachedTokens != 40 {
+		t.Errorf("unexpected token counts %+v", got[0])
+	}
+}
+
+// servingProvider answers like a real provider: it reports the model it was sent.
+type servingProvider struct{ replayed bool }
+
+func (p *servingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts providers.GenerationOptions) (providers.LLMResponse, error) {
+	if model == "busy" {
+		return providers.LLMResponse{}, &providers.APIError{Provider: "test", StatusCode: 429}
+	}
+	return providers.LLMResponse{Content: "ok", Model: model, Replayed: p.replayed, Usage: providers.Usage{PromptTokens: 1}}, nil
+}
+
+func (p *servingProvider) GetDefaultModel() string { return "default-model" }
+
+func TestRecordingProviderRecordsServingModel(t *testing.T) {
+	rec := NewRecorder(t.TempDir())
+	inner := &servingProvider{}
+	reg := providers.NewProviderRegistry(map[string]providers.LLMProvider{"ollama": inner}, "ollama")
+	p := NewRecordingProvider(providers.NewFallbackProvider(reg, providers.FallbackTarget{Provider: reg, Model: "ollama/llama3.2"}), rec)
+
+	// the routing prefix is not part of the recorded model
+	if _, err := p.Chat(context.Background(), nil, nil, "ollama/qwen3", providers.GenerationOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// after a failover the model that answered is recorded
+	if _, err := p.Chat(context.Background(), nil, nil, "busy", providers.GenerationOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	inner.replayed = true
+	if _, err := p.Chat(context.Background(), nil, nil, "ollama/qwen3", providers.GenerationOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := rec.Records(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Model != "qwen3" || got[1].Model != "llama3.2" {
+		t.Fatalf("unexpected records %+v", got)
+	}
+}
+
+func TestRecordsSince(t *testing.T) {
+	rec := NewRecorder(t.TempDir())
+	now := time.Now()
+	for _, ts := range []time.Time{now.AddDate(0, 0, -10), now.Add(-time.Hour), now} {
+		if err := rec.Add(Record{Time: ts, Model: "m"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := rec.Records(now.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 recent records, got %d", len(got))
+	}
+}
+
+func TestSummarizeByModelWithPrices(t *testing.T) {
+	records := []Record{
+		{Model: "cheap", SessionKey: "a", PromptTokens: 1_000_000, CompletionTokens: 0},
+		{Model: "pricey", SessionKey: "b", PromptTokens: 1_000_000, CachedTokens: 500_000, CompletionTokens: 1_000_000},
+		{Model: "unknown", SessionKey: "b", PromptTokens: 10},
+	}
+	prices := map[string]config.ModelPrice{
+		"cheap":  {Input: 0.1, Output: 0.4},
+		"pricey": {Input: 2, Output: 8, CachedInput: 0.5},
+	}
+	rows := Summarize(records, ByModel, prices)
+	if len(rows) != 3 || rows[0].Key != "pricey" {
+		t.Fatalf("expected pricey first, got %+v", rows)
+	}
+	// 0.5M uncached * $2 + 0.5M cached * $0.5 + 1M output * $8
+	if want := 1 + 0.25 + 8.0; math.Abs(rows[0].Cost-want) > 1e-9 {
+		t.Errorf("pricey cost = %v, want %v", rows[0].Cost, want)
+	}
+	if rows[2].Key != "unknown" || rows[2].Unpriced != 1 {
+		t.Errorf("expected unpriced row last, got %+v", rows[2])
+	}
+
+	byChat := Summarize(records, ByChat, prices)
+	if len(byChat) != 2 || byChat[0].Key != "b" || byChat[0].Calls != 2 {
+		t.Errorf("unexpected chat summary %+v", byChat)
+	}
+}